@@ -27,6 +27,11 @@ func init() {
 	// Add flags
 	caCmd.Flags().StringVarP(&caKey, "key-out", "k", "ca.key", "destination path for CA key")
 	caCmd.Flags().StringVarP(&caCert, "cert-out", "o", "ca.crt", "destination path for CA certificate")
+	caCmd.Flags().StringVar(&issuanceLogPath, "log", getDefaultIssuanceLogPath(), "path to the issuance log")
+
+	// Add subcommands
+	caCmd.AddCommand(newCARolloverCmd())
+	caCmd.AddCommand(newCAEncryptKeyCmd())
 
 	// Add to root command
 	rootCmd.AddCommand(caCmd)
@@ -44,6 +49,12 @@ func runCACreate(cmd *cobra.Command, args []string) error {
 		fmt.Printf("Valid for: %d years\n", config.CACert.ValidForYears)
 	}
 
+	// Check the issuance log before signing anything
+	issuanceLog, err := openIssuanceLog()
+	if err != nil {
+		return err
+	}
+
 	// Create spinner
 	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
 	s.Suffix = " Creating CA certificate..."
@@ -51,7 +62,7 @@ func runCACreate(cmd *cobra.Command, args []string) error {
 	s.Start()
 
 	// Perform operation
-	err := cert.CreateCACert(config.CACert, caKey, caCert)
+	err = cert.CreateCACert(config.CACert, caKey, caCert)
 
 	// Stop spinner
 	s.Stop()
@@ -61,6 +72,11 @@ func runCACreate(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("create CA error: %w", err)
 	}
 
+	// Record the self-signed CA certificate
+	if err := recordIssuance(issuanceLog, caCert, caKey); err != nil {
+		return fmt.Errorf("issuance log error: %w", err)
+	}
+
 	printSuccess("CA created successfully!")
 	color.New(color.FgHiWhite).Printf("Key: %s\n", caKey)
 	color.New(color.FgHiWhite).Printf("Certificate: %s\n", caCert)
@@ -3,7 +3,9 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/bxtal-lsn/gotransport/internal/certlog"
 	"github.com/bxtal-lsn/gotransport/pkg/cert"
 	"github.com/spf13/cobra"
 )
@@ -27,8 +29,9 @@ func init() {
 	certCmd.Flags().StringVarP(&certKeyPath, "key-out", "k", "server.key", "destination path for certificate key")
 	certCmd.Flags().StringVarP(&certPath, "cert-out", "o", "server.crt", "destination path for certificate")
 	certCmd.Flags().StringVarP(&certName, "name", "n", "", "name of the certificate in the config file")
-	certCmd.Flags().StringVar(&caKey, "ca-key", "ca.key", "CA key path to sign certificate")
+	certCmd.Flags().StringVar(&caKey, "ca-key", "ca.key", "CA key to sign certificate (path, encfile:<path>, vault-transit://host/<mount>/<key>, gcp-kms:projects/... or pkcs11:<uri>)")
 	certCmd.Flags().StringVar(&caCert, "ca-cert", "ca.crt", "CA cert path for certificate")
+	certCmd.Flags().StringVar(&issuanceLogPath, "log", getDefaultIssuanceLogPath(), "path to the issuance log")
 
 	// Mark required flags
 	certCmd.MarkFlagRequired("name")
@@ -40,10 +43,10 @@ func init() {
 }
 
 func runCertCreate(cmd *cobra.Command, args []string) error {
-	// Read CA key
-	caKeyBytes, err := os.ReadFile(caKey)
+	// Open CA key
+	caSigner, err := openCASigner(caKey)
 	if err != nil {
-		return fmt.Errorf("CA key read error: %w", err)
+		return fmt.Errorf("CA key error: %w", err)
 	}
 
 	// Read CA cert
@@ -65,14 +68,61 @@ func runCertCreate(cmd *cobra.Command, args []string) error {
 		fmt.Printf("Valid for: %d years\n", certConfig.ValidForYears)
 	}
 
+	// Check the issuance log before signing anything
+	issuanceLog, err := openIssuanceLog()
+	if err != nil {
+		return err
+	}
+
 	// Create certificate
-	err = cert.CreateCert(certConfig, caKeyBytes, caCertBytes, certKeyPath, certPath)
+	err = cert.CreateCertWithSigner(certConfig, caSigner, caCertBytes, certKeyPath, certPath)
 	if err != nil {
 		return fmt.Errorf("create certificate error: %w", err)
 	}
 
+	// Record the issuance
+	if err := recordIssuance(issuanceLog, certPath, certKeyPath); err != nil {
+		return fmt.Errorf("issuance log error: %w", err)
+	}
+
 	fmt.Printf("Certificate '%s' created successfully!\n", certName)
 	fmt.Printf("Key: %s\n", certKeyPath)
 	fmt.Printf("Certificate: %s\n", certPath)
 	return nil
 }
+
+// recordIssuance appends the certificate at path to the issuance log. If
+// it cannot be recorded the certificate and its key at keyPath, unless
+// empty, are removed, so no unlogged certificate is left behind.
+func recordIssuance(issuanceLog *certlog.Log, path, keyPath string) error {
+	err := appendIssuance(issuanceLog, path)
+	if err == nil {
+		return nil
+	}
+
+	removed := []string{path}
+	if keyPath != "" {
+		removed = append(removed, keyPath)
+	}
+	for _, file := range removed {
+		if removeErr := os.Remove(file); removeErr != nil && !os.IsNotExist(removeErr) {
+			return fmt.Errorf("%w (and failed to remove unlogged %s: %v)", err, file, removeErr)
+		}
+	}
+	return fmt.Errorf("%w (removed unlogged %s)", err, strings.Join(removed, " and "))
+}
+
+func appendIssuance(issuanceLog *certlog.Log, path string) error {
+	certBytes, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("certificate read error: %w", err)
+	}
+
+	issued, err := cert.PemToX509(certBytes)
+	if err != nil {
+		return err
+	}
+
+	_, err = issuanceLog.Append(issued, currentRequester())
+	return err
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bxtal-lsn/gotransport/internal/certlog"
+	"github.com/bxtal-lsn/gotransport/pkg/pkitest"
+)
+
+// writeIssued writes a certificate and its key to dir and returns their paths
+func writeIssued(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	leaf := pkitest.NewCA("Test CA").Server("web.test")
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	if err := os.WriteFile(certFile, leaf.CertPEM(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, leaf.KeyPEM(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestRecordIssuance(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeIssued(t, dir)
+	issuanceLog, err := certlog.Open(filepath.Join(dir, "issuance.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := recordIssuance(issuanceLog, certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{certFile, keyFile} {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("logged file removed: %v", err)
+		}
+	}
+	if entries, err := issuanceLog.List(time.Time{}); err != nil || len(entries) != 1 {
+		t.Errorf("log has %d entries (%v), want 1", len(entries), err)
+	}
+}
+
+func TestRecordIssuanceUnwritableLog(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeIssued(t, dir)
+
+	// A directory in place of the log cannot be appended to, even as root
+	logPath := filepath.Join(dir, "issuance.log")
+	if err := os.Mkdir(logPath, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	issuanceLog, err := certlog.Open(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := recordIssuance(issuanceLog, certFile, keyFile); err == nil {
+		t.Fatal("issuance recorded in an unwritable log")
+	}
+	for _, file := range []string{certFile, keyFile} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("unlogged %s left on disk", filepath.Base(file))
+		}
+	}
+}
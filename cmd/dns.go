@@ -1,14 +1,20 @@
 package cmd
 
 import (
+	"crypto/tls"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv" // Add this
+	"strings"
+	"time"
 
 	"github.com/AlecAivazis/survey/v2" // Add this
 	"github.com/bxtal-lsn/gotransport/internal/dnsrecords"
 	"github.com/bxtal-lsn/gotransport/pkg/dns"
-	"github.com/fatih/color"            // Add this
+	gotls "github.com/bxtal-lsn/gotransport/pkg/tls"
+	"github.com/fatih/color" // Add this
+	mdns "github.com/miekg/dns"
 	"github.com/olekukonko/tablewriter" // Add this
 	"github.com/spf13/cobra"
 )
@@ -19,12 +25,48 @@ var (
 	dnsPort        int
 	dnsStoragePath string
 
+	// DNS forwarding flags
+	dnsUpstreams       []string
+	dnsForwardRules    []string
+	dnsUpstreamCA      string
+	dnsUpstreamCert    string
+	dnsUpstreamKey     string
+	dnsUpstreamTimeout time.Duration
+	dnsCacheSize       int
+
+	// DNS records file flag
+	dnsRecordsFile string
+
+	// DNS over TLS and HTTPS flags
+	dnsTLSPort    int
+	dnsHTTPSPort  int
+	dnsCert       string
+	dnsKey        string
+	dnsCA         string
+	dnsClientAuth string
+
 	// DNS record flags
 	dnsDomain   string
 	dnsType     string
 	dnsValue    string
 	dnsTTL      uint32
 	dnsInsecure bool
+
+	// DNS record data flags for types other than A, AAAA and CNAME
+	dnsPriority uint16
+	dnsWeight   uint16
+	dnsSRVPort  uint16
+	dnsText     []string
+	dnsCAATag   string
+	dnsCAAFlag  uint8
+
+	// DNS remove flags
+	dnsRemoveType string
+
+	// DNS import and export flags
+	dnsFormat  string
+	dnsOrigin  string
+	dnsReplace bool
 )
 
 // Keep your existing init function unchanged
@@ -40,23 +82,57 @@ func init() {
 	dnsServeCmd := &cobra.Command{
 		Use:   "serve",
 		Short: "Start DNS server",
-		Long:  `Start a DNS server that responds to requests for configured domains`,
-		RunE:  runDNSServe,
+		Long: `Start a DNS server that responds to requests for configured domains.
+
+With --upstream, queries for names without local records are forwarded, so the
+server can act as the only resolver of a machine. Upstreams are tried in order,
+skipping those that stopped answering until a health check sees them recover.
+They take the forms 1.1.1.1, tcp://1.1.1.1 and tls://1.1.1.1#cloudflare-dns.com
+for DNS over TLS, where #name is the server name to verify. --forward sends a
+zone to its own upstreams instead.
+
+--records serves a read-only YAML file in the format of dns.yaml instead of
+the storage, so the records can live in version control. The file is checked
+at startup and reloaded when it changes; a file that fails to load is reported
+and the previous records stay in use. Passing --storage as well layers the two:
+a name with records in the file is answered from the file only.
+
+Changes to the storage by dns add, dns remove or dns import in another process
+are picked up while the server runs. Sending SIGHUP reloads all records.
+
+--tls-port and --https-port add DNS over TLS and DNS over HTTPS (at /dns-query)
+listeners, using --cert and --key, for example a certificate issued by
+gotransport cert. With --client-auth, clients must present a certificate
+issued by --ca.`,
+		Example: `  gotransport dns serve --upstream 1.1.1.1 --upstream 8.8.8.8
+  gotransport dns serve --upstream tls://1.1.1.1#cloudflare-dns.com --forward corp.example=10.0.0.53
+  gotransport dns serve --tls-port 853 --https-port 443 --cert dns.crt --key dns.key
+  gotransport dns serve --records dns.yaml`,
+		RunE: runDNSServe,
 	}
 
 	// DNS add command
 	dnsAddCmd := &cobra.Command{
 		Use:   "add",
 		Short: "Add DNS record",
-		Long:  `Add a new DNS record to the storage`,
-		RunE:  runDNSAdd,
+		Long: `Add a DNS record to the storage. Records with the same domain and type form
+a set; add the command once per value to serve several addresses round-robin.
+
+--value holds the address for A and AAAA, the target name for CNAME, MX, SRV,
+PTR and NS, and the property value for CAA. TXT records take --text, which can
+be repeated for several strings. Without either, the value is prompted for.`,
+		Example: `  gotransport dns add -d example.local -t MX --value mail.example.local --priority 10
+  gotransport dns add -d _https._tcp.example.local -t SRV --value web.example.local --port 443 --priority 10 --weight 5
+  gotransport dns add -d example.local -t TXT --text "v=spf1 -all"
+  gotransport dns add -d example.local -t CAA --caa-tag issue --value "ca.example.local"`,
+		RunE: runDNSAdd,
 	}
 
 	// DNS list command
 	dnsListCmd := &cobra.Command{
 		Use:   "list",
 		Short: "List DNS records",
-		Long:  `List all DNS records in the storage`,
+		Long:  `List all DNS records in the storage, grouped by record set`,
 		RunE:  runDNSList,
 	}
 
@@ -64,8 +140,42 @@ func init() {
 	dnsRemoveCmd := &cobra.Command{
 		Use:   "remove",
 		Short: "Remove DNS record",
-		Long:  `Remove a DNS record from the storage`,
-		RunE:  runDNSRemove,
+		Long: `Remove DNS records from the storage. Without --type every record at the
+domain is removed, without --value the whole record set of that type.`,
+		RunE: runDNSRemove,
+	}
+
+	// DNS import command
+	dnsImportCmd := &cobra.Command{
+		Use:   "import FILE",
+		Short: "Import DNS records from a zone or YAML file",
+		Long: `Import DNS records from an RFC 1035 zone file, as used by BIND, or from the
+YAML format of dns.yaml. Files ending in .yaml or .yml are read as YAML unless
+--format says otherwise.
+
+Zone files may use $ORIGIN and $TTL. Relative names are completed with
+--origin until the file sets $ORIGIN. Records of unsupported types, such as
+the SOA, are skipped with a warning.
+
+Imported records are merged into the existing ones, or replace them all with
+--replace. Nothing is changed if any record is invalid.`,
+		Example: `  gotransport dns import dev.zone --origin dev.local
+  gotransport dns import dns.yaml --replace`,
+		Args: cobra.ExactArgs(1),
+		RunE: runDNSImport,
+	}
+
+	// DNS export command
+	dnsExportCmd := &cobra.Command{
+		Use:   "export [FILE]",
+		Short: "Export DNS records to a zone or YAML file",
+		Long: `Export all DNS records as an RFC 1035 zone file or in the YAML format of
+dns.yaml, to FILE or standard output. With --origin, names in a zone file are
+written relative to it.`,
+		Example: `  gotransport dns export dev.zone --origin dev.local
+  gotransport dns export --format yaml > dns.yaml`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runDNSExport,
 	}
 
 	// Add your existing flags here...
@@ -73,30 +183,62 @@ func init() {
 	dnsServeCmd.Flags().StringVarP(&dnsAddress, "address", "a", "0.0.0.0", "address to listen on")
 	dnsServeCmd.Flags().IntVarP(&dnsPort, "port", "p", 53, "port to listen on")
 	dnsServeCmd.Flags().StringVarP(&dnsStoragePath, "storage", "s", getDefaultStoragePath(), "path to DNS records storage file")
+	dnsServeCmd.Flags().StringVar(&dnsRecordsFile, "records", "", "read-only YAML records file to serve, reloaded on change")
 	dnsServeCmd.Flags().BoolVar(&dnsInsecure, "insecure", false, "run server on non-privileged port (5353) without root")
+	dnsServeCmd.Flags().StringArrayVar(&dnsUpstreams, "upstream", nil, "resolver for names without local records, repeat for failover")
+	dnsServeCmd.Flags().StringArrayVar(&dnsForwardRules, "forward", nil, "forward a zone to its own resolvers, as zone=upstream[,upstream]")
+	dnsServeCmd.Flags().StringVar(&dnsUpstreamCA, "upstream-ca", "", "CA to verify DNS over TLS upstreams (defaults to the system roots)")
+	dnsServeCmd.Flags().StringVar(&dnsUpstreamCert, "upstream-cert", "", "client certificate presented to DNS over TLS upstreams")
+	dnsServeCmd.Flags().StringVar(&dnsUpstreamKey, "upstream-key", "", "client key presented to DNS over TLS upstreams")
+	dnsServeCmd.Flags().DurationVar(&dnsUpstreamTimeout, "upstream-timeout", dns.DefaultForwardTimeout, "timeout for each upstream query")
+	dnsServeCmd.Flags().IntVar(&dnsCacheSize, "cache-size", dns.DefaultCacheSize, "number of upstream responses to cache (0 disables the cache)")
+	dnsServeCmd.Flags().IntVar(&dnsTLSPort, "tls-port", 0, "port for DNS over TLS, usually 853 (0 disables)")
+	dnsServeCmd.Flags().IntVar(&dnsHTTPSPort, "https-port", 0, "port for DNS over HTTPS, usually 443 (0 disables)")
+	dnsServeCmd.Flags().StringVar(&dnsCert, "cert", "server.crt", "server certificate for DNS over TLS and HTTPS")
+	dnsServeCmd.Flags().StringVar(&dnsKey, "key", "server.key", "server key for DNS over TLS and HTTPS")
+	dnsServeCmd.Flags().StringVar(&dnsCA, "ca", "ca.crt", "CA that issues client certificates")
+	dnsServeCmd.Flags().StringVar(&dnsClientAuth, "client-auth", "none", "client certificate policy for DNS over TLS and HTTPS: none, request or require")
 
 	// Add flags to DNS add command
 	dnsAddCmd.Flags().StringVarP(&dnsDomain, "domain", "d", "", "domain name")
-	dnsAddCmd.Flags().StringVarP(&dnsType, "type", "t", "A", "record type (A or CNAME)")
-	dnsAddCmd.Flags().StringVar(&dnsValue, "value", "", "record value (IP address for A, domain for CNAME)")
+	dnsAddCmd.Flags().StringVarP(&dnsType, "type", "t", "A", "record type (A, AAAA, CNAME, TXT, MX, SRV, PTR, CAA or NS)")
+	dnsAddCmd.Flags().StringVar(&dnsValue, "value", "", "record value (address, target name, or CAA value)")
+	dnsAddCmd.Flags().Uint16Var(&dnsPriority, "priority", 0, "MX preference or SRV priority")
+	dnsAddCmd.Flags().Uint16Var(&dnsWeight, "weight", 0, "SRV weight")
+	dnsAddCmd.Flags().Uint16Var(&dnsSRVPort, "port", 0, "SRV port")
+	dnsAddCmd.Flags().StringArrayVar(&dnsText, "text", nil, "TXT string, repeat for several strings")
+	dnsAddCmd.Flags().StringVar(&dnsCAATag, "caa-tag", "issue", "CAA property tag (issue, issuewild or iodef)")
+	dnsAddCmd.Flags().Uint8Var(&dnsCAAFlag, "caa-flag", 0, "CAA flags (128 marks the property critical)")
 	dnsAddCmd.Flags().Uint32Var(&dnsTTL, "ttl", 3600, "record time to live in seconds")
 	dnsAddCmd.Flags().StringVarP(&dnsStoragePath, "storage", "s", getDefaultStoragePath(), "path to DNS records storage file")
 	dnsAddCmd.MarkFlagRequired("domain")
-	dnsAddCmd.MarkFlagRequired("value")
 
 	// Add flags to DNS list command
 	dnsListCmd.Flags().StringVarP(&dnsStoragePath, "storage", "s", getDefaultStoragePath(), "path to DNS records storage file")
 
 	// Add flags to DNS remove command
 	dnsRemoveCmd.Flags().StringVarP(&dnsDomain, "domain", "d", "", "domain name")
+	dnsRemoveCmd.Flags().StringVarP(&dnsRemoveType, "type", "t", "", "record type to remove (default all types)")
+	dnsRemoveCmd.Flags().StringVar(&dnsValue, "value", "", "record value or, for TXT, text to remove (default the whole record set)")
 	dnsRemoveCmd.Flags().StringVarP(&dnsStoragePath, "storage", "s", getDefaultStoragePath(), "path to DNS records storage file")
 	dnsRemoveCmd.MarkFlagRequired("domain")
 
+	// Add flags to DNS import and export commands
+	dnsImportCmd.Flags().StringVarP(&dnsFormat, "format", "f", "", "file format: zone or yaml (default from the file extension)")
+	dnsImportCmd.Flags().StringVar(&dnsOrigin, "origin", "", "origin for relative names in a zone file")
+	dnsImportCmd.Flags().BoolVar(&dnsReplace, "replace", false, "replace all existing records instead of merging")
+	dnsImportCmd.Flags().StringVarP(&dnsStoragePath, "storage", "s", getDefaultStoragePath(), "path to DNS records storage file")
+	dnsExportCmd.Flags().StringVarP(&dnsFormat, "format", "f", "", "file format: zone or yaml (default from the file extension, zone for standard output)")
+	dnsExportCmd.Flags().StringVar(&dnsOrigin, "origin", "", "write names in a zone file relative to this origin")
+	dnsExportCmd.Flags().StringVarP(&dnsStoragePath, "storage", "s", getDefaultStoragePath(), "path to DNS records storage file")
+
 	// Add commands to DNS command
 	dnsCmd.AddCommand(dnsServeCmd)
 	dnsCmd.AddCommand(dnsAddCmd)
 	dnsCmd.AddCommand(dnsListCmd)
 	dnsCmd.AddCommand(dnsRemoveCmd)
+	dnsCmd.AddCommand(dnsImportCmd)
+	dnsCmd.AddCommand(dnsExportCmd)
 
 	// Add DNS command to root command
 	rootCmd.AddCommand(dnsCmd)
@@ -115,21 +257,127 @@ func runDNSServe(cmd *cobra.Command, args []string) error {
 		fmt.Println("Running in insecure mode on port 5353")
 	}
 
-	// Check if running as root when using privileged port
-	if dnsPort < 1024 && os.Getuid() != 0 {
-		return fmt.Errorf("must run as root to bind to port %d. Try using --insecure flag or sudo", dnsPort)
+	// Check if running as root when using privileged ports
+	for _, port := range []int{dnsPort, dnsTLSPort, dnsHTTPSPort} {
+		if port > 0 && port < 1024 && os.Getuid() != 0 {
+			return fmt.Errorf("must run as root to bind to port %d. Try using --insecure flag or sudo", port)
+		}
+	}
+
+	// A records file replaces the storage unless --storage asks for both
+	storagePath := dnsStoragePath
+	if dnsRecordsFile != "" && !cmd.Flags().Changed("storage") {
+		storagePath = ""
 	}
 
 	// Create DNS server
-	server, err := dns.NewServer(dnsAddress, dnsPort, dnsStoragePath)
+	server, err := dns.NewServer(dnsAddress, dnsPort, storagePath)
 	if err != nil {
 		return err
 	}
 
+	// Pick up records changed by dns add and friends while serving
+	if server.Storage != nil {
+		watcher := dns.NewStorageWatcher(server.Storage, 0)
+		watcher.Start()
+		defer watcher.Stop()
+	}
+
+	// Serve the records file, validated before the server starts
+	if dnsRecordsFile != "" {
+		recordsFile, err := dns.LoadRecordsFile(dnsRecordsFile, 0)
+		if err != nil {
+			return err
+		}
+		recordsFile.Start()
+		defer recordsFile.Stop()
+		server.RecordsFile = recordsFile
+
+		if storagePath != "" {
+			printInfo("Serving records from %s, layered over %s", dnsRecordsFile, storagePath)
+		} else {
+			printInfo("Serving records from %s", dnsRecordsFile)
+		}
+	}
+
+	// Encrypted listeners
+	if dnsTLSPort > 0 || dnsHTTPSPort > 0 {
+		clientAuth, ok := clientAuthModes[dnsClientAuth]
+		if !ok {
+			return fmt.Errorf("invalid --client-auth %q (use none, request or require)", dnsClientAuth)
+		}
+		server.TLS = gotls.Config{
+			CertPath:   dnsCert,
+			KeyPath:    dnsKey,
+			ClientAuth: clientAuth,
+		}
+		if clientAuth != tls.NoClientCert {
+			server.TLS.CAPath = dnsCA
+		}
+		server.TLSPort = dnsTLSPort
+		server.HTTPSPort = dnsHTTPSPort
+	}
+
+	// Forward names without local records
+	if len(dnsUpstreams) > 0 || len(dnsForwardRules) > 0 {
+		forwarder, err := newDNSForwarder()
+		if err != nil {
+			return err
+		}
+		forwarder.Start()
+		defer forwarder.Stop()
+		server.Forwarder = forwarder
+	}
+
 	// Start server and handle signals
 	return server.StartWithSignalHandling()
 }
 
+// newDNSForwarder builds the forwarder from the serve flags
+func newDNSForwarder() (*dns.Forwarder, error) {
+	tlsConfig := gotls.Config{
+		CAPath:   dnsUpstreamCA,
+		CertPath: dnsUpstreamCert,
+		KeyPath:  dnsUpstreamKey,
+	}
+	parse := func(addresses []string) ([]*dns.Upstream, error) {
+		upstreams := make([]*dns.Upstream, 0, len(addresses))
+		for _, address := range addresses {
+			upstream, err := dns.ParseUpstream(strings.TrimSpace(address), tlsConfig, dnsUpstreamTimeout)
+			if err != nil {
+				return nil, err
+			}
+			upstreams = append(upstreams, upstream)
+		}
+		return upstreams, nil
+	}
+
+	opts := dns.ForwarderOptions{CacheSize: dnsCacheSize}
+	upstreams, err := parse(dnsUpstreams)
+	if err != nil {
+		return nil, err
+	}
+	opts.Upstreams = upstreams
+
+	for _, rule := range dnsForwardRules {
+		zone, addresses, ok := strings.Cut(rule, "=")
+		if !ok || zone == "" || addresses == "" {
+			return nil, fmt.Errorf("invalid --forward %q, use zone=upstream[,upstream]", rule)
+		}
+		upstreams, err := parse(strings.Split(addresses, ","))
+		if err != nil {
+			return nil, err
+		}
+		opts.Rules = append(opts.Rules, dns.ForwardRule{Zone: zone, Upstreams: upstreams})
+		printInfo("Forwarding %s to %s", zone, addresses)
+	}
+	if len(dnsUpstreams) > 0 {
+		printInfo("Forwarding other names to %s", strings.Join(dnsUpstreams, ", "))
+	}
+
+	return dns.NewForwarder(opts)
+}
+
 // Function to handle DNS remove command
 func runDNSRemove(cmd *cobra.Command, args []string) error {
 	// Create storage
@@ -139,11 +387,12 @@ func runDNSRemove(cmd *cobra.Command, args []string) error {
 	}
 
 	// Remove record
-	if err := storage.Remove(dnsDomain); err != nil {
+	recordType := dnsrecords.RecordType(strings.ToUpper(dnsRemoveType))
+	if err := storage.Remove(dnsDomain, recordType, dnsValue); err != nil {
 		return err
 	}
 
-	fmt.Printf("Removed DNS record: %s\n", dnsDomain)
+	fmt.Printf("Removed DNS record: %s\n", strings.TrimSpace(strings.Join([]string{dnsDomain, string(recordType), dnsValue}, " ")))
 	return nil
 }
 
@@ -155,10 +404,10 @@ func runDNSList(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	// List records
-	records := storage.List()
+	// List record sets
+	sets := storage.Sets()
 
-	if len(records) == 0 {
+	if len(sets) == 0 {
 		color.Yellow("No DNS records found")
 		return nil
 	}
@@ -167,9 +416,10 @@ func runDNSList(cmd *cobra.Command, args []string) error {
 	color.Cyan("DNS Records:")
 
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Domain", "Type", "Value", "TTL"})
+	table.SetHeader([]string{"Domain", "Type", "Values", "TTL"})
 	table.SetAutoWrapText(false)
 	table.SetAutoFormatHeaders(true)
+	table.SetRowLine(true)
 	table.SetHeaderColor(
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgHiCyanColor},
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgHiCyanColor},
@@ -183,12 +433,17 @@ func runDNSList(cmd *cobra.Command, args []string) error {
 		tablewriter.Colors{tablewriter.FgHiWhiteColor},
 	)
 
-	for _, record := range records {
+	// One row per set, one value per line
+	for _, set := range sets {
+		values := make([]string, 0, len(set.Records))
+		for _, record := range set.Records {
+			values = append(values, record.Data())
+		}
 		table.Append([]string{
-			record.Domain,
-			string(record.Type),
-			record.Value,
-			fmt.Sprintf("%d", record.TTL),
+			set.Domain,
+			string(set.Type),
+			strings.Join(values, "\n"),
+			fmt.Sprintf("%d", set.TTL),
 		})
 	}
 
@@ -212,7 +467,7 @@ func runDNSAdd(cmd *cobra.Command, args []string) error {
 	if dnsType == "" {
 		prompt := &survey.Select{
 			Message: "Record type:",
-			Options: []string{"A", "CNAME"},
+			Options: recordTypeNames(),
 			Default: "A",
 		}
 		if err := survey.AskOne(prompt, &dnsType); err != nil {
@@ -220,11 +475,12 @@ func runDNSAdd(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Prompt for value
-	if dnsValue == "" {
+	// Prompt for value, TXT records given with --text need none
+	recordType := dnsrecords.RecordType(strings.ToUpper(dnsType))
+	if dnsValue == "" && !(recordType == dnsrecords.TXT && len(dnsText) > 0) {
 		prompt := &survey.Input{
 			Message: fmt.Sprintf("Value for %s record:", dnsType),
-			Help:    "IP address for A record, domain name for CNAME",
+			Help:    "IPv4 address for A, IPv6 address for AAAA, text for TXT, CAA property value, target domain name for the other types",
 		}
 		if err := survey.AskOne(prompt, &dnsValue); err != nil {
 			return err
@@ -248,10 +504,29 @@ func runDNSAdd(cmd *cobra.Command, args []string) error {
 		dnsTTL = uint32(parsedTTL)
 	}
 
+	record := dnsrecords.Record{
+		Domain:   dnsDomain,
+		Type:     recordType,
+		Value:    dnsValue,
+		TTL:      dnsTTL,
+		Text:     dnsText,
+		Priority: dnsPriority,
+		Weight:   dnsWeight,
+		Port:     dnsSRVPort,
+	}
+	if recordType == dnsrecords.CAA {
+		record.Flag = dnsCAAFlag
+		record.Tag = dnsCAATag
+	}
+	if recordType == dnsrecords.TXT && len(dnsText) == 0 {
+		record.Text = []string{dnsValue}
+		record.Value = ""
+	}
+
 	// Confirm before adding
 	var confirm bool
 	confirmPrompt := &survey.Confirm{
-		Message: fmt.Sprintf("Add DNS record %s -> %s (%s)?", dnsDomain, dnsValue, dnsType),
+		Message: fmt.Sprintf("Add DNS record %s -> %s (%s)?", dnsDomain, record.Data(), recordType),
 		Default: true,
 	}
 	if err := survey.AskOne(confirmPrompt, &confirm); err != nil {
@@ -268,14 +543,124 @@ func runDNSAdd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	recordType := dnsrecords.RecordType(dnsType)
-	if err := storage.Add(dnsDomain, recordType, dnsValue, dnsTTL); err != nil {
+	if err := storage.AddRecord(record); err != nil {
+		return err
+	}
+
+	printSuccess("Added DNS record: %s -> %s (%s)", dnsDomain, record.Data(), recordType)
+	return nil
+}
+
+func runDNSImport(cmd *cobra.Command, args []string) error {
+	format, err := recordFileFormat(args[0])
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", args[0], err)
+	}
+	defer file.Close()
+
+	// Read the records
+	var records []dnsrecords.Record
+	if format == "yaml" {
+		records, err = dnsrecords.ParseYAML(file)
+	} else {
+		var skipped []mdns.RR
+		records, skipped, err = dnsrecords.ParseZone(file, dnsOrigin, args[0])
+		for _, rr := range skipped {
+			printWarning("Skipping unsupported %s record at %s", mdns.TypeToString[rr.Header().Rrtype], rr.Header().Name)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Store them
+	storage, err := dnsrecords.NewStorage(dnsStoragePath)
+	if err != nil {
+		return err
+	}
+	if err := storage.Import(records, dnsReplace); err != nil {
+		return fmt.Errorf("import failed, no records changed: %w", err)
+	}
+
+	if dnsReplace {
+		printSuccess("Replaced DNS records with %d records from %s", len(records), args[0])
+	} else {
+		printSuccess("Imported %d DNS records from %s", len(records), args[0])
+	}
+	return nil
+}
+
+func runDNSExport(cmd *cobra.Command, args []string) error {
+	path := ""
+	if len(args) > 0 {
+		path = args[0]
+	}
+	format, err := recordFileFormat(path)
+	if err != nil {
 		return err
 	}
 
-	printSuccess("Added DNS record: %s -> %s (%s)", dnsDomain, dnsValue, dnsType)
+	storage, err := dnsrecords.NewStorage(dnsStoragePath)
+	if err != nil {
+		return err
+	}
+	records := storage.List()
+
+	// Write to the file or standard output
+	out := os.Stdout
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", path, err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if format == "yaml" {
+		err = dnsrecords.WriteYAML(out, records)
+	} else {
+		err = dnsrecords.WriteZone(out, records, dnsOrigin)
+	}
+	if err != nil {
+		return err
+	}
+
+	if path != "" {
+		printSuccess("Exported %d DNS records to %s", len(records), path)
+	}
 	return nil
 }
 
+// recordFileFormat returns the --format value, or the format matching the
+// extension of path
+func recordFileFormat(path string) (string, error) {
+	switch strings.ToLower(dnsFormat) {
+	case "zone", "yaml":
+		return strings.ToLower(dnsFormat), nil
+	case "":
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml":
+			return "yaml", nil
+		}
+		return "zone", nil
+	}
+	return "", fmt.Errorf("invalid --format %q (use zone or yaml)", dnsFormat)
+}
+
+// recordTypeNames returns the supported record types for prompts
+func recordTypeNames() []string {
+	names := make([]string, 0, len(dnsrecords.RecordTypes))
+	for _, recordType := range dnsrecords.RecordTypes {
+		names = append(names, string(recordType))
+	}
+	return names
+}
+
 // Add the runDNSRemove function if needed
 
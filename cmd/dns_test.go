@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bxtal-lsn/gotransport/internal/dnsrecords"
+)
+
+// storedRecords returns the records in the storage at path as sorted
+// "<domain> <type> <ttl> <data>" lines
+func storedRecords(t *testing.T, path string) []string {
+	t.Helper()
+	storage, err := dnsrecords.NewStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, record := range storage.List() {
+		lines = append(lines, fmt.Sprintf("%s %s %d %s", record.Domain, record.Type, record.TTL, record.Data()))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestDNSImport(t *testing.T) {
+	defer func(path, format, origin string, replace bool) {
+		dnsStoragePath, dnsFormat, dnsOrigin, dnsReplace = path, format, origin, replace
+	}(dnsStoragePath, dnsFormat, dnsOrigin, dnsReplace)
+
+	existing := []string{
+		"old.example.test. A 60 10.0.0.9",
+		"www.example.test. A 60 10.0.0.1",
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		format  string
+		origin  string
+		replace bool
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "yaml merge",
+			file: "records.yaml",
+			data: "records:\n  - domain: www.example.test\n    type: A\n    value: 10.0.0.2\n    ttl: 60\n  - domain: nocache.example.test\n    type: A\n    value: 10.0.0.3\n    ttl: 0\n",
+			want: []string{
+				"nocache.example.test. A 0 10.0.0.3",
+				"old.example.test. A 60 10.0.0.9",
+				"www.example.test. A 60 10.0.0.1",
+				"www.example.test. A 60 10.0.0.2",
+			},
+		},
+		{
+			name:    "yaml replace",
+			file:    "records.yml",
+			data:    "records:\n  - domain: www.example.test\n    type: A\n    value: 10.0.0.2\n",
+			replace: true,
+			want:    []string{"www.example.test. A 3600 10.0.0.2"},
+		},
+		{
+			name:   "zone merge with origin",
+			file:   "example.zone",
+			data:   "@ IN MX 10 mail\nwww 60 IN A 10.0.0.2\n",
+			origin: "example.test",
+			want: []string{
+				"example.test. MX 3600 10 mail.example.test.",
+				"old.example.test. A 60 10.0.0.9",
+				"www.example.test. A 60 10.0.0.1",
+				"www.example.test. A 60 10.0.0.2",
+			},
+		},
+		{
+			name:    "zone replace",
+			file:    "example.db",
+			data:    "$ORIGIN example.test.\n$TTL 300\n@ IN SOA ns admin 1 3600 600 86400 300\ntxt IN TXT \"a\" \"b\"\n",
+			replace: true,
+			want:    []string{`txt.example.test. TXT 300 "a" "b"`},
+		},
+		{
+			name:   "format flag",
+			file:   "records.txt",
+			data:   "records:\n  - domain: new.example.test\n    type: A\n    value: 10.0.0.4\n    ttl: 60\n",
+			format: "yaml",
+			want:   append([]string{"new.example.test. A 60 10.0.0.4"}, existing...),
+		},
+		{
+			name:    "invalid record leaves storage unchanged",
+			file:    "records.yaml",
+			data:    "records:\n  - domain: new.example.test\n    type: A\n    value: 10.0.0.4\n  - domain: www.example.test\n    type: CNAME\n    value: other.test\n",
+			want:    existing,
+			wantErr: "no records changed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			dnsStoragePath = filepath.Join(dir, "dns.json")
+			dnsFormat, dnsOrigin, dnsReplace = tt.format, tt.origin, tt.replace
+
+			storage, err := dnsrecords.NewStorage(dnsStoragePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := storage.Add("old.example.test", dnsrecords.A, "10.0.0.9", 60); err != nil {
+				t.Fatal(err)
+			}
+			if err := storage.Add("www.example.test", dnsrecords.A, "10.0.0.1", 60); err != nil {
+				t.Fatal(err)
+			}
+
+			file := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(file, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			err = runDNSImport(nil, []string{file})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := storedRecords(t, dnsStoragePath); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("records = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDNSExportImport(t *testing.T) {
+	defer func(path, format, origin string, replace bool) {
+		dnsStoragePath, dnsFormat, dnsOrigin, dnsReplace = path, format, origin, replace
+	}(dnsStoragePath, dnsFormat, dnsOrigin, dnsReplace)
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "dns.json")
+	storage, err := dnsrecords.NewStorage(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range []dnsrecords.Record{
+		{Domain: "www.example.test", Type: dnsrecords.A, Value: "10.0.0.1", TTL: 0},
+		{Domain: "www.other.test", Type: dnsrecords.AAAA, Value: "fd00::1", TTL: 60},
+		{Domain: "txt.example.test", Type: dnsrecords.TXT, Text: []string{"first", "second"}, TTL: 300},
+		{Domain: "_sip._tcp.example.test", Type: dnsrecords.SRV, Value: "sip.example.test", Priority: 10, Weight: 20, Port: 5060, TTL: 300},
+		{Domain: "example.test", Type: dnsrecords.CAA, Value: "ca.example", Tag: "issue", TTL: 300},
+	} {
+		if err := storage.AddRecord(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := storedRecords(t, source)
+
+	// Both formats carry every field, including a zero TTL
+	for _, file := range []string{"export.zone", "export.yaml"} {
+		t.Run(file, func(t *testing.T) {
+			path := filepath.Join(dir, file)
+			dnsStoragePath, dnsFormat, dnsOrigin, dnsReplace = source, "", "example.test", false
+			if err := runDNSExport(nil, []string{path}); err != nil {
+				t.Fatal(err)
+			}
+
+			dnsStoragePath, dnsReplace = filepath.Join(t.TempDir(), "dns.json"), true
+			if err := runDNSImport(nil, []string{path}); err != nil {
+				t.Fatal(err)
+			}
+			if got := storedRecords(t, dnsStoragePath); !reflect.DeepEqual(got, want) {
+				t.Errorf("records = %q, want %q", got, want)
+			}
+		})
+	}
+}
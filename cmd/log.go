@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/bxtal-lsn/gotransport/internal/certlog"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var (
+	issuanceLogPath string
+	logSince        string
+	logExpectHead   string
+	logExpectCount  int
+)
+
+func init() {
+	// Main log command
+	logCmd := &cobra.Command{
+		Use:   "log",
+		Short: "Certificate issuance log commands",
+		Long:  `Inspect and verify the append-only log of certificates issued by the CA`,
+	}
+
+	// Log list command
+	logListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List issued certificates",
+		Long:  `List the certificates recorded in the issuance log`,
+		RunE:  runLogList,
+	}
+
+	// Log verify command
+	logVerifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the issuance log",
+		Long: `Check the hash chain of the issuance log for tampering or missing entries.
+
+The chain shows edited, removed or reordered entries, but not entries cut off
+from the end or a log rewritten from scratch. Keep the count and head printed
+by a successful verify somewhere safe and pass them back with --expect-count
+and --expect-head; the log may have grown since, but those entries must still
+be there unchanged.`,
+		Example: `  gotransport log verify
+  gotransport log verify --expect-count 42 --expect-head 3f1c...`,
+		RunE: runLogVerify,
+	}
+
+	// Add flags
+	logCmd.PersistentFlags().StringVarP(&issuanceLogPath, "log", "l", getDefaultIssuanceLogPath(), "path to the issuance log")
+	logVerifyCmd.Flags().StringVar(&logExpectHead, "expect-head", "", "hash the log head had at an earlier verify")
+	logVerifyCmd.Flags().IntVar(&logExpectCount, "expect-count", 0, "entry count at an earlier verify, the log must still hold them")
+	logListCmd.Flags().StringVar(&logSince, "since", "", "only show entries issued since this time (RFC 3339, date or duration such as 24h)")
+
+	// Add commands to log command
+	logCmd.AddCommand(logListCmd)
+	logCmd.AddCommand(logVerifyCmd)
+
+	// Add log command to root command
+	rootCmd.AddCommand(logCmd)
+}
+
+func getDefaultIssuanceLogPath() string {
+	return "issuance.log"
+}
+
+// currentRequester returns the name of the user running the command
+func currentRequester() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "unknown"
+}
+
+// parseSince accepts an RFC 3339 timestamp, a date or a duration relative to now
+func parseSince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since value %q", value)
+}
+
+func runLogList(cmd *cobra.Command, args []string) error {
+	since, err := parseSince(logSince)
+	if err != nil {
+		return err
+	}
+
+	issuanceLog, err := certlog.Open(issuanceLogPath)
+	if err != nil {
+		return err
+	}
+
+	entries, err := issuanceLog.List(since)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		color.Yellow("No issued certificates found")
+		return nil
+	}
+
+	// Display entries
+	color.Cyan("Issued Certificates:")
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"#", "Serial", "Common Name", "SHA-256", "Requester", "Issued"})
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(true)
+
+	for _, entry := range entries {
+		table.Append([]string{
+			fmt.Sprintf("%d", entry.Index),
+			entry.Serial,
+			entry.CommonName,
+			entry.CertSHA256,
+			entry.Requester,
+			entry.Timestamp.Local().Format(time.RFC3339),
+		})
+	}
+
+	table.Render()
+	return nil
+}
+
+func runLogVerify(cmd *cobra.Command, args []string) error {
+	issuanceLog, err := certlog.Open(issuanceLogPath)
+	if err != nil {
+		return err
+	}
+
+	if logExpectCount < 0 {
+		return fmt.Errorf("invalid --expect-count %d", logExpectCount)
+	}
+
+	count, head, err := issuanceLog.Verify()
+	if err == nil && (logExpectCount > 0 || logExpectHead != "") {
+		err = issuanceLog.VerifyAnchor(logExpectCount, logExpectHead)
+	}
+	if err != nil {
+		var verifyErr *certlog.VerifyError
+		if errors.As(err, &verifyErr) {
+			printError("Issuance log verification failed")
+		}
+		return err
+	}
+
+	printSuccess("Issuance log verified: %d entries", count)
+	info := color.New(color.FgHiWhite)
+	info.Printf("Head: %s\n", head)
+	info.Printf("Keep this anchor to detect truncation later: --expect-count %d --expect-head %s\n", count, head)
+	return nil
+}
+
+// openIssuanceLog opens the issuance log and checks it can be appended to.
+// Commands issuing certificates call it before signing, so a broken or
+// unwritable log stops them before an unlogged certificate exists.
+func openIssuanceLog() (*certlog.Log, error) {
+	issuanceLog, err := certlog.Open(issuanceLogPath)
+	if err != nil {
+		return nil, fmt.Errorf("issuance log error: %w", err)
+	}
+	if err := issuanceLog.Writable(); err != nil {
+		return nil, fmt.Errorf("issuance log error: %w", err)
+	}
+	return issuanceLog, nil
+}
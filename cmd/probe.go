@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bxtal-lsn/gotransport/internal/probe"
+	gotls "github.com/bxtal-lsn/gotransport/pkg/tls"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var (
+	probeSNI        string
+	probeCA         []string
+	probeClientCert string
+	probeClientKey  string
+	probeALPN       []string
+	probeTimeout    time.Duration
+	probeScan       bool
+)
+
+func init() {
+	// Create command
+	probeCmd := &cobra.Command{
+		Use:   "probe host:port",
+		Short: "Diagnose a TLS endpoint",
+		Long: `Connect to a TLS endpoint and report the negotiated version, cipher and ALPN
+protocol, the presented certificate chain, the stapled OCSP response, whether
+the server asks for a client certificate, and why verification failed.`,
+		Example: `  gotransport probe harbor.local:443 --ca ca.crt
+  gotransport probe 10.0.0.5:8443 --sni api.local --ca ca.crt --client-cert client.crt --client-key client.key
+  gotransport probe example.com:443 --scan`,
+		Args: cobra.ExactArgs(1),
+		RunE: runProbe,
+	}
+
+	// Add flags
+	probeCmd.Flags().StringVar(&probeSNI, "sni", "", "server name to send and verify (defaults to the host)")
+	probeCmd.Flags().StringSliceVar(&probeCA, "ca", nil, "CA files or directories to verify against (defaults to the system roots)")
+	probeCmd.Flags().StringVar(&probeClientCert, "client-cert", "", "client certificate to present")
+	probeCmd.Flags().StringVar(&probeClientKey, "client-key", "", "client key (defaults to the certificate path with a .key extension)")
+	probeCmd.Flags().StringSliceVar(&probeALPN, "alpn", []string{"h2", "http/1.1"}, "ALPN protocols to offer")
+	probeCmd.Flags().DurationVar(&probeTimeout, "timeout", probe.DefaultTimeout, "timeout for each connection")
+	probeCmd.Flags().BoolVar(&probeScan, "scan", false, "also scan the supported protocol versions and cipher suites")
+
+	// Add to root command
+	rootCmd.AddCommand(probeCmd)
+}
+
+func runProbe(cmd *cobra.Command, args []string) error {
+	opts := probe.Options{
+		Address: args[0],
+		TLS: gotls.Config{
+			ServerName: probeSNI,
+			CAPaths:    probeCA,
+		},
+		NextProtos: probeALPN,
+		Timeout:    probeTimeout,
+	}
+	if probeClientCert != "" {
+		opts.TLS.CertPath = probeClientCert
+		opts.TLS.KeyPath = probeClientKey
+		if opts.TLS.KeyPath == "" {
+			opts.TLS.KeyPath = strings.TrimSuffix(probeClientCert, ".crt") + ".key"
+		}
+	}
+
+	result, err := probe.Probe(opts)
+	if err != nil {
+		return err
+	}
+
+	printProbeResult(args[0], result)
+
+	if probeScan {
+		if err := printProbeScan(opts); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case result.HandshakeErr != nil:
+		return fmt.Errorf("handshake failed")
+	case result.ClientCertErr != nil:
+		return fmt.Errorf("client certificate rejected")
+	case result.VerifyErr != nil:
+		return fmt.Errorf("verification failed")
+	}
+	return nil
+}
+
+func printProbeResult(addr string, result *probe.Result) {
+	titleStyle := color.New(color.FgHiCyan, color.Bold)
+	valueStyle := color.New(color.FgHiWhite)
+	label := func(name string) { fmt.Printf("%-20s", name) }
+
+	titleStyle.Println("Connection")
+	label("Address:")
+	valueStyle.Println(addr)
+	label("Server name:")
+	valueStyle.Println(result.ServerName)
+
+	if result.HandshakeErr != nil {
+		label("Handshake:")
+		color.Red("%v", result.HandshakeErr)
+		printClientAuth(result)
+		printHint(result.HandshakeErr)
+		return
+	}
+
+	label("Version:")
+	valueStyle.Println(tls.VersionName(result.Version))
+	label("Cipher suite:")
+	valueStyle.Println(tls.CipherSuiteName(result.CipherSuite))
+	label("ALPN:")
+	if result.ALPN == "" {
+		color.New(color.FgHiBlack).Println("none")
+	} else {
+		valueStyle.Println(result.ALPN)
+	}
+
+	// Certificate chain
+	fmt.Println()
+	titleStyle.Println("Certificate chain")
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"#", "Subject", "Issuer", "Not After", "Expires In"})
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(true)
+	for i, c := range result.Chain {
+		table.Append([]string{
+			fmt.Sprintf("%d", i),
+			c.Subject.CommonName,
+			c.Issuer.CommonName,
+			c.NotAfter.Local().Format(time.RFC3339),
+			expiresIn(c.NotAfter),
+		})
+	}
+	table.Render()
+	if len(result.Chain) > 0 && len(result.Chain[0].DNSNames) > 0 {
+		label("Leaf DNS names:")
+		valueStyle.Println(strings.Join(result.Chain[0].DNSNames, ", "))
+	}
+
+	// OCSP
+	fmt.Println()
+	titleStyle.Println("OCSP")
+	label("Stapled response:")
+	switch {
+	case result.OCSP == nil:
+		color.New(color.FgHiBlack).Println("none")
+	case result.OCSP.Err != nil:
+		color.Red("%s: %v", result.OCSP.Status, result.OCSP.Err)
+	case result.OCSP.Status == "good":
+		color.Green("good, next update %s", result.OCSP.NextUpdate.Local().Format(time.RFC3339))
+	case result.OCSP.Status == "revoked":
+		color.Red("revoked at %s", result.OCSP.RevokedAt.Local().Format(time.RFC3339))
+	default:
+		color.Yellow(result.OCSP.Status)
+	}
+
+	printClientAuth(result)
+
+	// Verification
+	fmt.Println()
+	titleStyle.Println("Verification")
+	label("Server chain:")
+	if result.VerifyErr != nil {
+		color.Red("%v", result.VerifyErr)
+		printHint(result.VerifyErr)
+	} else {
+		color.Green("trusted")
+	}
+	if result.ClientCertErr != nil {
+		label("Client cert:")
+		color.Red("%v", result.ClientCertErr)
+		printHint(result.ClientCertErr)
+	}
+}
+
+func printClientAuth(result *probe.Result) {
+	fmt.Println()
+	color.New(color.FgHiCyan, color.Bold).Println("Client authentication")
+	fmt.Printf("%-20s", "Requested:")
+	if !result.ClientCertRequested {
+		color.New(color.FgHiWhite).Println("no")
+		return
+	}
+	color.New(color.FgHiWhite).Println("yes")
+	if len(result.AcceptableCAs) == 0 {
+		printList("Accepted CAs:", []string{"any (not listed by server)"})
+	} else {
+		printList("Accepted CAs:", result.AcceptableCAs)
+	}
+	fmt.Printf("%-20s", "Sent:")
+	color.New(color.FgHiWhite).Println(yesNo(result.ClientCertSent))
+}
+
+func printProbeScan(opts probe.Options) error {
+	printInfo("Scanning protocol versions...")
+	versions, err := probe.ScanVersions(opts)
+	if err != nil {
+		return err
+	}
+	printSupportTable("Version", versions)
+
+	printInfo("Scanning TLS 1.0-1.2 cipher suites...")
+	ciphers, err := probe.ScanCiphers(opts)
+	if err != nil {
+		return err
+	}
+	printSupportTable("Cipher Suite", ciphers)
+	return nil
+}
+
+func printSupportTable(title string, results []probe.Support) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{title, "Supported"})
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(true)
+	for _, r := range results {
+		supported := color.RedString("no")
+		if r.Supported {
+			supported = color.GreenString("yes")
+		}
+		table.Append([]string{r.Name, supported})
+	}
+	table.Render()
+}
+
+// printHint prints advice for err if there is any
+func printHint(err error) {
+	if hint := probe.Hint(err); hint != "" {
+		fmt.Printf("%-20s", "")
+		color.Yellow(hint)
+	}
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// expiresIn formats the time left until t
+func expiresIn(t time.Time) string {
+	left := time.Until(t)
+	if left < 0 {
+		return color.RedString("expired %d days ago", int(-left.Hours()/24))
+	}
+	days := int(left.Hours() / 24)
+	if days < 30 {
+		return color.YellowString("%d days", days)
+	}
+	return fmt.Sprintf("%d days", days)
+}
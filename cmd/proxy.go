@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bxtal-lsn/gotransport/internal/proxy"
+	gotls "github.com/bxtal-lsn/gotransport/pkg/tls"
+	"github.com/bxtal-lsn/gotransport/pkg/tls/transport"
+	"github.com/spf13/cobra"
+)
+
+var (
+	proxyListen       string
+	proxyUpstream     string
+	proxyCert         string
+	proxyKey          string
+	proxyCA           string
+	proxyClientAuth   string
+	proxyUpstreamCA   string
+	proxyUpstreamCert string
+	proxyUpstreamKey  string
+	proxyUpstreamSNI  string
+)
+
+// clientAuthModes maps --client-auth values to crypto/tls settings
+var clientAuthModes = map[string]tls.ClientAuthType{
+	"none":    tls.NoClientCert,
+	"request": tls.VerifyClientCertIfGiven,
+	"require": tls.RequireAndVerifyClientCert,
+}
+
+func init() {
+	// Create command
+	proxyCmd := &cobra.Command{
+		Use:   "proxy",
+		Short: "Run a TLS-terminating reverse proxy",
+		Long: `Terminate TLS in front of an application and forward requests to it.
+
+With --client-auth, clients must present a certificate issued by --ca. The
+verified identity is passed upstream in these headers, which are stripped from
+incoming requests:
+
+  ` + proxy.HeaderVerified + `     SUCCESS or NONE
+  ` + proxy.HeaderCommonName + `           subject common name
+  ` + proxy.HeaderDNSNames + `          DNS subject alternative names
+  ` + proxy.HeaderURIs + `          URI subject alternative names
+  ` + proxy.HeaderSPIFFEID + `    SPIFFE ID
+  ` + proxy.HeaderSerial + `       serial number in hex
+
+An https:// upstream is reached over TLS, presenting --upstream-cert if set.
+Certificates are reloaded from disk when they change.`,
+		Example: `  gotransport proxy --listen :8443 --upstream http://127.0.0.1:8080 --client-auth require
+  gotransport proxy --upstream https://legacy.local:9443 --upstream-ca ca.crt --upstream-cert client.crt --upstream-key client.key`,
+		RunE: runProxy,
+	}
+
+	// Add flags
+	proxyCmd.Flags().StringVar(&proxyListen, "listen", ":8443", "address to listen on")
+	proxyCmd.Flags().StringVar(&proxyUpstream, "upstream", "", "upstream URL (http:// or https://)")
+	proxyCmd.Flags().StringVar(&proxyCert, "cert", "server.crt", "server certificate path")
+	proxyCmd.Flags().StringVar(&proxyKey, "key", "server.key", "server key path")
+	proxyCmd.Flags().StringVar(&proxyCA, "ca", "ca.crt", "CA that issues client certificates")
+	proxyCmd.Flags().StringVar(&proxyClientAuth, "client-auth", "none", "client certificate policy: none, request or require")
+	proxyCmd.Flags().StringVar(&proxyUpstreamCA, "upstream-ca", "", "CA to verify an https upstream (defaults to the system roots)")
+	proxyCmd.Flags().StringVar(&proxyUpstreamCert, "upstream-cert", "", "client certificate presented to an https upstream")
+	proxyCmd.Flags().StringVar(&proxyUpstreamKey, "upstream-key", "", "client key presented to an https upstream")
+	proxyCmd.Flags().StringVar(&proxyUpstreamSNI, "upstream-sni", "", "server name expected from an https upstream (defaults to its host)")
+	proxyCmd.MarkFlagRequired("upstream")
+
+	// Add to root command
+	rootCmd.AddCommand(proxyCmd)
+}
+
+func runProxy(cmd *cobra.Command, args []string) error {
+	upstream, err := url.Parse(proxyUpstream)
+	if err != nil || upstream.Host == "" {
+		return fmt.Errorf("invalid upstream URL %q", proxyUpstream)
+	}
+	if upstream.Scheme != "http" && upstream.Scheme != "https" {
+		return fmt.Errorf("upstream scheme must be http or https, got %q", upstream.Scheme)
+	}
+
+	clientAuth, ok := clientAuthModes[proxyClientAuth]
+	if !ok {
+		return fmt.Errorf("invalid --client-auth %q (use none, request or require)", proxyClientAuth)
+	}
+
+	// Connections to the upstream, over mTLS if configured
+	upstreamClient, err := transport.NewHTTPClient(gotls.Config{
+		CAPath:     proxyUpstreamCA,
+		CertPath:   proxyUpstreamCert,
+		KeyPath:    proxyUpstreamKey,
+		ServerName: proxyUpstreamSNI,
+	}, transport.ClientOptions{})
+	if err != nil {
+		return fmt.Errorf("upstream TLS error: %w", err)
+	}
+
+	// Terminating TLS, reloaded when the files are rotated
+	serverConfig := gotls.Config{
+		CertPath:   proxyCert,
+		KeyPath:    proxyKey,
+		ClientAuth: clientAuth,
+	}
+	if clientAuth != tls.NoClientCert {
+		serverConfig.CAPath = proxyCA
+	}
+
+	reloader, err := gotls.NewReloader(serverConfig, 0)
+	if err != nil {
+		return fmt.Errorf("server TLS error: %w", err)
+	}
+	reloader.Start()
+	defer reloader.Stop()
+	go logReloads(reloader)
+
+	logger := log.New(os.Stderr, "proxy: ", log.LstdFlags)
+	handler := proxy.New(upstream, upstreamClient.Transport, logger)
+
+	server, err := transport.NewHTTPServer(proxyListen, handler, serverConfig, transport.ServerOptions{Reloader: reloader})
+	if err != nil {
+		return fmt.Errorf("server TLS error: %w", err)
+	}
+	server.ErrorLog = logger
+
+	printInfo("Proxying https://%s to %s (client certificates: %s)", proxyListen, upstream, proxyClientAuth)
+	return serveUntilSignal(server)
+}
+
+// serveUntilSignal runs server until SIGINT or SIGTERM, then shuts it down
+// gracefully
+func serveUntilSignal(server *http.Server) error {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.ListenAndServeTLS("", "")
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case sig := <-sigChan:
+		fmt.Printf("Received signal: %v\n", sig)
+		fmt.Println("Shutting down proxy...")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
+
+// logReloads reports the certificate in use after every load until the
+// reloader stops
+func logReloads(reloader *gotls.Reloader) {
+	for event := range reloader.Events() {
+		if event.Err != nil {
+			printWarning("Certificate reload failed, keeping the previous one: %v", event.Err)
+			continue
+		}
+		if event.Leaf != nil {
+			printInfo("Serving certificate %s, valid until %s", event.Leaf.Subject.CommonName, event.Leaf.NotAfter.Format(time.RFC3339))
+		}
+	}
+}
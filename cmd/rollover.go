@@ -0,0 +1,371 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bxtal-lsn/gotransport/pkg/cert"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// Rollover stages, in the order they must be run
+const (
+	stagePublished = "published"
+	stageIssuing   = "issuing"
+	stageRetired   = "retired"
+)
+
+// Files written to the rollover directory
+const (
+	rolloverStateFile   = "rollover.json"
+	rolloverTrustBundle = "trust-bundle.pem"
+	rolloverFinalBundle = "trust-bundle-final.pem"
+	rolloverNewByOld    = "new-signed-by-old.crt"
+	rolloverOldByNew    = "old-signed-by-new.crt"
+	rolloverChain       = "issuing-chain.pem"
+	rolloverLegacyChain = "legacy-chain.pem"
+)
+
+var (
+	rolloverOldKey  string
+	rolloverOldCert string
+	rolloverNewKey  string
+	rolloverNewCert string
+	rolloverDir     string
+	rolloverName    string
+)
+
+// rolloverState is persisted between stages so later stages need no flags
+type rolloverState struct {
+	Stage     string    `json:"stage"`
+	OldKey    string    `json:"oldKey"`
+	OldCert   string    `json:"oldCert"`
+	NewKey    string    `json:"newKey"`
+	NewCert   string    `json:"newCert"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// newCARolloverCmd builds the "ca rollover" command tree
+func newCARolloverCmd() *cobra.Command {
+	rolloverCmd := &cobra.Command{
+		Use:   "rollover",
+		Short: "Rotate the CA without breaking clients",
+		Long: `Rotate to a new root CA in three stages:
+
+  publish  create the new root, cross-sign both roots and write a trust bundle
+           containing both, to be distributed to every client
+  issue    start issuing from the new root, serving the cross-signed chain
+  retire   drop the old root from the trust bundle
+
+The cross certificates let clients trusting only one of the roots verify
+certificates from the other. Leaves from the new root are served with
+issuing-chain.pem (the new root signed by the old one), leaves from the old
+root still in use are served with legacy-chain.pem (the old root signed by
+the new one).
+
+Without --common-name the new root takes the old root's common name with a
+generation suffix, "Example CA" becomes "Example CA G2" and "Example CA G2"
+becomes "Example CA G3", so the two roots never share a subject.`,
+	}
+
+	publishCmd := &cobra.Command{
+		Use:   "publish",
+		Short: "Create and cross-sign the new root",
+		RunE:  runRolloverPublish,
+	}
+	issueCmd := &cobra.Command{
+		Use:   "issue",
+		Short: "Switch issuance to the new root",
+		RunE:  runRolloverIssue,
+	}
+	retireCmd := &cobra.Command{
+		Use:   "retire",
+		Short: "Retire the old root",
+		RunE:  runRolloverRetire,
+	}
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the current rollover stage",
+		RunE:  runRolloverStatus,
+	}
+
+	// Add flags
+	rolloverCmd.PersistentFlags().StringVar(&rolloverDir, "dir", "rollover", "directory for rollover state, cross certificates and bundles")
+	rolloverCmd.PersistentFlags().StringVar(&issuanceLogPath, "log", getDefaultIssuanceLogPath(), "path to the issuance log")
+	publishCmd.Flags().StringVar(&rolloverOldKey, "old-key", "ca.key", "current CA key path")
+	publishCmd.Flags().StringVar(&rolloverOldCert, "old-cert", "ca.crt", "current CA certificate path")
+	publishCmd.Flags().StringVar(&rolloverNewKey, "new-key", "ca-next.key", "destination path for the new CA key")
+	publishCmd.Flags().StringVar(&rolloverNewCert, "new-cert", "ca-next.crt", "destination path for the new CA certificate")
+	publishCmd.Flags().StringVar(&rolloverName, "common-name", "", "common name for the new CA (defaults to the old name with the next generation suffix)")
+
+	rolloverCmd.AddCommand(publishCmd)
+	rolloverCmd.AddCommand(issueCmd)
+	rolloverCmd.AddCommand(retireCmd)
+	rolloverCmd.AddCommand(statusCmd)
+
+	return rolloverCmd
+}
+
+func runRolloverPublish(cmd *cobra.Command, args []string) error {
+	if state, err := loadRolloverState(); err == nil {
+		return fmt.Errorf("rollover already in stage %q (see %s)", state.Stage, filepath.Join(rolloverDir, rolloverStateFile))
+	}
+
+	if err := os.MkdirAll(rolloverDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create rollover directory: %w", err)
+	}
+
+	// Check the issuance log before signing anything
+	issuanceLog, err := openIssuanceLog()
+	if err != nil {
+		return err
+	}
+
+	oldSigner, err := openCASigner(rolloverOldKey)
+	if err != nil {
+		return fmt.Errorf("old CA key error: %w", err)
+	}
+	oldCertBytes, err := os.ReadFile(rolloverOldCert)
+	if err != nil {
+		return fmt.Errorf("old CA cert read error: %w", err)
+	}
+	oldCA, err := cert.PemToX509(oldCertBytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse old CA certificate: %w", err)
+	}
+
+	// Create the new root unless it was already generated
+	if _, err := os.Stat(rolloverNewCert); os.IsNotExist(err) {
+		if config.CACert == nil {
+			return fmt.Errorf("no CA certificate configuration found in config file")
+		}
+
+		// Roots sharing a subject confuse chain building, so the new root
+		// always gets a name of its own
+		newCA := *config.CACert
+		newCA.Subject.CommonName = rolloverName
+		if newCA.Subject.CommonName == "" {
+			newCA.Subject.CommonName = nextCAName(oldCA.Subject.CommonName)
+		}
+		if newCA.Subject.CommonName == oldCA.Subject.CommonName {
+			return fmt.Errorf("new CA common name %q is the same as the old one", newCA.Subject.CommonName)
+		}
+		if newCA.Serial == nil || newCA.Serial.Cmp(oldCA.SerialNumber) == 0 {
+			newCA.Serial = new(big.Int).Add(oldCA.SerialNumber, big.NewInt(1))
+		}
+
+		printInfo("Creating new CA certificate...")
+		if err := cert.CreateCACert(&newCA, rolloverNewKey, rolloverNewCert); err != nil {
+			return fmt.Errorf("create CA error: %w", err)
+		}
+		if err := recordIssuance(issuanceLog, rolloverNewCert, rolloverNewKey); err != nil {
+			return fmt.Errorf("issuance log error: %w", err)
+		}
+	} else {
+		printWarning("Using existing new CA certificate %s", rolloverNewCert)
+	}
+
+	newSigner, err := openCASigner(rolloverNewKey)
+	if err != nil {
+		return fmt.Errorf("new CA key error: %w", err)
+	}
+	newCertBytes, err := os.ReadFile(rolloverNewCert)
+	if err != nil {
+		return fmt.Errorf("new CA cert read error: %w", err)
+	}
+
+	// Cross-sign in both directions
+	newByOld, err := cert.CrossSignCACert(newCertBytes, oldSigner, oldCertBytes)
+	if err != nil {
+		return err
+	}
+	oldByNew, err := cert.CrossSignCACert(oldCertBytes, newSigner, newCertBytes)
+	if err != nil {
+		return err
+	}
+
+	for path, data := range map[string][]byte{
+		filepath.Join(rolloverDir, rolloverNewByOld): newByOld,
+		filepath.Join(rolloverDir, rolloverOldByNew): oldByNew,
+	} {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return fmt.Errorf("failed to write cross certificate: %w", err)
+		}
+		if err := recordIssuance(issuanceLog, path, ""); err != nil {
+			return fmt.Errorf("issuance log error: %w", err)
+		}
+	}
+
+	// Transition bundle trusting both roots
+	if err := cert.WriteBundle(filepath.Join(rolloverDir, rolloverTrustBundle), oldCertBytes, newCertBytes); err != nil {
+		return err
+	}
+
+	state := rolloverState{
+		Stage:   stagePublished,
+		OldKey:  rolloverOldKey,
+		OldCert: rolloverOldCert,
+		NewKey:  rolloverNewKey,
+		NewCert: rolloverNewCert,
+	}
+	if err := saveRolloverState(state); err != nil {
+		return err
+	}
+
+	printSuccess("Stage 1/3 complete: new root published")
+	info := color.New(color.FgHiWhite)
+	info.Printf("New CA: %s\n", rolloverNewCert)
+	info.Printf("Trust bundle: %s\n", filepath.Join(rolloverDir, rolloverTrustBundle))
+	info.Printf("Cross certificates: %s, %s\n", filepath.Join(rolloverDir, rolloverNewByOld), filepath.Join(rolloverDir, rolloverOldByNew))
+	fmt.Println("Distribute the trust bundle to every client, then run 'gotransport ca rollover issue'.")
+	return nil
+}
+
+func runRolloverIssue(cmd *cobra.Command, args []string) error {
+	state, err := requireRolloverStage(stagePublished)
+	if err != nil {
+		return err
+	}
+
+	// Servers send the new root cross-signed by the old one as an
+	// intermediate, so clients that still trust only the old root verify
+	crossCert, err := os.ReadFile(filepath.Join(rolloverDir, rolloverNewByOld))
+	if err != nil {
+		return fmt.Errorf("cross certificate read error: %w", err)
+	}
+	chainPath := filepath.Join(rolloverDir, rolloverChain)
+	if err := cert.WriteBundle(chainPath, crossCert); err != nil {
+		return err
+	}
+
+	// And certificates from the old root send the old root cross-signed by
+	// the new one, for clients given only the new root
+	legacyCert, err := os.ReadFile(filepath.Join(rolloverDir, rolloverOldByNew))
+	if err != nil {
+		return fmt.Errorf("cross certificate read error: %w", err)
+	}
+	legacyPath := filepath.Join(rolloverDir, rolloverLegacyChain)
+	if err := cert.WriteBundle(legacyPath, legacyCert); err != nil {
+		return err
+	}
+
+	state.Stage = stageIssuing
+	if err := saveRolloverState(state); err != nil {
+		return err
+	}
+
+	printSuccess("Stage 2/3 complete: issuing from the new root")
+	fmt.Println("Issue certificates with:")
+	color.New(color.FgHiWhite).Printf("  gotransport cert --name <name> --ca-key %s --ca-cert %s\n", state.NewKey, state.NewCert)
+	fmt.Printf("Append %s to each new certificate file served to clients that may not have the new root yet.\n", chainPath)
+	fmt.Printf("Append %s to certificates from the old root still in use, for clients that only have the new root.\n", legacyPath)
+	fmt.Println("Once every certificate from the old root has been replaced, run 'gotransport ca rollover retire'.")
+	return nil
+}
+
+func runRolloverRetire(cmd *cobra.Command, args []string) error {
+	state, err := requireRolloverStage(stageIssuing)
+	if err != nil {
+		return err
+	}
+
+	newCertBytes, err := os.ReadFile(state.NewCert)
+	if err != nil {
+		return fmt.Errorf("new CA cert read error: %w", err)
+	}
+	finalPath := filepath.Join(rolloverDir, rolloverFinalBundle)
+	if err := cert.WriteBundle(finalPath, newCertBytes); err != nil {
+		return err
+	}
+
+	state.Stage = stageRetired
+	if err := saveRolloverState(state); err != nil {
+		return err
+	}
+
+	printSuccess("Stage 3/3 complete: old root retired")
+	color.New(color.FgHiWhite).Printf("Final trust bundle: %s\n", finalPath)
+	fmt.Printf("Replace the transition bundle with the final bundle on clients, and move %s to offline storage.\n", state.OldKey)
+	fmt.Printf("Certificates from the old root keep verifying against the final bundle while served with %s.\n", filepath.Join(rolloverDir, rolloverLegacyChain))
+	return nil
+}
+
+func runRolloverStatus(cmd *cobra.Command, args []string) error {
+	state, err := loadRolloverState()
+	if err != nil {
+		if os.IsNotExist(err) {
+			color.Yellow("No rollover in progress")
+			return nil
+		}
+		return err
+	}
+
+	fmt.Printf("%-15s", "Stage:")
+	color.New(color.FgHiWhite).Printf("%s\n", state.Stage)
+	fmt.Printf("%-15s%s\n", "Old CA:", state.OldCert)
+	fmt.Printf("%-15s%s\n", "New CA:", state.NewCert)
+	fmt.Printf("%-15s%s\n", "Updated:", state.UpdatedAt.Local().Format(time.RFC3339))
+	return nil
+}
+
+// nextCAName returns name with its generation suffix incremented, adding
+// " G2" to a name without one
+func nextCAName(name string) string {
+	if i := strings.LastIndex(name, " G"); i >= 0 {
+		if gen, err := strconv.Atoi(name[i+2:]); err == nil && gen > 0 {
+			return name[:i] + " G" + strconv.Itoa(gen+1)
+		}
+	}
+	if name == "" {
+		return "CA G2"
+	}
+	return name + " G2"
+}
+
+// requireRolloverStage loads the rollover state and checks it is at stage
+func requireRolloverStage(stage string) (rolloverState, error) {
+	state, err := loadRolloverState()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, fmt.Errorf("no rollover in progress, run 'gotransport ca rollover publish' first")
+		}
+		return state, err
+	}
+	if state.Stage != stage {
+		return state, fmt.Errorf("rollover is in stage %q, expected %q", state.Stage, stage)
+	}
+	return state, nil
+}
+
+func loadRolloverState() (rolloverState, error) {
+	var state rolloverState
+
+	data, err := os.ReadFile(filepath.Join(rolloverDir, rolloverStateFile))
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to parse rollover state: %w", err)
+	}
+	return state, nil
+}
+
+func saveRolloverState(state rolloverState) error {
+	state.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal rollover state: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(rolloverDir, rolloverStateFile), data, 0o644); err != nil {
+		return fmt.Errorf("failed to save rollover state: %w", err)
+	}
+	return nil
+}
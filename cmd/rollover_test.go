@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bxtal-lsn/gotransport/internal/certlog"
+	"github.com/bxtal-lsn/gotransport/pkg/cert"
+)
+
+func TestNextCAName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Example CA", "Example CA G2"},
+		{"Example CA G2", "Example CA G3"},
+		{"Example CA G9", "Example CA G10"},
+		{"Example CA G", "Example CA G G2"},
+		{"Example CA Gx", "Example CA Gx G2"},
+		{"Example CA G0", "Example CA G0 G2"},
+		{"", "CA G2"},
+	}
+
+	for _, tt := range tests {
+		if got := nextCAName(tt.name); got != tt.want {
+			t.Errorf("nextCAName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// readCerts parses every certificate in the PEM file at path
+func readCerts(t *testing.T, path string) []*x509.Certificate {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs = append(certs, c)
+	}
+	return certs
+}
+
+func TestRolloverStages(t *testing.T) {
+	dir := t.TempDir()
+	issuanceLogPath = filepath.Join(dir, "issuance.log")
+	rolloverDir = filepath.Join(dir, "rollover")
+	rolloverOldKey, rolloverOldCert = filepath.Join(dir, "ca.key"), filepath.Join(dir, "ca.crt")
+	rolloverNewKey, rolloverNewCert = filepath.Join(dir, "ca-next.key"), filepath.Join(dir, "ca-next.crt")
+	rolloverName = ""
+	defer func(ca *cert.CACert) { config.CACert = ca }(config.CACert)
+	config.CACert = &cert.CACert{
+		Serial:        big.NewInt(1),
+		ValidForYears: 1,
+		Subject:       cert.CertSubject{CommonName: "Example CA"},
+	}
+	if err := cert.CreateCACert(config.CACert, rolloverOldKey, rolloverOldCert); err != nil {
+		t.Fatal(err)
+	}
+	oldRoot := readCerts(t, rolloverOldCert)[0]
+
+	if err := runRolloverIssue(nil, nil); err == nil {
+		t.Fatal("issue stage ran before publish")
+	}
+
+	// publish creates the new root, the cross certificates and a bundle
+	// trusting both roots
+	if err := runRolloverPublish(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	newRoot := readCerts(t, rolloverNewCert)[0]
+	if newRoot.Subject.CommonName != "Example CA G2" {
+		t.Errorf("new root %q, want Example CA G2", newRoot.Subject.CommonName)
+	}
+	if bundle := readCerts(t, filepath.Join(rolloverDir, rolloverTrustBundle)); len(bundle) != 2 || !bundle[0].Equal(oldRoot) || !bundle[1].Equal(newRoot) {
+		t.Errorf("transition bundle does not hold both roots")
+	}
+	issuanceLog, err := certlog.Open(issuanceLogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := issuanceLog.List(time.Time{}); err != nil || len(entries) != 3 {
+		t.Errorf("issuance log has %d entries (%v), want the new root and two cross certificates", len(entries), err)
+	}
+	if err := runRolloverPublish(nil, nil); err == nil {
+		t.Error("publish ran twice")
+	}
+	if err := runRolloverRetire(nil, nil); err == nil {
+		t.Error("retire stage ran before issue")
+	}
+
+	// issue writes the chain served with leaves from the new root, which
+	// then verify against the old root alone
+	if err := runRolloverIssue(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	newSigner, err := openCASigner(rolloverNewKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued, err := cert.NewCert(&cert.Cert{
+		Serial:        big.NewInt(2),
+		ValidForYears: 1,
+		Subject:       cert.CertSubject{CommonName: "web.test"},
+		DNSNames:      []string{"web.test"},
+	}, newSigner, newRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range readCerts(t, filepath.Join(rolloverDir, rolloverChain)) {
+		intermediates.AddCert(c)
+	}
+	oldRoots := x509.NewCertPool()
+	oldRoots.AddCert(oldRoot)
+	if _, err := issued.Cert.Verify(x509.VerifyOptions{DNSName: "web.test", Roots: oldRoots, Intermediates: intermediates}); err != nil {
+		t.Errorf("leaf from new root with issuing chain does not verify against old root: %v", err)
+	}
+
+	// retire leaves only the new root in the final bundle
+	if err := runRolloverRetire(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if bundle := readCerts(t, filepath.Join(rolloverDir, rolloverFinalBundle)); len(bundle) != 1 || !bundle[0].Equal(newRoot) {
+		t.Errorf("final bundle does not hold only the new root")
+	}
+	if state, err := loadRolloverState(); err != nil || state.Stage != stageRetired {
+		t.Errorf("stage %q (%v), want %q", state.Stage, err, stageRetired)
+	}
+}
@@ -46,11 +46,12 @@ server/client certificates, and RSA keys with a clean CLI interface.`,
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() error {
-	// Only print the logo if we're running the main command (not subcommands)
+	// Only print the logo if we're running the main command (not subcommands).
+	// It goes to stderr so output such as dns export can be redirected.
 	if len(os.Args) <= 1 || (len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-")) {
-		color.Cyan(logo)
-		fmt.Println("Modern TLS Certificate & DNS Management Tool")
-		fmt.Println()
+		fmt.Fprintln(os.Stderr, color.CyanString(logo))
+		fmt.Fprintln(os.Stderr, "Modern TLS Certificate & DNS Management Tool")
+		fmt.Fprintln(os.Stderr)
 	}
 
 	return rootCmd.Execute()
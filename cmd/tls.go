@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+
+	gotls "github.com/bxtal-lsn/gotransport/pkg/tls"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	// Main TLS command
+	tlsCmd := &cobra.Command{
+		Use:   "tls",
+		Short: "TLS configuration commands",
+		Long:  `Inspect the TLS settings used by services built on gotransport`,
+	}
+
+	// TLS profile command
+	tlsProfileCmd := &cobra.Command{
+		Use:   "profile [name]",
+		Short: "Show TLS security profiles",
+		Long:  `Show the protocol versions, cipher suites and curves a connection using each security profile can negotiate`,
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runTLSProfile,
+	}
+
+	// Add commands to TLS command
+	tlsCmd.AddCommand(tlsProfileCmd)
+
+	// Add TLS command to root command
+	rootCmd.AddCommand(tlsCmd)
+}
+
+func runTLSProfile(cmd *cobra.Command, args []string) error {
+	profiles := gotls.Profiles()
+	if len(args) > 0 {
+		profile, err := gotls.LookupProfile(args[0])
+		if err != nil {
+			return err
+		}
+		profiles = []gotls.Profile{profile}
+	}
+
+	titleStyle := color.New(color.FgHiCyan, color.Bold)
+	valueStyle := color.New(color.FgHiWhite)
+
+	for i, p := range profiles {
+		if i > 0 {
+			fmt.Println()
+		}
+		titleStyle.Println(p.Name)
+		fmt.Println(p.Description)
+		fmt.Println()
+
+		fmt.Printf("%-20s", "Versions:")
+		valueStyle.Printf("%s - %s\n", tls.VersionName(p.MinVersion), tls.VersionName(p.MaxVersion))
+
+		printList("TLS 1.3 suites:", cipherNames(p.TLS13Suites()))
+		printList("TLS 1.2 suites:", cipherNames(p.TLS12Suites()))
+
+		curves := make([]string, 0, len(p.CurvePreferences))
+		for _, c := range p.CurvePreferences {
+			curves = append(curves, c.String())
+		}
+		printList("Curves:", curves)
+
+		fmt.Printf("%-20s", "Session tickets:")
+		valueStyle.Printf("%s\n", enabledString(!p.SessionTicketsDisabled))
+		fmt.Printf("%-20s", "Renegotiation:")
+		valueStyle.Printf("%s\n", enabledString(p.Renegotiation != tls.RenegotiateNever))
+	}
+
+	return nil
+}
+
+// printList prints a label followed by one value per line
+func printList(label string, values []string) {
+	fmt.Printf("%-20s", label)
+	if len(values) == 0 {
+		color.New(color.FgHiBlack).Println("none")
+		return
+	}
+	color.New(color.FgHiWhite).Println(strings.Join(values, "\n"+strings.Repeat(" ", 20)))
+}
+
+func cipherNames(ids []uint16) []string {
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		names = append(names, tls.CipherSuiteName(id))
+	}
+	return names
+}
+
+func enabledString(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bxtal-lsn/gotransport/internal/truststore"
+	"github.com/bxtal-lsn/gotransport/pkg/cert"
+	"github.com/spf13/cobra"
+)
+
+var (
+	trustRoot     string
+	trustHome     string
+	trustJavaHome string
+	trustStores   []string
+)
+
+func init() {
+	// Main trust command
+	trustCmd := &cobra.Command{
+		Use:   "trust",
+		Short: "Trust store commands",
+		Long:  `Install or remove a CA certificate in the system, browser and Java trust stores`,
+	}
+
+	// Trust install command
+	trustInstallCmd := &cobra.Command{
+		Use:   "install [ca.crt]",
+		Short: "Install CA into trust stores",
+		Long:  `Install a CA certificate into every trust store found on the system`,
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runTrustInstall,
+	}
+
+	// Trust uninstall command
+	trustUninstallCmd := &cobra.Command{
+		Use:   "uninstall [ca.crt]",
+		Short: "Remove CA from trust stores",
+		Long:  `Remove a CA certificate previously installed with 'trust install'`,
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runTrustUninstall,
+	}
+
+	// Add flags
+	trustCmd.PersistentFlags().StringVar(&trustRoot, "root", "/", "filesystem root the trust stores live under (for chroots and testing)")
+	trustCmd.PersistentFlags().StringVar(&trustHome, "home", os.Getenv("HOME"), "home directory searched for browser NSS databases, relative to --root")
+	trustCmd.PersistentFlags().StringVar(&trustJavaHome, "java-home", os.Getenv("JAVA_HOME"), "Java installation whose cacerts is updated, relative to --root (falls back to /etc/ssl/certs/java/cacerts)")
+	trustCmd.PersistentFlags().StringSliceVar(&trustStores, "stores", storeNames(truststore.Stores()), "trust stores to update")
+
+	// Add commands to trust command
+	trustCmd.AddCommand(trustInstallCmd)
+	trustCmd.AddCommand(trustUninstallCmd)
+
+	// Add trust command to root command
+	rootCmd.AddCommand(trustCmd)
+}
+
+func runTrustInstall(cmd *cobra.Command, args []string) error {
+	ca, stores, err := prepareTrust(args)
+	if err != nil {
+		return err
+	}
+
+	printInfo("Installing %s (%s)", ca.Cert.Subject.CommonName, ca.Nickname)
+	return reportTrust(truststore.Install(trustTarget(), ca, stores), "installed")
+}
+
+func runTrustUninstall(cmd *cobra.Command, args []string) error {
+	ca, stores, err := prepareTrust(args)
+	if err != nil {
+		return err
+	}
+
+	printInfo("Removing %s (%s)", ca.Cert.Subject.CommonName, ca.Nickname)
+	return reportTrust(truststore.Uninstall(trustTarget(), ca, stores), "removed")
+}
+
+// prepareTrust reads the CA certificate and resolves the selected stores
+func prepareTrust(args []string) (*truststore.CA, []truststore.Store, error) {
+	path := "ca.crt"
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	certBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("CA cert read error: %w", err)
+	}
+	caParsed, err := cert.PemToX509(certBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	if !caParsed.IsCA {
+		return nil, nil, fmt.Errorf("%s is not a CA certificate", path)
+	}
+
+	available := truststore.Stores()
+	stores := make([]truststore.Store, 0, len(trustStores))
+	for _, name := range trustStores {
+		var found truststore.Store
+		for _, store := range available {
+			if store.Name() == strings.TrimSpace(name) {
+				found = store
+			}
+		}
+		if found == nil {
+			return nil, nil, fmt.Errorf("unknown trust store %q (available: %s)", name, strings.Join(storeNames(available), ", "))
+		}
+		stores = append(stores, found)
+	}
+
+	return truststore.NewCA(certBytes, caParsed), stores, nil
+}
+
+func trustTarget() truststore.Target {
+	return truststore.Target{
+		Root:     trustRoot,
+		Home:     trustHome,
+		JavaHome: trustJavaHome,
+	}
+}
+
+// reportTrust prints one line per store and fails if any store failed
+func reportTrust(results []truststore.Result, action string) error {
+	changed, failed := 0, 0
+	for _, result := range results {
+		switch {
+		case result.Err == nil:
+			changed++
+			printSuccess("%s: %s", result.Store, action)
+		case errors.Is(result.Err, truststore.ErrNotPresent):
+			if verbose {
+				printInfo("%s: not present, skipped", result.Store)
+			}
+		default:
+			failed++
+			printError("%s: %v", result.Store, result.Err)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d trust store(s) failed", failed)
+	}
+	if changed == 0 {
+		printWarning("No matching trust stores found")
+	}
+	return nil
+}
+
+func storeNames(stores []truststore.Store) []string {
+	names := make([]string, 0, len(stores))
+	for _, store := range stores {
+		names = append(names, store.Name())
+	}
+	return names
+}
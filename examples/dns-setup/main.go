@@ -37,17 +37,18 @@ func addDNSRecord(domain, ip string) {
 }
 
 func startDNSServer() {
-	// Start DNS server in the background
+	// Start DNS server in the background, forwarding other names so the
+	// machine keeps resolving internet names once it uses the server
 	var cmd *exec.Cmd
 
 	// Determine if we need sudo based on the OS and port
 	if runtime.GOOS == "windows" {
 		// On Windows, use non-privileged port without elevation
-		cmd = exec.Command("gotransport", "dns", "serve", "--insecure")
+		cmd = exec.Command("gotransport", "dns", "serve", "--insecure", "--upstream", "1.1.1.1", "--upstream", "8.8.8.8")
 	} else {
 		// On Unix-like systems, we need sudo for privileged ports
 		fmt.Println("Note: Running DNS server requires administrative privileges")
-		cmd = exec.Command("sudo", "gotransport", "dns", "serve")
+		cmd = exec.Command("sudo", "gotransport", "dns", "serve", "--upstream", "1.1.1.1", "--upstream", "8.8.8.8")
 	}
 
 	// Set up command to run in background
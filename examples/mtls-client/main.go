@@ -4,30 +4,22 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"time"
 
 	"github.com/bxtal-lsn/gotransport/pkg/tls"
+	"github.com/bxtal-lsn/gotransport/pkg/tls/transport"
 )
 
 func main() {
-	// Create TLS configuration for the client
-	tlsConfig, err := tls.NewClientTLSConfig(tls.Config{
+	// Create HTTP client with our TLS configuration
+	client, err := transport.NewHTTPClient(tls.Config{
 		CAPath:     "ca.crt",
 		CertPath:   "client.crt",
 		KeyPath:    "client.key",
 		ServerName: "localhost", // Must match the server certificate's Common Name
-	})
+	}, transport.ClientOptions{Timeout: 10 * time.Second})
 	if err != nil {
-		log.Fatalf("Failed to create TLS config: %v", err)
-	}
-
-	// Create HTTP client with our custom TLS configuration
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: tlsConfig,
-		},
+		log.Fatalf("Failed to create client: %v", err)
 	}
 
 	// Make request to the server
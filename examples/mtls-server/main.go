@@ -6,7 +6,8 @@ import (
 	"log"
 	"net/http"
 
-	"github.com/bxtal-lsn/gotransport/pkg/tls"
+	gotls "github.com/bxtal-lsn/gotransport/pkg/tls"
+	"github.com/bxtal-lsn/gotransport/pkg/tls/transport"
 )
 
 func index(w http.ResponseWriter, req *http.Request) {
@@ -14,37 +15,41 @@ func index(w http.ResponseWriter, req *http.Request) {
 }
 
 func showClientCert(w http.ResponseWriter, req *http.Request) {
-	// Check if client provided a valid certificate
-	var commonName string
-	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 && len(req.TLS.VerifiedChains[0]) > 0 {
-		commonName = req.TLS.VerifiedChains[0][0].Subject.CommonName
-		fmt.Fprintf(w, "Hello, %s! Your client certificate was verified successfully.", commonName)
-	} else {
+	// The transport middleware stores the verified client identity
+	peer, ok := transport.PeerFromContext(req.Context())
+	if !ok {
 		fmt.Fprintf(w, "No valid client certificate provided.")
+		return
 	}
+	fmt.Fprintf(w, "Hello, %s! Your client certificate was verified successfully.", peer.CommonName)
 }
 
 func main() {
 	// Define HTTP handlers
-	http.HandleFunc("/", index)
-	http.HandleFunc("/client", showClientCert)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", index)
+	mux.HandleFunc("/client", showClientCert)
 
-	// Create TLS configuration for the server
-	tlsConfig, err := tls.NewServerTLSConfig(tls.Config{
+	cfg := gotls.Config{
 		CAPath:     "ca.crt",
 		CertPath:   "server.crt",
 		KeyPath:    "server.key",
 		ClientAuth: tls.RequireAndVerifyClientCert,
 		MinVersion: tls.VersionTLS12,
-	})
+	}
+
+	// Pick up rotated certificates without a restart
+	reloader, err := gotls.NewReloader(cfg, 0)
 	if err != nil {
-		log.Fatalf("Failed to create TLS config: %v", err)
+		log.Fatalf("Failed to load certificates: %v", err)
 	}
+	reloader.Start()
+	defer reloader.Stop()
 
 	// Create HTTPS server
-	server := &http.Server{
-		Addr:      ":8443",
-		TLSConfig: tlsConfig,
+	server, err := transport.NewHTTPServer(":8443", mux, cfg, transport.ServerOptions{Reloader: reloader})
+	if err != nil {
+		log.Fatalf("Failed to create server: %v", err)
 	}
 
 	// Start the server
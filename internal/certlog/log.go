@@ -0,0 +1,294 @@
+package certlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// genesisHash is the previous hash of the first entry in a log
+const genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// Entry represents a single certificate issuance in the log
+type Entry struct {
+	Index      uint64    `json:"index"`
+	Serial     string    `json:"serial"`
+	CommonName string    `json:"commonName"`
+	CertSHA256 string    `json:"certSha256"`
+	Requester  string    `json:"requester"`
+	Timestamp  time.Time `json:"timestamp"`
+	PrevHash   string    `json:"prevHash"`
+	Hash       string    `json:"hash"`
+}
+
+// VerifyError describes the first inconsistency found in a log
+type VerifyError struct {
+	Line   int
+	Index  uint64
+	Reason string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("issuance log corrupt at line %d (entry %d): %s", e.Line, e.Index, e.Reason)
+}
+
+// Log is an append-only, hash-chained record of issued certificates.
+// Every entry commits to the hash of the entry before it, so removing,
+// reordering or editing an entry breaks the chain.
+type Log struct {
+	mu   sync.Mutex
+	file string
+}
+
+// Open returns a log backed by the given file. The file is created on
+// first append.
+func Open(path string) (*Log, error) {
+	dir := filepath.Dir(path)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create log directory: %w", err)
+		}
+	}
+
+	return &Log{file: path}, nil
+}
+
+// Append records the issuance of cert by requester and returns the new entry
+func (l *Log) Append(cert *x509.Certificate, requester string) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries, lines, err := l.read()
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := verifyChain(entries, lines); err != nil {
+		return Entry{}, fmt.Errorf("refusing to append to broken log: %w", err)
+	}
+
+	sum := sha256.Sum256(cert.Raw)
+	entry := Entry{
+		Index:      uint64(len(entries)) + 1,
+		Serial:     cert.SerialNumber.String(),
+		CommonName: cert.Subject.CommonName,
+		CertSHA256: hex.EncodeToString(sum[:]),
+		Requester:  requester,
+		Timestamp:  time.Now().UTC().Truncate(time.Second),
+		PrevHash:   genesisHash,
+	}
+	if len(entries) > 0 {
+		entry.PrevHash = entries[len(entries)-1].Hash
+	}
+	entry.Hash = entry.computeHash()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to marshal log entry: %w", err)
+	}
+
+	f, err := os.OpenFile(l.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to open issuance log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return Entry{}, fmt.Errorf("failed to write issuance log: %w", err)
+	}
+
+	return entry, f.Sync()
+}
+
+// List returns all entries issued at or after since. A zero since returns
+// every entry.
+func (l *Log) List(since time.Time) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries, _, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Entry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Timestamp.Before(since) {
+			continue
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// Verify walks the whole log and checks that every entry is intact and
+// chained to its predecessor. It returns the number of verified entries and
+// the hash of the last one. The chain alone cannot reveal trailing entries
+// that were cut off or a log rewritten from scratch, so keep the count and
+// head elsewhere and check them later with VerifyAnchor.
+func (l *Log) Verify() (int, string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries, lines, err := l.read()
+	if err != nil {
+		return 0, "", err
+	}
+	if err := verifyChain(entries, lines); err != nil {
+		return 0, "", err
+	}
+
+	return len(entries), headHash(entries), nil
+}
+
+// VerifyAnchor verifies the log like Verify and checks it against a count
+// and head returned by an earlier Verify. The log may have grown since, but
+// entry count must still have hash head. A zero count checks head against
+// the current head instead.
+func (l *Log) VerifyAnchor(count int, head string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries, lines, err := l.read()
+	if err != nil {
+		return err
+	}
+	if err := verifyChain(entries, lines); err != nil {
+		return err
+	}
+
+	if count == 0 {
+		if current := headHash(entries); head != "" && current != head {
+			return &VerifyError{Line: lastLine(lines), Index: uint64(len(entries)), Reason: fmt.Sprintf("head %s does not match expected %s (log rewritten or truncated)", current, head)}
+		}
+		return nil
+	}
+
+	if count > len(entries) {
+		return &VerifyError{Line: lastLine(lines), Index: uint64(len(entries)), Reason: fmt.Sprintf("log has %d entries, expected at least %d (entries removed from the end)", len(entries), count)}
+	}
+	if head != "" && entries[count-1].Hash != head {
+		return &VerifyError{Line: lines[count-1], Index: uint64(count), Reason: fmt.Sprintf("entry hash does not match expected head %s (log rewritten)", head)}
+	}
+	return nil
+}
+
+// Writable checks that the log is intact and its file can be appended to,
+// so callers can find out before issuing a certificate they could not
+// record
+func (l *Log) Writable() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries, lines, err := l.read()
+	if err != nil {
+		return err
+	}
+	if err := verifyChain(entries, lines); err != nil {
+		return fmt.Errorf("refusing to append to broken log: %w", err)
+	}
+
+	f, err := os.OpenFile(l.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open issuance log: %w", err)
+	}
+	return f.Close()
+}
+
+// headHash returns the hash of the last entry, or the genesis hash
+func headHash(entries []Entry) string {
+	if len(entries) == 0 {
+		return genesisHash
+	}
+	return entries[len(entries)-1].Hash
+}
+
+// lastLine returns the line of the last entry, 0 for an empty log
+func lastLine(lines []int) int {
+	if len(lines) == 0 {
+		return 0
+	}
+	return lines[len(lines)-1]
+}
+
+// read loads every entry from disk with the line it is on. A missing file
+// is an empty log.
+func (l *Log) read() ([]Entry, []int, error) {
+	f, err := os.Open(l.file)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open issuance log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	var lines []int
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil, nil, &VerifyError{Line: line, Index: uint64(len(entries)) + 1, Reason: fmt.Sprintf("unparseable entry: %v", err)}
+		}
+		entries = append(entries, entry)
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read issuance log: %w", err)
+	}
+
+	return entries, lines, nil
+}
+
+// verifyChain checks indices, previous hashes and entry hashes in order.
+// lines holds the file line of each entry for error reports.
+func verifyChain(entries []Entry, lines []int) error {
+	prev := genesisHash
+	for i, entry := range entries {
+		want := uint64(i) + 1
+		switch {
+		case entry.Index != want:
+			return &VerifyError{Line: lines[i], Index: want, Reason: fmt.Sprintf("expected index %d, found %d (missing or reordered entries)", want, entry.Index)}
+		case entry.PrevHash != prev:
+			return &VerifyError{Line: lines[i], Index: want, Reason: "previous hash does not match preceding entry"}
+		case entry.Hash != entry.computeHash():
+			return &VerifyError{Line: lines[i], Index: want, Reason: "entry hash mismatch (entry was modified)"}
+		}
+		prev = entry.Hash
+	}
+	return nil
+}
+
+// computeHash hashes every field of the entry except Hash itself
+func (e Entry) computeHash() string {
+	h := sha256.New()
+	for _, field := range []string{
+		strconv.FormatUint(e.Index, 10),
+		e.Serial,
+		e.CommonName,
+		e.CertSHA256,
+		e.Requester,
+		e.Timestamp.UTC().Format(time.RFC3339),
+		e.PrevHash,
+	} {
+		// Length-prefix each field so values can't shift between fields
+		fmt.Fprintf(h, "%d:%s", len(field), field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
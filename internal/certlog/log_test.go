@@ -0,0 +1,151 @@
+package certlog
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testCert(serial int64, name string) *x509.Certificate {
+	return &x509.Certificate{
+		Raw:          []byte(name),
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+	}
+}
+
+func newTestLog(t *testing.T, n int) (*Log, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "issuance.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= n; i++ {
+		if _, err := l.Append(testCert(int64(i), "host"+string(rune('a'+i))), "tester"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return l, path
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func writeLines(t *testing.T, path string, lines []string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	l, _ := newTestLog(t, 3)
+
+	count, head, err := l.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 || head == genesisHash {
+		t.Fatalf("Verify() = %d, %s", count, head)
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	l, path := newTestLog(t, 3)
+
+	lines := readLines(t, path)
+	lines[1] = strings.Replace(lines[1], `"requester":"tester"`, `"requester":"mallory"`, 1)
+	writeLines(t, path, lines)
+
+	_, _, err := l.Verify()
+	var verifyErr *VerifyError
+	if !errors.As(err, &verifyErr) {
+		t.Fatalf("Verify() error = %v, want VerifyError", err)
+	}
+	if verifyErr.Line != 2 || verifyErr.Index != 2 {
+		t.Fatalf("error at line %d entry %d, want line 2 entry 2", verifyErr.Line, verifyErr.Index)
+	}
+}
+
+func TestVerifyLineNumbersSkipBlankLines(t *testing.T) {
+	l, path := newTestLog(t, 3)
+
+	lines := readLines(t, path)
+	lines[2] = strings.Replace(lines[2], `"index":3`, `"index":4`, 1)
+	writeLines(t, path, []string{lines[0], "", "", lines[1], "", lines[2]})
+
+	_, _, err := l.Verify()
+	var verifyErr *VerifyError
+	if !errors.As(err, &verifyErr) {
+		t.Fatalf("Verify() error = %v, want VerifyError", err)
+	}
+	if verifyErr.Line != 6 {
+		t.Fatalf("error at line %d, want 6", verifyErr.Line)
+	}
+}
+
+func TestVerifyAnchor(t *testing.T) {
+	l, path := newTestLog(t, 3)
+
+	count, head, err := l.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The log may grow past the anchor
+	if _, err := l.Append(testCert(4, "later"), "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.VerifyAnchor(count, head); err != nil {
+		t.Fatalf("VerifyAnchor() after append: %v", err)
+	}
+
+	// Cutting entries off the end keeps the chain intact but fails the anchor
+	lines := readLines(t, path)
+	writeLines(t, path, lines[:2])
+	if _, _, err := l.Verify(); err != nil {
+		t.Fatalf("Verify() after truncation: %v", err)
+	}
+	if err := l.VerifyAnchor(count, head); err == nil {
+		t.Fatal("VerifyAnchor() accepted a truncated log")
+	}
+
+	// A log rewritten from scratch with the same count fails on the head
+	rewritten, _ := newTestLog(t, 0)
+	for i := 1; i <= count; i++ {
+		if _, err := rewritten.Append(testCert(int64(i), "forged"), "mallory"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rewritten.VerifyAnchor(count, head); err == nil {
+		t.Fatal("VerifyAnchor() accepted a rewritten log")
+	}
+	if err := rewritten.VerifyAnchor(0, head); err == nil {
+		t.Fatal("VerifyAnchor() accepted a rewritten head")
+	}
+}
+
+func TestWritable(t *testing.T) {
+	l, path := newTestLog(t, 2)
+	if err := l.Writable(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := readLines(t, path)
+	writeLines(t, path, lines[1:])
+	if err := l.Writable(); err == nil {
+		t.Fatal("Writable() accepted a broken log")
+	}
+}
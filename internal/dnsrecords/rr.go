@@ -0,0 +1,47 @@
+package dnsrecords
+
+import (
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// RR converts the record to a resource record owned by name
+func (r Record) RR(name string) dns.RR {
+	hdr := dns.RR_Header{
+		Name:   name,
+		Rrtype: dns.StringToType[string(r.Type)],
+		Class:  dns.ClassINET,
+		Ttl:    r.TTL,
+	}
+
+	switch r.Type {
+	case A:
+		return &dns.A{Hdr: hdr, A: net.ParseIP(r.Value).To4()}
+	case AAAA:
+		return &dns.AAAA{Hdr: hdr, AAAA: net.ParseIP(r.Value)}
+	case CNAME:
+		return &dns.CNAME{Hdr: hdr, Target: r.Value}
+	case TXT:
+		return &dns.TXT{Hdr: hdr, Txt: r.Text}
+	case MX:
+		return &dns.MX{Hdr: hdr, Preference: r.Priority, Mx: r.Value}
+	case SRV:
+		return &dns.SRV{Hdr: hdr, Priority: r.Priority, Weight: r.Weight, Port: r.Port, Target: r.Value}
+	case PTR:
+		return &dns.PTR{Hdr: hdr, Ptr: r.Value}
+	case CAA:
+		return &dns.CAA{Hdr: hdr, Flag: r.Flag, Tag: r.Tag, Value: r.Value}
+	case NS:
+		return &dns.NS{Hdr: hdr, Ns: r.Value}
+	}
+	return &dns.RFC3597{Hdr: hdr}
+}
+
+// Data returns the record data in zone file presentation format, such as
+// "10 mail.example.com." for an MX record
+func (r Record) Data() string {
+	rr := r.RR(r.Domain)
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
@@ -6,8 +6,11 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+
+	"github.com/miekg/dns"
 )
 
 // RecordType represents DNS record types
@@ -16,21 +19,70 @@ type RecordType string
 const (
 	// A record type
 	A RecordType = "A"
+	// AAAA record type
+	AAAA RecordType = "AAAA"
 	// CNAME record type
 	CNAME RecordType = "CNAME"
+	// TXT record type
+	TXT RecordType = "TXT"
+	// MX record type
+	MX RecordType = "MX"
+	// SRV record type
+	SRV RecordType = "SRV"
+	// PTR record type
+	PTR RecordType = "PTR"
+	// CAA record type
+	CAA RecordType = "CAA"
+	// NS record type
+	NS RecordType = "NS"
 )
 
-// Record represents a DNS record
+// RecordTypes lists the supported record types
+var RecordTypes = []RecordType{A, AAAA, CNAME, TXT, MX, SRV, PTR, CAA, NS}
+
+// txtStringLimit is the longest character string a TXT record can hold,
+// longer text is split over several strings (RFC 1035 3.3)
+const txtStringLimit = 255
+
+// Record represents a DNS record. Value holds the address for A and AAAA,
+// the target name for CNAME, MX, SRV, PTR and NS, and the property value
+// for CAA. The remaining fields only apply to the types noted.
 type Record struct {
-	Domain string     `json:"domain"`
-	Type   RecordType `json:"type"`
-	Value  string     `json:"value"`
-	TTL    uint32     `json:"ttl"`
+	Domain string     `json:"domain" yaml:"domain"`
+	Type   RecordType `json:"type" yaml:"type"`
+	Value  string     `json:"value" yaml:"value,omitempty"`
+	TTL    uint32     `json:"ttl" yaml:"ttl"`
+
+	// Text holds the character strings of a TXT record
+	Text []string `json:"text,omitempty" yaml:"text,omitempty"`
+	// Priority is the MX preference or the SRV priority
+	Priority uint16 `json:"priority,omitempty" yaml:"priority,omitempty"`
+	// Weight and Port apply to SRV
+	Weight uint16 `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Port   uint16 `json:"port,omitempty" yaml:"port,omitempty"`
+	// Flag and Tag apply to CAA
+	Flag uint8  `json:"flag,omitempty" yaml:"flag,omitempty"`
+	Tag  string `json:"tag,omitempty" yaml:"tag,omitempty"`
+}
+
+// RecordSet holds every record of one type at one name. Records in a set
+// share a TTL and are served together, in rotating order.
+type RecordSet struct {
+	Domain  string
+	Type    RecordType
+	TTL     uint32
+	Records []Record
+}
+
+// setKey identifies a record set
+type setKey struct {
+	domain     string
+	recordType RecordType
 }
 
 // Storage manages DNS records
 type Storage struct {
-	records map[string]Record
+	records map[setKey][]Record
 	mu      sync.RWMutex
 	file    string
 }
@@ -46,7 +98,7 @@ func NewStorage(storagePath string) (*Storage, error) {
 	}
 
 	storage := &Storage{
-		records: make(map[string]Record),
+		records: make(map[setKey][]Record),
 		file:    storagePath,
 	}
 
@@ -60,110 +112,578 @@ func NewStorage(storagePath string) (*Storage, error) {
 	return storage, nil
 }
 
-// Add adds a new DNS record
+// NewMemoryStorage creates a storage holding records in memory only, for
+// records read from a file the storage does not own. Nothing is stored if
+// any record is invalid.
+func NewMemoryStorage(records []Record) (*Storage, error) {
+	storage := &Storage{records: make(map[setKey][]Record)}
+	if err := storage.Import(records, true); err != nil {
+		return nil, err
+	}
+	return storage, nil
+}
+
+// Add adds a record to the set of its name and type. Adding a value that
+// is already present only updates the TTL, which applies to the whole set.
+// Use AddRecord for types with fields besides the value.
 func (s *Storage) Add(domain string, recordType RecordType, value string, ttl uint32) error {
+	return s.AddRecord(Record{
+		Domain: domain,
+		Type:   recordType,
+		Value:  value,
+		TTL:    ttl,
+	})
+}
+
+// AddRecord adds a record to the set of its name and type, like Add
+func (s *Storage) AddRecord(record Record) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Normalize domain name
-	domain = normalizeDomain(domain)
-
-	// Validate record type
-	if recordType != A && recordType != CNAME {
-		return fmt.Errorf("unsupported record type: %s", recordType)
+	if err := s.add(record); err != nil {
+		return err
 	}
 
-	// Validate value based on record type
-	if recordType == A {
-		if net.ParseIP(value) == nil {
-			return fmt.Errorf("invalid IP address: %s", value)
+	// Save changes
+	return s.save()
+}
+
+// Import adds records in one step, replacing all existing records if
+// replace is set. Nothing is changed if any record is invalid.
+func (s *Storage) Import(records []Record, replace bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Work on a copy, so a failure leaves the records untouched
+	previous := s.records
+	s.records = make(map[setKey][]Record)
+	if !replace {
+		for key, set := range previous {
+			s.records[key] = append([]Record(nil), set...)
 		}
 	}
 
-	// Add the record
-	s.records[domain] = Record{
-		Domain: domain,
-		Type:   recordType,
-		Value:  value,
-		TTL:    ttl,
+	for _, record := range records {
+		if err := s.add(record); err != nil {
+			s.records = previous
+			return fmt.Errorf("%s %s: %w", record.Domain, record.Type, err)
+		}
 	}
 
 	// Save changes
-	return s.save()
+	if err := s.save(); err != nil {
+		s.records = previous
+		return err
+	}
+	return nil
+}
+
+// add validates record and adds it to its set, the caller holds s.mu
+func (s *Storage) add(record Record) error {
+	// Normalize and validate the record
+	record, err := prepareRecord(record)
+	if err != nil {
+		return err
+	}
+
+	// A CNAME cannot coexist with other data at its name (RFC 1034 3.6.2)
+	if err := s.checkCNAMEConflict(record.Domain, record.Type, record.Value); err != nil {
+		return err
+	}
+
+	key := setKey{record.Domain, record.Type}
+	set := s.records[key]
+
+	// Add the record unless the data is already in the set
+	found := false
+	for i := range set {
+		set[i].TTL = record.TTL
+		if set[i].Data() == record.Data() {
+			found = true
+		}
+	}
+	if !found {
+		set = append(set, record)
+	}
+	s.records[key] = set
+	return nil
 }
 
-// Remove removes a DNS record
-func (s *Storage) Remove(domain string) error {
+// Remove removes records from a name. An empty value removes the whole set
+// of recordType, and an empty recordType removes every set at the name. A
+// value matches a record's Value or its Data, such as "10 mail.example.com."
+// for an MX record, or the text of a TXT record.
+func (s *Storage) Remove(domain string, recordType RecordType, value string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	// Normalize domain name
 	domain = normalizeDomain(domain)
 
-	// Check if record exists
-	if _, exists := s.records[domain]; !exists {
-		return fmt.Errorf("record not found: %s", domain)
+	removed := 0
+	for key, set := range s.records {
+		if key.domain != domain || (recordType != "" && key.recordType != recordType) {
+			continue
+		}
+
+		kept := set[:0]
+		for _, record := range set {
+			if record.matches(value) {
+				removed++
+				continue
+			}
+			kept = append(kept, record)
+		}
+
+		if len(kept) == 0 {
+			delete(s.records, key)
+		} else {
+			s.records[key] = kept
+		}
 	}
 
-	// Remove the record
-	delete(s.records, domain)
+	// Check if any record matched
+	if removed == 0 {
+		return fmt.Errorf("record not found: %s", describe(domain, recordType, value))
+	}
 
 	// Save changes
 	return s.save()
 }
 
-// Get retrieves a DNS record
-func (s *Storage) Get(domain string) (Record, bool) {
+// Get retrieves the records of one type at a name. A non-empty value
+// restricts the result to the record with that value or data.
+func (s *Storage) Get(domain string, recordType RecordType, value string) ([]Record, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	// Normalize domain name
 	domain = normalizeDomain(domain)
 
-	record, exists := s.records[domain]
-	return record, exists
+	set := s.records[setKey{domain, recordType}]
+	records := make([]Record, 0, len(set))
+	for _, record := range set {
+		if record.matches(value) {
+			records = append(records, record)
+		}
+	}
+	return records, len(records) > 0
 }
 
-// List returns all DNS records
+// HasName reports whether domain exists, either because it holds records
+// of any type or because names below it do (an empty non-terminal)
+func (s *Storage) HasName(domain string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Normalize domain name
+	domain = normalizeDomain(domain)
+
+	for key := range s.records {
+		if key.domain == domain || strings.HasSuffix(key.domain, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRecords reports whether domain itself holds records of any type
+func (s *Storage) HasRecords(domain string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	domain = normalizeDomain(domain)
+	for key := range s.records {
+		if key.domain == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns all DNS records ordered by name and type
 func (s *Storage) List() []Record {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	records := make([]Record, 0, len(s.records))
-	for _, record := range s.records {
-		records = append(records, record)
+	for _, key := range sortedKeys(s.records) {
+		records = append(records, s.records[key]...)
 	}
 	return records
 }
 
-// save persists DNS records to disk
+// Sets returns all record sets ordered by name and type
+func (s *Storage) Sets() []RecordSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sets := make([]RecordSet, 0, len(s.records))
+	for _, key := range sortedKeys(s.records) {
+		records := append([]Record(nil), s.records[key]...)
+		sets = append(sets, RecordSet{
+			Domain:  key.domain,
+			Type:    key.recordType,
+			TTL:     records[0].TTL,
+			Records: records,
+		})
+	}
+	return sets
+}
+
+// sortedKeys returns the keys of sets ordered by name and type
+func sortedKeys(sets map[setKey][]Record) []setKey {
+	keys := make([]setKey, 0, len(sets))
+	for key := range sets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].domain != keys[j].domain {
+			return keys[i].domain < keys[j].domain
+		}
+		return keys[i].recordType < keys[j].recordType
+	})
+	return keys
+}
+
+// save persists DNS records to disk as a list ordered by name and type
 func (s *Storage) save() error {
-	data, err := json.MarshalIndent(s.records, "", "  ")
+	// Memory storages have no file
+	if s.file == "" {
+		return nil
+	}
+
+	records := make([]Record, 0, len(s.records))
+	for _, key := range sortedKeys(s.records) {
+		records = append(records, s.records[key]...)
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal records: %w", err)
 	}
 
-	if err := os.WriteFile(s.file, data, 0o644); err != nil {
+	// Replace the file in one step, so a running server reloading it never
+	// reads a partly written file
+	tmp, err := os.CreateTemp(filepath.Dir(s.file), "."+filepath.Base(s.file)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save records: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save records: %w", err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save records: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save records: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.file); err != nil {
 		return fmt.Errorf("failed to save records: %w", err)
 	}
 
 	return nil
 }
 
-// load reads DNS records from disk
+// load reads DNS records from disk. Files written before record sets were
+// introduced hold an object keyed by domain and are still accepted.
 func (s *Storage) load() error {
+	records, err := s.read()
+	if err != nil {
+		return err
+	}
+	s.records = records
+	return nil
+}
+
+// read parses the storage file into record sets. Every record is checked
+// as dns add would, so a hand-edited file cannot bring in records the
+// storage rejects.
+func (s *Storage) read() (map[setKey][]Record, error) {
 	data, err := os.ReadFile(s.file)
 	if err != nil {
-		return fmt.Errorf("failed to read records: %w", err)
+		return nil, fmt.Errorf("failed to read records: %w", err)
+	}
+
+	var records []Record
+	if err := json.Unmarshal(data, &records); err != nil {
+		var byDomain map[string]Record
+		if legacyErr := json.Unmarshal(data, &byDomain); legacyErr != nil {
+			return nil, fmt.Errorf("failed to unmarshal records: %w", err)
+		}
+		for _, record := range byDomain {
+			records = append(records, record)
+		}
 	}
 
-	if err := json.Unmarshal(data, &s.records); err != nil {
-		return fmt.Errorf("failed to unmarshal records: %w", err)
+	loaded := &Storage{records: make(map[setKey][]Record)}
+	for _, record := range records {
+		if err := loaded.add(record); err != nil {
+			return nil, fmt.Errorf("%s: %s %s: %w", s.file, record.Domain, record.Type, err)
+		}
 	}
 
+	return loaded.records, nil
+}
+
+// Diff lists the records a reload added and removed. A record whose TTL
+// changed is listed as removed with the old TTL and added with the new one.
+type Diff struct {
+	Added   []Record
+	Removed []Record
+}
+
+// Empty reports whether the reload changed nothing
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// Path returns the file the storage is kept in
+func (s *Storage) Path() string {
+	return s.file
+}
+
+// Reload rereads the storage file, which another process may have changed,
+// and swaps in its records at once. On error the records are unchanged.
+func (s *Storage) Reload() (Diff, error) {
+	records, err := s.read()
+	if err != nil {
+		return Diff{}, err
+	}
+
+	s.mu.Lock()
+	previous := s.records
+	s.records = records
+	s.mu.Unlock()
+
+	return Diff{
+		Added:   missingRecords(records, previous),
+		Removed: missingRecords(previous, records),
+	}, nil
+}
+
+// missingRecords returns the records of sets that are not in other, in
+// name and type order
+func missingRecords(sets, other map[setKey][]Record) []Record {
+	var missing []Record
+	for _, key := range sortedKeys(sets) {
+		for _, record := range sets[key] {
+			found := false
+			for _, candidate := range other[key] {
+				if candidate.Data() == record.Data() && candidate.TTL == record.TTL {
+					found = true
+					break
+				}
+			}
+			if !found {
+				missing = append(missing, record)
+			}
+		}
+	}
+	return missing
+}
+
+// checkCNAMEConflict rejects adding a CNAME to a name with other records,
+// a second CNAME, or other records to a name with a CNAME. The caller must
+// hold s.mu.
+func (s *Storage) checkCNAMEConflict(domain string, recordType RecordType, value string) error {
+	for key, set := range s.records {
+		if key.domain != domain {
+			continue
+		}
+		switch {
+		case recordType == CNAME && key.recordType == CNAME && set[0].Value != value:
+			return fmt.Errorf("%s already has a CNAME record to %s, a name can only have one", domain, set[0].Value)
+		case recordType == CNAME && key.recordType != CNAME:
+			return fmt.Errorf("%s already has %s records, a CNAME cannot coexist with other data", domain, key.recordType)
+		case recordType != CNAME && key.recordType == CNAME:
+			return fmt.Errorf("%s has a CNAME record, remove it before adding %s records", domain, recordType)
+		}
+	}
 	return nil
 }
 
+// validateDomain checks a normalized domain name. The wildcard label "*" is
+// only allowed as the leftmost label (RFC 4592).
+func validateDomain(domain string) error {
+	if domain == "." || strings.Contains(domain, "..") {
+		return fmt.Errorf("invalid domain name: %s", domain)
+	}
+	if i := strings.Index(domain, "*"); i >= 0 && (i != 0 || !strings.HasPrefix(domain, "*.") || strings.Contains(domain[1:], "*")) {
+		return fmt.Errorf("invalid wildcard %s, \"*\" must be the whole leftmost label", domain)
+	}
+	return nil
+}
+
+// prepareRecord normalizes a record and checks it is valid for its type
+func prepareRecord(record Record) (Record, error) {
+	record.Domain = normalizeDomain(record.Domain)
+	record.Type = RecordType(strings.ToUpper(string(record.Type)))
+	record.Value = normalizeValue(record.Type, record.Value)
+
+	if err := validateDomain(record.Domain); err != nil {
+		return record, err
+	}
+
+	switch record.Type {
+	case A:
+		// net.ParseIP accepts IPv6 too, A records hold IPv4 only
+		if ip := net.ParseIP(record.Value); ip == nil || ip.To4() == nil || strings.Contains(record.Value, ":") {
+			return record, fmt.Errorf("invalid IPv4 address for A record: %s", record.Value)
+		}
+	case AAAA:
+		if ip := net.ParseIP(record.Value); ip == nil || !strings.Contains(record.Value, ":") {
+			return record, fmt.Errorf("invalid IPv6 address for AAAA record: %s", record.Value)
+		}
+	case CNAME:
+		if err := validateTarget(record.Value); err != nil {
+			return record, fmt.Errorf("invalid CNAME target: %w", err)
+		}
+		if record.Value == record.Domain {
+			return record, fmt.Errorf("CNAME %s cannot point to itself", record.Domain)
+		}
+	case TXT:
+		if len(record.Text) == 0 && record.Value != "" {
+			record.Text = []string{record.Value}
+		}
+		if len(record.Text) == 0 {
+			return record, fmt.Errorf("TXT record needs at least one string")
+		}
+		record.Text = splitText(record.Text)
+		record.Value = ""
+	case MX:
+		if err := validateTarget(record.Value); err != nil {
+			return record, fmt.Errorf("invalid MX exchange: %w", err)
+		}
+	case SRV:
+		// Owner names are _service._proto.name (RFC 2782)
+		labels := dns.SplitDomainName(strings.TrimPrefix(record.Domain, "*."))
+		if len(labels) < 3 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+			return record, fmt.Errorf("SRV domain %s must have the form _service._proto.name", record.Domain)
+		}
+		// A target of "." means the service is not available
+		if record.Value != "." {
+			if err := validateTarget(record.Value); err != nil {
+				return record, fmt.Errorf("invalid SRV target: %w", err)
+			}
+			if record.Port == 0 {
+				return record, fmt.Errorf("SRV record needs a port")
+			}
+		}
+	case PTR:
+		if err := validateTarget(record.Value); err != nil {
+			return record, fmt.Errorf("invalid PTR target: %w", err)
+		}
+	case NS:
+		if err := validateTarget(record.Value); err != nil {
+			return record, fmt.Errorf("invalid NS name: %w", err)
+		}
+	case CAA:
+		// RFC 8659 4.1: tags are ASCII letters and digits, flag 128 is
+		// the issuer critical flag
+		record.Tag = strings.ToLower(record.Tag)
+		if record.Tag == "" || strings.Trim(record.Tag, "abcdefghijklmnopqrstuvwxyz0123456789") != "" {
+			return record, fmt.Errorf("invalid CAA tag %q (e.g. issue, issuewild or iodef)", record.Tag)
+		}
+		if record.Flag != 0 && record.Flag != 128 {
+			return record, fmt.Errorf("invalid CAA flag %d, use 0 or 128", record.Flag)
+		}
+	default:
+		return record, fmt.Errorf("unsupported record type: %s", record.Type)
+	}
+
+	return record, nil
+}
+
+// validateTarget checks a domain name that a record points to
+func validateTarget(target string) error {
+	target = normalizeDomain(target)
+	if _, ok := dns.IsDomainName(target); !ok || target == "." {
+		return fmt.Errorf("%q is not a domain name", target)
+	}
+	if strings.Contains(target, "*") {
+		return fmt.Errorf("%q must not contain a wildcard", target)
+	}
+	return nil
+}
+
+// normalizeValue brings values that are domain names into the form used
+// as keys, so they compare equal however they were written
+func normalizeValue(recordType RecordType, value string) string {
+	switch recordType {
+	case CNAME, MX, SRV, PTR, NS:
+		if value != "" {
+			return normalizeDomain(value)
+		}
+	}
+	return value
+}
+
+// splitText splits strings longer than a TXT character string can hold
+func splitText(text []string) []string {
+	var split []string
+	for _, t := range text {
+		for len(t) > txtStringLimit {
+			split = append(split, t[:txtStringLimit])
+			t = t[txtStringLimit:]
+		}
+		split = append(split, t)
+	}
+	return split
+}
+
+// matches reports whether value selects the record. An empty value
+// matches every record. TXT and CAA records also match their data without
+// the quotes, and TXT records their text as given to dns add.
+func (r Record) matches(value string) bool {
+	if value == "" || r.Value == normalizeValue(r.Type, value) || r.Data() == value {
+		return true
+	}
+	switch r.Type {
+	case TXT:
+		return strings.Join(r.Text, "") == value || unquote(r.Data()) == value
+	case CAA:
+		return unquote(r.Data()) == value
+	}
+	return false
+}
+
+// unquote strips the quotes from character strings in record data, so
+// "0 issue \"ca.test\"" becomes "0 issue ca.test"
+func unquote(data string) string {
+	var b strings.Builder
+	escaped := false
+	for _, c := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+			continue
+		case c == '"':
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// describe formats a record selector for error messages
+func describe(domain string, recordType RecordType, value string) string {
+	parts := []string{domain}
+	if recordType != "" {
+		parts = append(parts, string(recordType))
+	}
+	if value != "" {
+		parts = append(parts, value)
+	}
+	return strings.Join(parts, " ")
+}
+
 // normalizeDomain ensures a domain ends with a period
 func normalizeDomain(domain string) string {
 	domain = strings.ToLower(domain)
@@ -0,0 +1,441 @@
+package dnsrecords
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeStorage writes data as the storage file in a temporary directory
+// and returns its path
+func writeStorage(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "dns.json")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadValidatesRecords(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"invalid address", `[{"domain": "web.test", "type": "A", "value": "not-an-ip", "ttl": 60}]`, "invalid IPv4 address"},
+		{"CNAME beside data", `[
+			{"domain": "web.test", "type": "A", "value": "10.0.0.1", "ttl": 60},
+			{"domain": "web.test", "type": "CNAME", "value": "other.test", "ttl": 60}
+		]`, "CNAME cannot coexist"},
+		{"second CNAME", `[
+			{"domain": "web.test", "type": "CNAME", "value": "a.test", "ttl": 60},
+			{"domain": "web.test", "type": "CNAME", "value": "b.test", "ttl": 60}
+		]`, "can only have one"},
+		{"misplaced wildcard", `[{"domain": "a.*.test", "type": "A", "value": "10.0.0.1", "ttl": 60}]`, "invalid wildcard"},
+		{"unknown type", `[{"domain": "web.test", "type": "SPF", "value": "v=spf1", "ttl": 60}]`, "unsupported record type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewStorage(writeStorage(t, tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadNormalizesRecords(t *testing.T) {
+	storage, err := NewStorage(writeStorage(t, `[
+		{"domain": "Web.Test", "type": "a", "value": "10.0.0.1", "ttl": 60},
+		{"domain": "web.test.", "type": "A", "value": "10.0.0.1", "ttl": 120},
+		{"domain": "txt.test", "type": "TXT", "value": "legacy text", "ttl": 60}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Duplicates merge into one record, as dns add would store them
+	records, ok := storage.Get("web.test", A, "")
+	if !ok || len(records) != 1 || records[0].TTL != 120 {
+		t.Errorf("web.test A = %+v", records)
+	}
+	// TXT values are moved to Text
+	if records, ok := storage.Get("txt.test", TXT, ""); !ok || records[0].Value != "" || records[0].Text[0] != "legacy text" {
+		t.Errorf("txt.test TXT = %+v", records)
+	}
+}
+
+func TestLoadLegacyFormat(t *testing.T) {
+	storage, err := NewStorage(writeStorage(t, `{
+		"web.test": {"domain": "web.test", "type": "A", "value": "10.0.0.1", "ttl": 60}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := storage.Get("web.test", A, "10.0.0.1"); !ok {
+		t.Error("legacy record not loaded")
+	}
+}
+
+func TestReloadKeepsRecordsOnInvalidFile(t *testing.T) {
+	path := writeStorage(t, `[{"domain": "web.test", "type": "A", "value": "10.0.0.1", "ttl": 60}]`)
+	storage, err := NewStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := `[
+		{"domain": "web.test", "type": "A", "value": "10.0.0.2", "ttl": 60},
+		{"domain": "web.test", "type": "CNAME", "value": "other.test", "ttl": 60}
+	]`
+	if err := os.WriteFile(path, []byte(invalid), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Reload(); err == nil {
+		t.Fatal("invalid file reloaded")
+	}
+	if records := storage.List(); len(records) != 1 || records[0].Value != "10.0.0.1" {
+		t.Fatalf("records after failed reload = %+v, want the previous set", records)
+	}
+
+	valid := `[{"domain": "web.test", "type": "A", "value": "10.0.0.2", "ttl": 60}]`
+	if err := os.WriteFile(path, []byte(valid), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := storage.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Added) != 1 || len(diff.Removed) != 1 {
+		t.Errorf("diff = %+v, want one added and one removed", diff)
+	}
+}
+
+func TestHasRecords(t *testing.T) {
+	storage, err := NewMemoryStorage([]Record{{Domain: "deep.ent.test", Type: A, Value: "10.0.0.1", TTL: 60}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !storage.HasRecords("Deep.Ent.Test") {
+		t.Error("name with records reported empty")
+	}
+	// An empty non-terminal exists but holds no records
+	if !storage.HasName("ent.test") || storage.HasRecords("ent.test") {
+		t.Error("empty non-terminal reported with records")
+	}
+}
+
+// contents returns every record of s as "<domain> <type> <data>" lines
+func contents(s *Storage) []string {
+	var lines []string
+	for _, record := range s.List() {
+		lines = append(lines, fmt.Sprintf("%s %s %s", record.Domain, record.Type, record.Data()))
+	}
+	return lines
+}
+
+// newRecordSets returns a storage holding two A records and one AAAA
+// record at web.test and an A record at api.test
+func newRecordSets(t *testing.T) *Storage {
+	t.Helper()
+	storage, err := NewMemoryStorage([]Record{
+		{Domain: "web.test", Type: A, Value: "10.0.0.1", TTL: 60},
+		{Domain: "web.test", Type: A, Value: "10.0.0.2", TTL: 60},
+		{Domain: "web.test", Type: AAAA, Value: "fd00::1", TTL: 60},
+		{Domain: "api.test", Type: A, Value: "10.0.0.1", TTL: 60},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storage
+}
+
+func TestAddRecordSets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dns.json")
+	storage, err := NewStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, value := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		if err := storage.Add("web.test", A, value, 60); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Adding a value again keeps one copy and sets the TTL of the set
+	if err := storage.Add("WEB.test.", A, "10.0.0.2", 120); err != nil {
+		t.Fatal(err)
+	}
+
+	sets := storage.Sets()
+	if len(sets) != 1 || sets[0].Domain != "web.test." || sets[0].Type != A || sets[0].TTL != 120 {
+		t.Fatalf("sets = %+v, want one A set at web.test. with TTL 120", sets)
+	}
+	var values []string
+	for _, record := range sets[0].Records {
+		values = append(values, record.Value)
+		if record.TTL != 120 {
+			t.Errorf("%s has TTL %d, want the set TTL 120", record.Value, record.TTL)
+		}
+	}
+	if got := strings.Join(values, ","); got != "10.0.0.1,10.0.0.2,10.0.0.3" {
+		t.Errorf("values %s, want the three addresses in the order added", got)
+	}
+
+	// The sets are saved as they are held
+	reopened, err := NewStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := contents(reopened), contents(storage); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("reopened storage holds %q, want %q", got, want)
+	}
+}
+
+func TestGetRecords(t *testing.T) {
+	storage := newRecordSets(t)
+
+	tests := []struct {
+		name       string
+		domain     string
+		recordType RecordType
+		value      string
+		want       []string
+	}{
+		{"whole set", "web.test", A, "", []string{"10.0.0.1", "10.0.0.2"}},
+		{"one value", "web.test", A, "10.0.0.2", []string{"10.0.0.2"}},
+		{"name case and trailing dot", "Web.Test.", A, "10.0.0.1", []string{"10.0.0.1"}},
+		{"value not in set", "web.test", A, "10.0.0.9", nil},
+		{"other type", "web.test", AAAA, "", []string{"fd00::1"}},
+		{"type not at name", "api.test", AAAA, "", nil},
+		{"unknown name", "other.test", A, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, ok := storage.Get(tt.domain, tt.recordType, tt.value)
+			var values []string
+			for _, record := range records {
+				values = append(values, record.Value)
+			}
+			if ok != (tt.want != nil) || strings.Join(values, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Get = %q, %v, want %q", values, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveRecords(t *testing.T) {
+	tests := []struct {
+		name       string
+		domain     string
+		recordType RecordType
+		value      string
+		wantErr    bool
+		want       []string
+	}{
+		{"one value", "web.test", A, "10.0.0.1", false, []string{
+			"api.test. A 10.0.0.1",
+			"web.test. A 10.0.0.2",
+			"web.test. AAAA fd00::1",
+		}},
+		{"whole set", "web.test", A, "", false, []string{
+			"api.test. A 10.0.0.1",
+			"web.test. AAAA fd00::1",
+		}},
+		{"every type at the name", "web.test", "", "", false, []string{
+			"api.test. A 10.0.0.1",
+		}},
+		{"value across types", "web.test", "", "fd00::1", false, []string{
+			"api.test. A 10.0.0.1",
+			"web.test. A 10.0.0.1",
+			"web.test. A 10.0.0.2",
+		}},
+		{"value not in set", "web.test", A, "10.0.0.9", true, nil},
+		{"type not at name", "api.test", AAAA, "", true, nil},
+		{"unknown name", "other.test", "", "", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newRecordSets(t)
+			before := contents(storage)
+
+			err := storage.Remove(tt.domain, tt.recordType, tt.value)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "record not found") {
+					t.Errorf("error = %v, want record not found", err)
+				}
+				if got := contents(storage); strings.Join(got, "\n") != strings.Join(before, "\n") {
+					t.Errorf("failed remove changed the records to %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := contents(storage); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("records %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddressValidation(t *testing.T) {
+	tests := []struct {
+		recordType RecordType
+		value      string
+		valid      bool
+	}{
+		{A, "10.0.0.1", true},
+		{A, "fd00::1", false},
+		{A, "::ffff:10.0.0.1", false},
+		{A, "10.0.0", false},
+		{A, "web.test", false},
+		{A, "", false},
+		{AAAA, "fd00::1", true},
+		{AAAA, "2001:db8::10:1", true},
+		{AAAA, "::ffff:10.0.0.1", true},
+		{AAAA, "10.0.0.1", false},
+		{AAAA, "fd00::zz", false},
+		{AAAA, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %s", tt.recordType, tt.value), func(t *testing.T) {
+			storage, err := NewMemoryStorage(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = storage.Add("web.test", tt.recordType, tt.value, 60)
+			if tt.valid && err != nil {
+				t.Errorf("rejected: %v", err)
+			}
+			if !tt.valid && (err == nil || !strings.Contains(err.Error(), "invalid IPv")) {
+				t.Errorf("error = %v, want an invalid address error", err)
+			}
+		})
+	}
+}
+
+func TestRecordValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		record Record
+		want   string
+	}{
+		{"MX", Record{Domain: "mail.test", Type: MX, Value: "mx.mail.test", Priority: 10}, ""},
+		{"MX without exchange", Record{Domain: "mail.test", Type: MX, Priority: 10}, "invalid MX exchange"},
+		{"MX with wildcard exchange", Record{Domain: "mail.test", Type: MX, Value: "*.mail.test"}, "invalid MX exchange"},
+		{"SRV", Record{Domain: "_sip._tcp.web.test", Type: SRV, Value: "sip.web.test", Priority: 10, Weight: 5, Port: 5060}, ""},
+		{"SRV service unavailable", Record{Domain: "_sip._tcp.web.test", Type: SRV, Value: "."}, ""},
+		{"SRV without port", Record{Domain: "_sip._tcp.web.test", Type: SRV, Value: "sip.web.test"}, "needs a port"},
+		{"SRV without service label", Record{Domain: "_tcp.web.test", Type: SRV, Value: "sip.web.test", Port: 5060}, "_service._proto.name"},
+		{"SRV without underscores", Record{Domain: "sip.tcp.web.test", Type: SRV, Value: "sip.web.test", Port: 5060}, "_service._proto.name"},
+		{"SRV under wildcard", Record{Domain: "*._sip._tcp.web.test", Type: SRV, Value: "sip.web.test", Port: 5060}, ""},
+		{"SRV invalid target", Record{Domain: "_sip._tcp.web.test", Type: SRV, Value: "bad..target", Port: 5060}, "invalid SRV target"},
+		{"CAA issue", Record{Domain: "web.test", Type: CAA, Tag: "issue", Value: "ca.test"}, ""},
+		{"CAA critical", Record{Domain: "web.test", Type: CAA, Flag: 128, Tag: "issuewild", Value: "ca.test"}, ""},
+		{"CAA tag case", Record{Domain: "web.test", Type: CAA, Tag: "IODEF", Value: "mailto:ca@web.test"}, ""},
+		{"CAA invalid flag", Record{Domain: "web.test", Type: CAA, Flag: 1, Tag: "issue", Value: "ca.test"}, "invalid CAA flag"},
+		{"CAA without tag", Record{Domain: "web.test", Type: CAA, Value: "ca.test"}, "invalid CAA tag"},
+		{"CAA tag with symbols", Record{Domain: "web.test", Type: CAA, Tag: "issue-wild", Value: "ca.test"}, "invalid CAA tag"},
+		{"TXT", Record{Domain: "web.test", Type: TXT, Text: []string{"v=spf1 -all"}}, ""},
+		{"TXT without text", Record{Domain: "web.test", Type: TXT}, "at least one string"},
+		{"PTR", Record{Domain: "1.0.0.10.in-addr.arpa", Type: PTR, Value: "web.test"}, ""},
+		{"PTR without target", Record{Domain: "1.0.0.10.in-addr.arpa", Type: PTR}, "invalid PTR target"},
+		{"NS", Record{Domain: "sub.test", Type: NS, Value: "ns1.sub.test"}, ""},
+		{"NS without name", Record{Domain: "sub.test", Type: NS}, "invalid NS name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, err := NewMemoryStorage(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.record.TTL = 60
+			err = storage.AddRecord(tt.record)
+			if tt.want == "" && err != nil {
+				t.Errorf("rejected: %v", err)
+			}
+			if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTXTSplitting(t *testing.T) {
+	long := strings.Repeat("a", txtStringLimit) + strings.Repeat("b", txtStringLimit) + "c"
+	tests := []struct {
+		name string
+		text []string
+		want []int
+	}{
+		{"short", []string{"v=spf1 -all"}, []int{11}},
+		{"at the limit", []string{strings.Repeat("a", txtStringLimit)}, []int{txtStringLimit}},
+		{"over the limit", []string{long}, []int{txtStringLimit, txtStringLimit, 1}},
+		{"several strings", []string{"first", long}, []int{5, txtStringLimit, txtStringLimit, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, err := NewMemoryStorage([]Record{{Domain: "web.test", Type: TXT, Text: tt.text, TTL: 60}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			records, _ := storage.Get("web.test", TXT, "")
+			var lengths []int
+			for _, text := range records[0].Text {
+				lengths = append(lengths, len(text))
+			}
+			if fmt.Sprint(lengths) != fmt.Sprint(tt.want) {
+				t.Errorf("string lengths %v, want %v", lengths, tt.want)
+			}
+			// Splitting keeps the text, which is what it matches by
+			if got := strings.Join(records[0].Text, ""); got != strings.Join(tt.text, "") {
+				t.Errorf("text changed to %q", got)
+			}
+			if _, ok := storage.Get("web.test", TXT, strings.Join(tt.text, "")); !ok {
+				t.Error("record not found by its text")
+			}
+		})
+	}
+}
+
+func TestRemoveByText(t *testing.T) {
+	long := strings.Repeat("k", 300)
+	tests := []struct {
+		name       string
+		recordType RecordType
+		value      string
+	}{
+		{"TXT text", TXT, "v=spf1 -all"},
+		{"TXT quoted data", TXT, `"v=spf1 -all"`},
+		{"TXT text over the limit", TXT, long},
+		{"TXT text without type", "", "v=spf1 -all"},
+		{"CAA value", CAA, "ca.test"},
+		{"CAA quoted data", CAA, `0 issue "ca.test"`},
+		{"CAA data", CAA, "0 issue ca.test"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, err := NewMemoryStorage([]Record{
+				{Domain: "t.local", Type: TXT, Text: []string{"v=spf1 -all"}, TTL: 60},
+				{Domain: "t.local", Type: TXT, Text: []string{long}, TTL: 60},
+				{Domain: "t.local", Type: TXT, Text: []string{"keep"}, TTL: 60},
+				{Domain: "t.local", Type: CAA, Tag: "issue", Value: "ca.test", TTL: 60},
+				{Domain: "t.local", Type: CAA, Tag: "iodef", Value: "mailto:ca@t.local", TTL: 60},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := len(storage.List())
+			if err := storage.Remove("t.local", tt.recordType, tt.value); err != nil {
+				t.Fatal(err)
+			}
+			if after := len(storage.List()); after != before-1 {
+				t.Errorf("%d records removed, want 1", before-after)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package dnsrecords
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultTTL applies to zone file records without a TTL or $TTL
+const DefaultTTL = 3600
+
+// yamlFile is the YAML record format of dns.yaml
+type yamlFile struct {
+	Records []Record `yaml:"records"`
+}
+
+// FromRR converts a resource record to a Record. It fails for record
+// types the storage does not hold.
+func FromRR(rr dns.RR) (Record, error) {
+	hdr := rr.Header()
+	record := Record{
+		Domain: normalizeDomain(hdr.Name),
+		Type:   RecordType(dns.TypeToString[hdr.Rrtype]),
+		TTL:    hdr.Ttl,
+	}
+
+	switch rr := rr.(type) {
+	case *dns.A:
+		record.Value = rr.A.String()
+	case *dns.AAAA:
+		record.Value = rr.AAAA.String()
+	case *dns.CNAME:
+		record.Value = rr.Target
+	case *dns.TXT:
+		record.Text = rr.Txt
+	case *dns.MX:
+		record.Value = rr.Mx
+		record.Priority = rr.Preference
+	case *dns.SRV:
+		record.Value = rr.Target
+		record.Priority = rr.Priority
+		record.Weight = rr.Weight
+		record.Port = rr.Port
+	case *dns.PTR:
+		record.Value = rr.Ptr
+	case *dns.CAA:
+		record.Value = rr.Value
+		record.Flag = rr.Flag
+		record.Tag = rr.Tag
+	case *dns.NS:
+		record.Value = rr.Ns
+	default:
+		return record, fmt.Errorf("unsupported record type: %s", record.Type)
+	}
+
+	return record, nil
+}
+
+// ParseZone reads records from an RFC 1035 master file. Relative names are
+// completed with origin until a $ORIGIN directive changes it, records
+// without a TTL get the $TTL value or DefaultTTL. Records of unsupported
+// types, such as the SOA, are returned separately so callers can report
+// them.
+func ParseZone(r io.Reader, origin, filename string) ([]Record, []dns.RR, error) {
+	zp := dns.NewZoneParser(r, dns.Fqdn(origin), filename)
+	zp.SetDefaultTTL(DefaultTTL)
+
+	var records []Record
+	var skipped []dns.RR
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		record, err := FromRR(rr)
+		if err != nil {
+			skipped = append(skipped, rr)
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse zone file: %w", err)
+	}
+
+	return records, skipped, nil
+}
+
+// WriteZone writes records as an RFC 1035 master file. Names at or below
+// a non-empty origin are written relative to it after a $ORIGIN line.
+func WriteZone(w io.Writer, records []Record, origin string) error {
+	bw := bufio.NewWriter(w)
+
+	if origin != "" {
+		origin = normalizeDomain(origin)
+		fmt.Fprintf(bw, "$ORIGIN %s\n", origin)
+	}
+
+	for _, record := range records {
+		name := record.Domain
+		if origin != "" {
+			name = relativeName(record.Domain, origin)
+		}
+		fmt.Fprintf(bw, "%s\t%d\tIN\t%s\t%s\n", name, record.TTL, record.Type, record.Data())
+	}
+
+	return bw.Flush()
+}
+
+// relativeName returns domain relative to origin, "@" for origin itself,
+// or the absolute name if domain is outside origin
+func relativeName(domain, origin string) string {
+	switch {
+	case domain == origin:
+		return "@"
+	case origin == ".":
+		return domain
+	case strings.HasSuffix(domain, "."+origin):
+		return strings.TrimSuffix(domain, "."+origin)
+	}
+	return domain
+}
+
+// yamlRecord decodes a Record of dns.yaml, giving DefaultTTL to entries
+// without a ttl while keeping an explicit ttl of 0
+type yamlRecord Record
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (r *yamlRecord) UnmarshalYAML(node *yaml.Node) error {
+	type plain Record
+	record := plain{TTL: DefaultTTL}
+	if err := node.Decode(&record); err != nil {
+		return err
+	}
+	*r = yamlRecord(record)
+	return nil
+}
+
+// ParseYAML reads records in the format of dns.yaml, a records list of
+// domain, type, value and ttl entries plus the fields of the other types.
+// Entries without a ttl get DefaultTTL.
+func ParseYAML(r io.Reader) ([]Record, error) {
+	var file struct {
+		Records []yamlRecord `yaml:"records"`
+	}
+	if err := yaml.NewDecoder(r).Decode(&file); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to parse records: %w", err)
+	}
+
+	records := make([]Record, len(file.Records))
+	for i, record := range file.Records {
+		records[i] = Record(record)
+	}
+	return records, nil
+}
+
+// WriteYAML writes records in the format read by ParseYAML
+func WriteYAML(w io.Writer, records []Record) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(yamlFile{Records: records}); err != nil {
+		return fmt.Errorf("failed to write records: %w", err)
+	}
+	return encoder.Close()
+}
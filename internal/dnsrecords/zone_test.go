@@ -0,0 +1,187 @@
+package dnsrecords
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// exampleZone uses directives, relative, absolute and "@" names and every
+// type with fields besides the value
+const exampleZone = `$ORIGIN example.test.
+$TTL 300
+@	IN	SOA	ns.example.test. admin.example.test. 1 3600 600 86400 300
+@	IN	NS	ns
+www	IN	A	10.0.0.1
+www.other.test.	60	IN	AAAA	fd00::1
+txt	IN	TXT	"first part" "second part"
+@	IN	MX	10 mail
+_sip._tcp	IN	SRV	10 20 5060 sip
+@	IN	CAA	0 issue "ca.example"
+$ORIGIN sub.example.test.
+api	IN	CNAME	www.example.test.
+`
+
+// exampleRecords are the records of exampleZone
+var exampleRecords = []Record{
+	{Domain: "example.test.", Type: NS, Value: "ns.example.test.", TTL: 300},
+	{Domain: "www.example.test.", Type: A, Value: "10.0.0.1", TTL: 300},
+	{Domain: "www.other.test.", Type: AAAA, Value: "fd00::1", TTL: 60},
+	{Domain: "txt.example.test.", Type: TXT, Text: []string{"first part", "second part"}, TTL: 300},
+	{Domain: "example.test.", Type: MX, Value: "mail.example.test.", Priority: 10, TTL: 300},
+	{Domain: "_sip._tcp.example.test.", Type: SRV, Value: "sip.example.test.", Priority: 10, Weight: 20, Port: 5060, TTL: 300},
+	{Domain: "example.test.", Type: CAA, Value: "ca.example", Tag: "issue", TTL: 300},
+	{Domain: "api.sub.example.test.", Type: CNAME, Value: "www.example.test.", TTL: 300},
+}
+
+func TestParseZone(t *testing.T) {
+	records, skipped, err := ParseZone(strings.NewReader(exampleZone), "", "example.zone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(records, exampleRecords) {
+		t.Errorf("records = %+v, want %+v", records, exampleRecords)
+	}
+	if len(skipped) != 1 || skipped[0].Header().Rrtype != dns.TypeSOA {
+		t.Errorf("skipped = %v, want the SOA", skipped)
+	}
+}
+
+func TestParseZoneOriginAndTTL(t *testing.T) {
+	tests := []struct {
+		name   string
+		zone   string
+		origin string
+		want   Record
+	}{
+		{"origin argument", "www IN A 10.0.0.1\n", "example.test", Record{Domain: "www.example.test.", Type: A, Value: "10.0.0.1", TTL: DefaultTTL}},
+		{"$ORIGIN overrides argument", "$ORIGIN other.test.\nwww IN A 10.0.0.1\n", "example.test", Record{Domain: "www.other.test.", Type: A, Value: "10.0.0.1", TTL: DefaultTTL}},
+		{"absolute name", "www.other.test. IN A 10.0.0.1\n", "example.test", Record{Domain: "www.other.test.", Type: A, Value: "10.0.0.1", TTL: DefaultTTL}},
+		{"no origin", "www.example.test IN A 10.0.0.1\n", "", Record{Domain: "www.example.test.", Type: A, Value: "10.0.0.1", TTL: DefaultTTL}},
+		{"$TTL", "$TTL 60\nwww.example.test. IN A 10.0.0.1\n", "", Record{Domain: "www.example.test.", Type: A, Value: "10.0.0.1", TTL: 60}},
+		{"record TTL", "$TTL 60\nwww.example.test. 0 IN A 10.0.0.1\n", "", Record{Domain: "www.example.test.", Type: A, Value: "10.0.0.1", TTL: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, _, err := ParseZone(strings.NewReader(tt.zone), tt.origin, "test.zone")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 || !reflect.DeepEqual(records[0], tt.want) {
+				t.Errorf("records = %+v, want %+v", records, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseZoneInvalid(t *testing.T) {
+	if _, _, err := ParseZone(strings.NewReader("www IN A not-an-ip\n"), "example.test", "bad.zone"); err == nil {
+		t.Fatal("invalid zone file parsed")
+	}
+}
+
+func TestWriteZone(t *testing.T) {
+	tests := []struct {
+		name   string
+		origin string
+		lines  []string
+	}{
+		{"relative", "example.test", []string{
+			"$ORIGIN example.test.",
+			"@\t300\tIN\tNS\tns.example.test.",
+			"www\t300\tIN\tA\t10.0.0.1",
+			"www.other.test.\t60\tIN\tAAAA\tfd00::1",
+			"txt\t300\tIN\tTXT\t\"first part\" \"second part\"",
+			"@\t300\tIN\tMX\t10 mail.example.test.",
+			"_sip._tcp\t300\tIN\tSRV\t10 20 5060 sip.example.test.",
+			"@\t300\tIN\tCAA\t0 issue \"ca.example\"",
+			"api.sub\t300\tIN\tCNAME\twww.example.test.",
+		}},
+		{"absolute", "", []string{
+			"example.test.\t300\tIN\tNS\tns.example.test.",
+			"www.example.test.\t300\tIN\tA\t10.0.0.1",
+			"www.other.test.\t60\tIN\tAAAA\tfd00::1",
+			"txt.example.test.\t300\tIN\tTXT\t\"first part\" \"second part\"",
+			"example.test.\t300\tIN\tMX\t10 mail.example.test.",
+			"_sip._tcp.example.test.\t300\tIN\tSRV\t10 20 5060 sip.example.test.",
+			"example.test.\t300\tIN\tCAA\t0 issue \"ca.example\"",
+			"api.sub.example.test.\t300\tIN\tCNAME\twww.example.test.",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteZone(&buf, exampleRecords, tt.origin); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := buf.String(), strings.Join(tt.lines, "\n")+"\n"; got != want {
+				t.Errorf("zone file:\n%s\nwant:\n%s", got, want)
+			}
+
+			// Reading the file back, without the origin, gives the same records
+			records, _, err := ParseZone(&buf, "", "test.zone")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(records, exampleRecords) {
+				t.Errorf("records read back = %+v, want %+v", records, exampleRecords)
+			}
+		})
+	}
+}
+
+func TestYAMLRoundTrip(t *testing.T) {
+	records := append([]Record{{Domain: "nocache.example.test.", Type: A, Value: "10.0.0.2", TTL: 0}}, exampleRecords...)
+
+	var buf bytes.Buffer
+	if err := WriteYAML(&buf, records); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseYAML(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, records) {
+		t.Errorf("records read back = %+v, want %+v", got, records)
+	}
+}
+
+func TestParseYAMLTTL(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  string
+		want uint32
+	}{
+		{"missing", "", DefaultTTL},
+		{"zero", "\n    ttl: 0", 0},
+		{"set", "\n    ttl: 60", 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := "records:\n  - domain: www.example.test\n    type: A\n    value: 10.0.0.1" + tt.ttl + "\n"
+			records, err := ParseYAML(strings.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 || records[0].TTL != tt.want {
+				t.Errorf("records = %+v, want TTL %d", records, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLEmpty(t *testing.T) {
+	records, err := ParseYAML(strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("records = %+v, want none", records)
+	}
+	if _, err := ParseYAML(strings.NewReader("records: [")); err == nil {
+		t.Error("invalid YAML parsed")
+	}
+}
@@ -0,0 +1,305 @@
+// Package probe connects to TLS endpoints and reports what was negotiated,
+// what the server presented and why verification failed
+package probe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	gotls "github.com/bxtal-lsn/gotransport/pkg/tls"
+	"golang.org/x/crypto/ocsp"
+)
+
+// DefaultTimeout bounds each connection attempt
+const DefaultTimeout = 10 * time.Second
+
+// Alerts sent by the server that point at a specific misconfiguration.
+// crypto/tls reports them as "remote error: tls: <description>".
+var (
+	clientCertAlerts = []string{"bad certificate", "certificate required", "unknown certificate authority", "expired certificate"}
+	negotiateAlerts  = []string{"handshake failure", "protocol version not supported", "insufficient security level"}
+)
+
+// Options describes the endpoint and how to connect to it
+type Options struct {
+	// Address is host:port
+	Address string
+	// TLS supplies the server name, CA and client certificate. An empty
+	// ServerName defaults to the host in Address.
+	TLS        gotls.Config
+	NextProtos []string
+	Timeout    time.Duration
+}
+
+// Result is what a single handshake revealed
+type Result struct {
+	ServerName  string
+	Version     uint16
+	CipherSuite uint16
+	ALPN        string
+	// Chain is every certificate the server presented, leaf first
+	Chain []*x509.Certificate
+	// OCSP is nil when the server did not staple a response
+	OCSP *OCSPStatus
+	// ClientCertRequested is set when the server sent a CertificateRequest,
+	// AcceptableCAs lists the CA names it included
+	ClientCertRequested bool
+	AcceptableCAs       []string
+	ClientCertSent      bool
+	// ClientCertErr is set when the server rejected the client certificate
+	// after the handshake, as TLS 1.3 servers do
+	ClientCertErr error
+	// HandshakeErr is set when the handshake failed, in which case only the
+	// client certificate fields may be filled in
+	HandshakeErr error
+	// VerifyErr is set when the presented chain failed verification
+	VerifyErr error
+}
+
+// ClientCertError is a handshake failure after the server requested a
+// client certificate. The server got past version and cipher negotiation,
+// so it rejected the certificate sent or its absence, whatever alert it
+// chose to say so: TLS 1.2 servers often send a bare handshake failure.
+type ClientCertError struct {
+	Err error
+}
+
+func (e *ClientCertError) Error() string { return e.Err.Error() }
+
+func (e *ClientCertError) Unwrap() error { return e.Err }
+
+// OCSPStatus is a parsed stapled OCSP response
+type OCSPStatus struct {
+	Status     string
+	ThisUpdate time.Time
+	NextUpdate time.Time
+	RevokedAt  time.Time
+	Err        error
+}
+
+// Probe performs one handshake with the endpoint. The chain is verified
+// after the handshake so that everything the server presented is reported
+// even when verification fails. An error is only returned when the client
+// configuration is invalid.
+func Probe(opts Options) (*Result, error) {
+	tlsConfig, serverName, err := clientConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{ServerName: serverName}
+	roots := tlsConfig.RootCAs
+	observe(tlsConfig, result)
+
+	conn, err := dial(opts, tlsConfig)
+	if err != nil {
+		if result.ClientCertRequested {
+			err = &ClientCertError{Err: err}
+		}
+		result.HandshakeErr = err
+		return result, nil
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	result.Version = state.Version
+	result.CipherSuite = state.CipherSuite
+	result.ALPN = state.NegotiatedProtocol
+	result.Chain = state.PeerCertificates
+	result.VerifyErr = verifyChain(state.PeerCertificates, roots, serverName)
+
+	if len(state.OCSPResponse) > 0 && len(state.PeerCertificates) > 0 {
+		result.OCSP = parseOCSP(state.OCSPResponse, state.PeerCertificates)
+	}
+
+	// TLS 1.3 servers check the client certificate after the client
+	// considers the handshake complete, a rejection arrives as an alert
+	if result.ClientCertRequested && state.Version == tls.VersionTLS13 {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err != nil && !isTimeout(err) && !errors.Is(err, io.EOF) {
+			result.ClientCertErr = err
+		}
+	}
+
+	return result, nil
+}
+
+// clientConfig builds the TLS configuration used for probing. Verification
+// is disabled in crypto/tls and done by verifyChain instead.
+func clientConfig(opts Options) (*tls.Config, string, error) {
+	cfg := opts.TLS
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(opts.Address)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid address %q: %w", opts.Address, err)
+		}
+		cfg.ServerName = host
+	}
+
+	tlsConfig, err := gotls.NewClientTLSConfig(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	tlsConfig.InsecureSkipVerify = true
+	tlsConfig.VerifyPeerCertificate = nil
+	tlsConfig.NextProtos = opts.NextProtos
+
+	return tlsConfig, cfg.ServerName, nil
+}
+
+// observe records the server's certificate request in result
+func observe(tlsConfig *tls.Config, result *Result) {
+	certs := tlsConfig.Certificates
+	tlsConfig.Certificates = nil
+	tlsConfig.GetClientCertificate = func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		result.ClientCertRequested = true
+		result.AcceptableCAs = make([]string, 0, len(info.AcceptableCAs))
+		for _, der := range info.AcceptableCAs {
+			result.AcceptableCAs = append(result.AcceptableCAs, distinguishedName(der))
+		}
+
+		if len(certs) == 0 {
+			return &tls.Certificate{}, nil
+		}
+		result.ClientCertSent = true
+		return &certs[0], nil
+	}
+}
+
+func dial(opts Options, tlsConfig *tls.Config) (*tls.Conn, error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", opts.Address, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// verifyChain verifies the presented chain the way a gotransport client
+// would. Nil roots use the system pool.
+func verifyChain(chain []*x509.Certificate, roots *x509.CertPool, serverName string) error {
+	if len(chain) == 0 {
+		return fmt.Errorf("server presented no certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		DNSName:       serverName,
+	})
+	return err
+}
+
+func parseOCSP(raw []byte, chain []*x509.Certificate) *OCSPStatus {
+	var issuer *x509.Certificate
+	if len(chain) > 1 {
+		issuer = chain[1]
+	}
+
+	resp, err := ocsp.ParseResponseForCert(raw, chain[0], issuer)
+	if err != nil {
+		return &OCSPStatus{Status: "invalid", Err: err}
+	}
+
+	status := &OCSPStatus{
+		ThisUpdate: resp.ThisUpdate,
+		NextUpdate: resp.NextUpdate,
+		RevokedAt:  resp.RevokedAt,
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		status.Status = "good"
+	case ocsp.Revoked:
+		status.Status = "revoked"
+	default:
+		status.Status = "unknown"
+	}
+	return status
+}
+
+// Hint explains a handshake or verification error in terms of what to
+// change, or returns an empty string
+func Hint(err error) string {
+	var unknown x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var clientCert *ClientCertError
+
+	switch {
+	case errors.As(err, &clientCert), isRemoteAlert(err, clientCertAlerts):
+		return "the server rejected the client certificate, pass one issued by a CA it accepts with --client-cert and --client-key"
+	case isRemoteAlert(err, negotiateAlerts):
+		return "the server shares no protocol version or cipher suite with the client profile, run with --scan to see what it supports"
+	case errors.As(err, &unknown):
+		return "the chain does not lead to a trusted CA, pass the issuing CA with --ca or check the server sends its intermediates"
+	case errors.As(err, &hostname):
+		names := append([]string{}, hostname.Certificate.DNSNames...)
+		for _, ip := range hostname.Certificate.IPAddresses {
+			names = append(names, ip.String())
+		}
+		if len(names) == 0 {
+			return "the certificate has no subject alternative names, reissue it with dnsNames"
+		}
+		return fmt.Sprintf("the certificate is valid for %s, connect with --sni set to one of them", strings.Join(names, ", "))
+	case errors.As(err, &invalid):
+		switch invalid.Reason {
+		case x509.Expired:
+			return "a certificate in the chain is expired or not yet valid, check the dates below and the clocks of both hosts"
+		case x509.IncompatibleUsage:
+			return "the certificate is not allowed for server authentication (extended key usage)"
+		case x509.NotAuthorizedToSign:
+			return "a certificate in the chain is not a CA but signed another certificate"
+		}
+	}
+	return ""
+}
+
+// distinguishedName formats a DER encoded name from a certificate request
+func distinguishedName(der []byte) string {
+	var rdn pkix.RDNSequence
+	if rest, err := asn1.Unmarshal(der, &rdn); err != nil || len(rest) > 0 {
+		return hex.EncodeToString(der)
+	}
+
+	var name pkix.Name
+	name.FillFromRDNSequence(&rdn)
+	return name.String()
+}
+
+// isRemoteAlert reports whether err is one of the alerts sent by the peer
+func isRemoteAlert(err error, alerts []string) bool {
+	msg := err.Error()
+	if !strings.Contains(msg, "remote error: tls: ") {
+		return false
+	}
+	for _, alert := range alerts {
+		if strings.HasSuffix(msg, alert) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,207 @@
+package probe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bxtal-lsn/gotransport/pkg/pkitest"
+	gotls "github.com/bxtal-lsn/gotransport/pkg/tls"
+)
+
+// serve accepts TLS connections with cfg on a local port and returns its
+// address. Each connection is held open until the client closes it.
+func serve(t *testing.T, cfg *tls.Config) string {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if err := conn.(*tls.Conn).Handshake(); err == nil {
+					io.Copy(io.Discard, conn)
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// writePEM writes data to a file in a temporary directory
+func writePEM(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProbe(t *testing.T) {
+	ca := pkitest.NewCA("Server CA")
+	caPath := writePEM(t, "ca.crt", ca.CertPEM())
+	otherCAPath := writePEM(t, "other.crt", pkitest.NewCA("Other CA").CertPEM())
+	good := serve(t, pkitest.ServerConfig(ca.Server("web.test"), nil))
+	expired := serve(t, pkitest.ServerConfig(ca.Expired("web.test"), nil))
+
+	tests := []struct {
+		name       string
+		address    string
+		serverName string
+		caPath     string
+		verifyErr  error
+		hint       string
+	}{
+		{"verified", good, "web.test", caPath, nil, ""},
+		{"hostname mismatch", good, "other.test", caPath, x509.HostnameError{}, "the certificate is valid for web.test, connect with --sni set to one of them"},
+		{"unknown CA", good, "web.test", otherCAPath, x509.UnknownAuthorityError{}, "pass the issuing CA with --ca"},
+		{"expired leaf", expired, "web.test", caPath, x509.CertificateInvalidError{}, "expired or not yet valid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Probe(Options{Address: tt.address, TLS: gotls.Config{CAPath: tt.caPath, ServerName: tt.serverName}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The handshake succeeds and reports the chain whether or not
+			// it verifies
+			if result.HandshakeErr != nil {
+				t.Fatalf("handshake error: %v", result.HandshakeErr)
+			}
+			if result.ServerName != tt.serverName || result.Version != tls.VersionTLS13 || len(result.Chain) != 1 {
+				t.Errorf("server name %q, version %s, %d certificates", result.ServerName, tls.VersionName(result.Version), len(result.Chain))
+			}
+			if result.ClientCertRequested {
+				t.Error("client certificate request reported")
+			}
+
+			switch want := tt.verifyErr.(type) {
+			case nil:
+				if result.VerifyErr != nil {
+					t.Errorf("verify error: %v", result.VerifyErr)
+				}
+			case x509.HostnameError:
+				if !errors.As(result.VerifyErr, &want) {
+					t.Errorf("verify error %v, want a hostname error", result.VerifyErr)
+				}
+			case x509.UnknownAuthorityError:
+				if !errors.As(result.VerifyErr, &want) {
+					t.Errorf("verify error %v, want an unknown authority error", result.VerifyErr)
+				}
+			case x509.CertificateInvalidError:
+				if !errors.As(result.VerifyErr, &want) || want.Reason != x509.Expired {
+					t.Errorf("verify error %v, want an expired certificate", result.VerifyErr)
+				}
+			}
+
+			if hint := hintFor(result.VerifyErr); !strings.Contains(hint, tt.hint) || (tt.hint == "") != (hint == "") {
+				t.Errorf("hint %q, want %q", hint, tt.hint)
+			}
+		})
+	}
+}
+
+// hintFor returns the hint for err, or "" for nil
+func hintFor(err error) string {
+	if err == nil {
+		return ""
+	}
+	return Hint(err)
+}
+
+func TestProbeClientCertRequested(t *testing.T) {
+	serverCA := pkitest.NewCA("Server CA")
+	clientCA := pkitest.NewCA("Client CA")
+	client := clientCA.Client("client")
+	caPath := writePEM(t, "ca.crt", serverCA.CertPEM())
+	certPath := writePEM(t, "client.crt", client.CertPEM())
+	keyPath := writePEM(t, "client.key", client.KeyPEM())
+	const clientCertHint = "the server rejected the client certificate"
+
+	for _, version := range []uint16{tls.VersionTLS12, tls.VersionTLS13} {
+		cfg := pkitest.ServerConfig(serverCA.Server("web.test"), clientCA)
+		cfg.MaxVersion = version
+		address := serve(t, cfg)
+
+		t.Run(tls.VersionName(version)+" without certificate", func(t *testing.T) {
+			result, err := Probe(Options{Address: address, TLS: gotls.Config{CAPath: caPath, ServerName: "web.test"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.ClientCertRequested || result.ClientCertSent {
+				t.Errorf("requested %v, sent %v", result.ClientCertRequested, result.ClientCertSent)
+			}
+			if len(result.AcceptableCAs) != 1 || result.AcceptableCAs[0] != "CN=Client CA" {
+				t.Errorf("acceptable CAs %q, want CN=Client CA", result.AcceptableCAs)
+			}
+
+			// TLS 1.2 servers reject the missing certificate during the
+			// handshake, TLS 1.3 servers after it
+			rejection := result.HandshakeErr
+			if version == tls.VersionTLS13 {
+				if result.HandshakeErr != nil {
+					t.Fatalf("handshake error: %v", result.HandshakeErr)
+				}
+				rejection = result.ClientCertErr
+			}
+			if rejection == nil {
+				t.Fatal("rejection not reported")
+			}
+			if hint := Hint(rejection); !strings.Contains(hint, clientCertHint) {
+				t.Errorf("hint %q for %v, want the client certificate hint", hint, rejection)
+			}
+		})
+
+		t.Run(tls.VersionName(version)+" with certificate", func(t *testing.T) {
+			result, err := Probe(Options{Address: address, TLS: gotls.Config{CAPath: caPath, ServerName: "web.test", CertPath: certPath, KeyPath: keyPath}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.ClientCertRequested || !result.ClientCertSent {
+				t.Errorf("requested %v, sent %v", result.ClientCertRequested, result.ClientCertSent)
+			}
+			if result.HandshakeErr != nil || result.ClientCertErr != nil || result.VerifyErr != nil {
+				t.Errorf("handshake %v, client certificate %v, verify %v", result.HandshakeErr, result.ClientCertErr, result.VerifyErr)
+			}
+		})
+	}
+}
+
+func TestProbeInvalidAddress(t *testing.T) {
+	if _, err := Probe(Options{Address: "web.test"}); err == nil {
+		t.Error("probed an address without a port")
+	}
+}
+
+func TestProbeConnectionRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	result, err := Probe(Options{Address: address})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.HandshakeErr == nil || result.Chain != nil {
+		t.Errorf("handshake error %v with %d certificates", result.HandshakeErr, len(result.Chain))
+	}
+}
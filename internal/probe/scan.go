@@ -0,0 +1,118 @@
+package probe
+
+import (
+	"crypto/tls"
+)
+
+// Support reports whether the server accepted a protocol version or cipher
+// suite
+type Support struct {
+	ID        uint16
+	Name      string
+	Supported bool
+	Err       error
+}
+
+// versions are the protocol versions crypto/tls can offer, oldest first
+var versions = []uint16{
+	tls.VersionTLS10,
+	tls.VersionTLS11,
+	tls.VersionTLS12,
+	tls.VersionTLS13,
+}
+
+// ScanVersions tries one handshake per protocol version
+func ScanVersions(opts Options) ([]Support, error) {
+	base, _, err := clientConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Support, 0, len(versions))
+	for _, version := range versions {
+		tlsConfig := base.Clone()
+		tlsConfig.MinVersion = version
+		tlsConfig.MaxVersion = version
+		tlsConfig.CipherSuites = allCipherSuites(version)
+
+		supported, err := accepts(opts, tlsConfig)
+		results = append(results, Support{
+			ID:        version,
+			Name:      tls.VersionName(version),
+			Supported: supported,
+			Err:       err,
+		})
+	}
+	return results, nil
+}
+
+// ScanCiphers tries one TLS 1.0-1.2 handshake per cipher suite known to
+// crypto/tls. TLS 1.3 suites cannot be offered individually by Go clients
+// and are not scanned.
+func ScanCiphers(opts Options) ([]Support, error) {
+	base, _, err := clientConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	suites := append(tls.CipherSuites(), tls.InsecureCipherSuites()...)
+	results := make([]Support, 0, len(suites))
+	for _, suite := range suites {
+		if !supportsPreTLS13(suite) {
+			continue
+		}
+
+		tlsConfig := base.Clone()
+		tlsConfig.MinVersion = tls.VersionTLS10
+		tlsConfig.MaxVersion = tls.VersionTLS12
+		tlsConfig.CipherSuites = []uint16{suite.ID}
+
+		supported, err := accepts(opts, tlsConfig)
+		results = append(results, Support{
+			ID:        suite.ID,
+			Name:      suite.Name,
+			Supported: supported,
+			Err:       err,
+		})
+	}
+	return results, nil
+}
+
+// accepts reports whether the server completed the handshake, or got as
+// far as requesting a client certificate, which means it accepted the
+// offered version and suite
+func accepts(opts Options, tlsConfig *tls.Config) (bool, error) {
+	result := &Result{}
+	observe(tlsConfig, result)
+
+	conn, err := dial(opts, tlsConfig)
+	if err != nil {
+		return result.ClientCertRequested, err
+	}
+	conn.Close()
+	return true, nil
+}
+
+// allCipherSuites offers every suite usable with version, so the version
+// scan is not limited by the profile's cipher list
+func allCipherSuites(version uint16) []uint16 {
+	var ids []uint16
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		for _, v := range suite.SupportedVersions {
+			if v == version {
+				ids = append(ids, suite.ID)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+func supportsPreTLS13(suite *tls.CipherSuite) bool {
+	for _, v := range suite.SupportedVersions {
+		if v != tls.VersionTLS13 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package probe
+
+import (
+	"crypto/tls"
+	"strings"
+	"testing"
+
+	"github.com/bxtal-lsn/gotransport/pkg/pkitest"
+)
+
+// supported returns the names of the supported entries
+func supported(results []Support) []string {
+	var names []string
+	for _, r := range results {
+		if r.Supported {
+			names = append(names, r.Name)
+		}
+	}
+	return names
+}
+
+func TestScanVersions(t *testing.T) {
+	ca := pkitest.NewCA("Server CA")
+	leaf := ca.Server("web.test")
+
+	tls13 := pkitest.ServerConfig(leaf, nil)
+	tls13.MinVersion = tls.VersionTLS13
+	tls12 := pkitest.ServerConfig(leaf, nil)
+	tls12.MaxVersion = tls.VersionTLS12
+	// Requesting a client certificate shows the version was accepted,
+	// even though the handshake then fails without one
+	clientAuth := pkitest.ServerConfig(leaf, pkitest.NewCA("Client CA"))
+
+	tests := []struct {
+		name string
+		cfg  *tls.Config
+		want []string
+	}{
+		{"TLS 1.3 only", tls13, []string{"TLS 1.3"}},
+		{"TLS 1.2 only", tls12, []string{"TLS 1.2"}},
+		{"client certificate requested", clientAuth, []string{"TLS 1.2", "TLS 1.3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := ScanVersions(Options{Address: serve(t, tt.cfg)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != len(versions) {
+				t.Fatalf("%d results, want one per version", len(results))
+			}
+			if got := supported(results); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("supported %q, want %q", got, tt.want)
+			}
+
+			for _, r := range results {
+				if r.Supported {
+					continue
+				}
+				if r.Err == nil {
+					t.Errorf("%s unsupported without an error", r.Name)
+				} else if hint := Hint(r.Err); !strings.Contains(hint, "no protocol version or cipher suite") {
+					t.Errorf("%s: hint %q for %v, want the negotiation hint", r.Name, hint, r.Err)
+				}
+			}
+		})
+	}
+}
+
+func TestScanCiphers(t *testing.T) {
+	leaf := pkitest.NewCA("Server CA").Server("web.test")
+
+	limited := pkitest.ServerConfig(leaf, nil)
+	limited.MaxVersion = tls.VersionTLS12
+	limited.CipherSuites = []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256}
+	tls13 := pkitest.ServerConfig(leaf, nil)
+	tls13.MinVersion = tls.VersionTLS13
+
+	tests := []struct {
+		name string
+		cfg  *tls.Config
+		want []string
+	}{
+		{"limited suites", limited, []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256"}},
+		// TLS 1.3 suites cannot be scanned, so none show up
+		{"TLS 1.3 only", tls13, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := ScanCiphers(Options{Address: serve(t, tt.cfg)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) == 0 {
+				t.Fatal("no cipher suites scanned")
+			}
+			for _, r := range results {
+				if strings.HasPrefix(r.Name, "TLS_AES_") || strings.HasPrefix(r.Name, "TLS_CHACHA20_") {
+					t.Errorf("TLS 1.3 suite %s scanned", r.Name)
+				}
+			}
+			if got := supported(results); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("supported %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanInvalidAddress(t *testing.T) {
+	if _, err := ScanVersions(Options{Address: "web.test"}); err == nil {
+		t.Error("scanned versions of an address without a port")
+	}
+	if _, err := ScanCiphers(Options{Address: "web.test"}); err == nil {
+		t.Error("scanned ciphers of an address without a port")
+	}
+}
@@ -0,0 +1,87 @@
+// Package proxy implements a reverse proxy that passes the verified TLS
+// client identity to the upstream in request headers
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/bxtal-lsn/gotransport/pkg/tls/transport"
+)
+
+// Headers carrying the verified client identity. They are removed from
+// incoming requests, so upstreams can trust them.
+const (
+	HeaderVerified   = "X-Client-Cert-Verified"
+	HeaderCommonName = "X-Client-Cert-CN"
+	HeaderDNSNames   = "X-Client-Cert-DNS"
+	HeaderURIs       = "X-Client-Cert-URI"
+	HeaderSPIFFEID   = "X-Client-Cert-SPIFFE-ID"
+	HeaderSerial     = "X-Client-Cert-Serial"
+)
+
+var identityHeaders = []string{
+	HeaderVerified,
+	HeaderCommonName,
+	HeaderDNSNames,
+	HeaderURIs,
+	HeaderSPIFFEID,
+	HeaderSerial,
+}
+
+// New returns a reverse proxy to upstream. A nil roundTripper uses
+// http.DefaultTransport. The handler must be wrapped with
+// transport.PeerIdentity, as servers from transport.NewHTTPServer are.
+func New(upstream *url.URL, roundTripper http.RoundTripper, logger *log.Logger) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(upstream)
+			r.SetXForwarded()
+			r.Out.Host = r.In.Host
+			SetIdentityHeaders(r.Out.Header, r.In)
+		},
+		Transport: roundTripper,
+		ErrorLog:  logger,
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			if logger != nil {
+				logger.Printf("upstream error for %s %s: %v", req.Method, req.URL.Path, err)
+			}
+			http.Error(w, fmt.Sprintf("upstream unavailable: %v", err), http.StatusBadGateway)
+		},
+	}
+}
+
+// SetIdentityHeaders replaces any identity headers in header with the
+// verified peer of req
+func SetIdentityHeaders(header http.Header, req *http.Request) {
+	for _, name := range identityHeaders {
+		header.Del(name)
+	}
+
+	peer, ok := transport.PeerFromContext(req.Context())
+	if !ok {
+		header.Set(HeaderVerified, "NONE")
+		return
+	}
+
+	header.Set(HeaderVerified, "SUCCESS")
+	header.Set(HeaderCommonName, peer.CommonName)
+	header.Set(HeaderSerial, strings.ToUpper(peer.Certificate.SerialNumber.Text(16)))
+	if len(peer.Certificate.DNSNames) > 0 {
+		header.Set(HeaderDNSNames, strings.Join(peer.Certificate.DNSNames, ","))
+	}
+	if len(peer.Certificate.URIs) > 0 {
+		uris := make([]string, 0, len(peer.Certificate.URIs))
+		for _, u := range peer.Certificate.URIs {
+			uris = append(uris, u.String())
+		}
+		header.Set(HeaderURIs, strings.Join(uris, ","))
+	}
+	if peer.SPIFFEID != "" {
+		header.Set(HeaderSPIFFEID, peer.SPIFFEID)
+	}
+}
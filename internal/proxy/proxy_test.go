@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bxtal-lsn/gotransport/pkg/pkitest"
+	"github.com/bxtal-lsn/gotransport/pkg/tls/transport"
+)
+
+// spoofed are identity headers a client tries to pass off as verified
+var spoofed = map[string]string{
+	HeaderVerified:   "SUCCESS",
+	HeaderCommonName: "admin",
+	HeaderSPIFFEID:   "spiffe://example.org/admin",
+	HeaderSerial:     "01",
+	HeaderDNSNames:   "admin.test",
+	HeaderURIs:       "spiffe://example.org/admin",
+}
+
+// startProxy serves a proxy in front of an upstream that echoes the
+// identity headers it received, one "name: value" per line. clientAuth
+// selects how the proxy asks for client certificates, 0 serves plain HTTP.
+func startProxy(t *testing.T, ca *pkitest.CA, clientAuth tls.ClientAuthType) *httptest.Server {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range identityHeaders {
+			for _, value := range r.Header.Values(name) {
+				io.WriteString(w, name+": "+value+"\n")
+			}
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	upstreamURL, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	front := httptest.NewUnstartedServer(transport.PeerIdentity(New(upstreamURL, nil, nil)))
+	t.Cleanup(front.Close)
+	if clientAuth == 0 {
+		front.Start()
+		return front
+	}
+	front.TLS = pkitest.ServerConfig(ca.Server("127.0.0.1"), ca)
+	front.TLS.ClientAuth = clientAuth
+	front.StartTLS()
+	return front
+}
+
+// identity sends a request carrying the spoofed headers through the proxy
+// and returns the identity headers the upstream saw
+func identity(t *testing.T, front *httptest.Server, tlsConfig *tls.Config) map[string]string {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, front.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range spoofed {
+		req.Header.Set(name, value)
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+
+	headers := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		name, value, _ := strings.Cut(line, ": ")
+		if _, seen := headers[name]; seen {
+			t.Errorf("%s sent more than once", name)
+		}
+		headers[name] = value
+	}
+	return headers
+}
+
+func TestIdentityHeaders(t *testing.T) {
+	ca := pkitest.NewCA("Test CA")
+	client := ca.Client("api",
+		pkitest.WithSPIFFEID("spiffe://example.org/api"),
+		pkitest.WithHosts("api.test", "api2.test"))
+	untrusted := pkitest.NewCA("Other CA").Client("admin")
+	verifying := startProxy(t, ca, tls.VerifyClientCertIfGiven)
+
+	serial := strings.ToUpper(client.Cert.SerialNumber.Text(16))
+	verified := map[string]string{
+		HeaderVerified:   "SUCCESS",
+		HeaderCommonName: "api",
+		HeaderSerial:     serial,
+		HeaderDNSNames:   "api.test,api2.test",
+		HeaderURIs:       "spiffe://example.org/api",
+		HeaderSPIFFEID:   "spiffe://example.org/api",
+	}
+	none := map[string]string{HeaderVerified: "NONE"}
+
+	tests := []struct {
+		name      string
+		front     *httptest.Server
+		tlsConfig *tls.Config
+		want      map[string]string
+	}{
+		{"verified client", verifying, pkitest.ClientConfig(ca, "127.0.0.1", client), verified},
+		{"no client certificate", verifying, pkitest.ClientConfig(ca, "127.0.0.1", nil), none},
+		// The certificate is requested but never verified
+		{"unverified client certificate", startProxy(t, ca, tls.RequestClientCert), pkitest.ClientConfig(ca, "127.0.0.1", untrusted), none},
+		{"without TLS", startProxy(t, ca, 0), nil, none},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := identity(t, tt.front, tt.tlsConfig)
+			for _, name := range identityHeaders {
+				if got[name] != tt.want[name] {
+					t.Errorf("%s = %q, want %q", name, got[name], tt.want[name])
+				}
+			}
+		})
+	}
+}
+
+func TestSetIdentityHeadersWithoutTLS(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://proxy.test/", nil)
+	header := http.Header{}
+	for name, value := range spoofed {
+		header.Add(name, value)
+		header.Add(name, value)
+	}
+
+	SetIdentityHeaders(header, req)
+	for _, name := range identityHeaders {
+		want := []string(nil)
+		if name == HeaderVerified {
+			want = []string{"NONE"}
+		}
+		if got := header.Values(name); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
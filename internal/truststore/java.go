@@ -0,0 +1,85 @@
+package truststore
+
+import (
+	"fmt"
+	"os"
+)
+
+// javaStorePassword is the well-known default password of Java cacerts
+const javaStorePassword = "changeit"
+
+// javaStore is the cacerts keystore of a Java installation. It requires the
+// keytool binary that ships with the JDK.
+type javaStore struct{}
+
+func (javaStore) Name() string { return "java" }
+
+// keystore returns the cacerts path for the target, or "" if there is none
+func (javaStore) keystore(t Target) string {
+	var candidates []string
+	if t.JavaHome != "" {
+		candidates = append(candidates,
+			t.path(t.JavaHome, "lib", "security", "cacerts"),
+			t.path(t.JavaHome, "jre", "lib", "security", "cacerts"),
+		)
+	}
+	// Debian and Ubuntu JDKs share the keystore of ca-certificates-java
+	candidates = append(candidates, t.path("etc", "ssl", "certs", "java", "cacerts"))
+
+	for _, path := range candidates {
+		if fileExists(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+func (s javaStore) Install(t Target, ca *CA) error {
+	keystore := s.keystore(t)
+	if keystore == "" {
+		return ErrNotPresent
+	}
+
+	tmp, err := os.CreateTemp("", "gotransport-ca-*.pem")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(ca.PEM); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	tmp.Close()
+
+	// keytool refuses to import over an existing alias, so replace the
+	// certificate of an earlier install
+	if s.hasAlias(keystore, ca.Nickname) {
+		if err := run("keytool", "-delete",
+			"-keystore", keystore, "-storepass", javaStorePassword,
+			"-alias", ca.Nickname); err != nil {
+			return err
+		}
+	}
+
+	return run("keytool", "-importcert", "-noprompt",
+		"-keystore", keystore, "-storepass", javaStorePassword,
+		"-alias", ca.Nickname, "-file", tmp.Name())
+}
+
+// hasAlias reports whether keystore holds an entry named alias
+func (javaStore) hasAlias(keystore, alias string) bool {
+	return run("keytool", "-list",
+		"-keystore", keystore, "-storepass", javaStorePassword,
+		"-alias", alias) == nil
+}
+
+func (s javaStore) Uninstall(t Target, ca *CA) error {
+	keystore := s.keystore(t)
+	if keystore == "" {
+		return ErrNotPresent
+	}
+
+	return run("keytool", "-delete",
+		"-keystore", keystore, "-storepass", javaStorePassword,
+		"-alias", ca.Nickname)
+}
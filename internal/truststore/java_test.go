@@ -0,0 +1,121 @@
+package truststore
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeKeytool behaves like keytool for -list, -delete and -importcert,
+// keeping each alias as a file next to the keystore
+const fakeKeytool = `#!/bin/sh
+op=$1
+while [ $# -gt 0 ]; do
+	case $1 in
+	-keystore) keystore=$2; shift ;;
+	-alias) alias=$2; shift ;;
+	-file) file=$2; shift ;;
+	esac
+	shift
+done
+entry="$keystore.$alias"
+case $op in
+-list) [ -f "$entry" ] || { echo "Alias <$alias> does not exist"; exit 1; } ;;
+-delete) [ -f "$entry" ] || { echo "Alias <$alias> does not exist"; exit 1; }; rm "$entry" ;;
+-importcert) [ -f "$entry" ] && { echo "Certificate not imported, alias <$alias> already exists"; exit 1; }; cp "$file" "$entry" ;;
+esac
+`
+
+// fakeTool puts an executable script named name first in PATH
+func fakeTool(t *testing.T, name, script string) {
+	t.Helper()
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// touch creates an empty file at path under root along with its directories
+func touch(t *testing.T, root string, elem ...string) string {
+	t.Helper()
+	path := filepath.Join(append([]string{root}, elem...)...)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testCert returns a certificate with just enough set to derive a nickname
+func testCert() *x509.Certificate {
+	return &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Test CA"}}
+}
+
+func TestJavaStoreReinstall(t *testing.T) {
+	fakeTool(t, "keytool", fakeKeytool)
+
+	root := t.TempDir()
+	keystore := touch(t, root, "java", "lib", "security", "cacerts")
+
+	target := Target{Root: root, JavaHome: "java"}
+	cert := testCert()
+	entry := keystore + "." + nickname(cert)
+
+	store := javaStore{}
+	for _, pem := range []string{"first", "second"} {
+		if err := store.Install(target, NewCA([]byte(pem), cert)); err != nil {
+			t.Fatalf("install %s: %v", pem, err)
+		}
+		got, err := os.ReadFile(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != pem {
+			t.Fatalf("keystore holds %q, want %q", got, pem)
+		}
+	}
+
+	if err := store.Uninstall(target, NewCA(nil, cert)); err != nil {
+		t.Fatal(err)
+	}
+	if fileExists(entry) {
+		t.Fatal("alias still present after uninstall")
+	}
+}
+
+func TestJavaStoreKeystore(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    [][]string
+		javaHome string
+		want     []string
+	}{
+		{"JDK layout", [][]string{{"jdk", "lib", "security", "cacerts"}}, "jdk", []string{"jdk", "lib", "security", "cacerts"}},
+		{"JRE layout", [][]string{{"jdk", "jre", "lib", "security", "cacerts"}}, "jdk", []string{"jdk", "jre", "lib", "security", "cacerts"}},
+		{"Debian without JAVA_HOME", [][]string{{"etc", "ssl", "certs", "java", "cacerts"}}, "", []string{"etc", "ssl", "certs", "java", "cacerts"}},
+		{"JAVA_HOME before Debian", [][]string{{"jdk", "lib", "security", "cacerts"}, {"etc", "ssl", "certs", "java", "cacerts"}}, "jdk", []string{"jdk", "lib", "security", "cacerts"}},
+		{"JAVA_HOME without cacerts", [][]string{{"etc", "ssl", "certs", "java", "cacerts"}}, "jdk", []string{"etc", "ssl", "certs", "java", "cacerts"}},
+		{"none", nil, "jdk", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, file := range tt.files {
+				touch(t, root, file...)
+			}
+			want := ""
+			if tt.want != nil {
+				want = filepath.Join(append([]string{root}, tt.want...)...)
+			}
+			if got := (javaStore{}).keystore(Target{Root: root, JavaHome: tt.javaHome}); got != want {
+				t.Errorf("keystore = %q, want %q", got, want)
+			}
+		})
+	}
+}
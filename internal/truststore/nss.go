@@ -0,0 +1,92 @@
+package truststore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// nssStore covers the NSS databases used by Firefox and Chrome/Chromium.
+// It requires the certutil tool from the NSS utilities.
+type nssStore struct{}
+
+func (nssStore) Name() string { return "nss" }
+
+// databases returns every NSS database directory found on the target
+func (nssStore) databases(t Target) []string {
+	candidates := []string{
+		t.path("etc", "pki", "nssdb"),
+	}
+	if t.Home != "" {
+		candidates = append(candidates,
+			t.path(t.Home, ".pki", "nssdb"),
+			t.path(t.Home, "snap", "chromium", "current", ".pki", "nssdb"),
+		)
+		for _, pattern := range []string{
+			t.path(t.Home, ".mozilla", "firefox", "*"),
+			t.path(t.Home, "snap", "firefox", "common", ".mozilla", "firefox", "*"),
+		} {
+			profiles, _ := filepath.Glob(pattern)
+			candidates = append(candidates, profiles...)
+		}
+	}
+
+	var dbs []string
+	for _, dir := range candidates {
+		if fileExists(filepath.Join(dir, "cert9.db")) || fileExists(filepath.Join(dir, "cert8.db")) {
+			dbs = append(dbs, dir)
+		}
+	}
+	return dbs
+}
+
+// dbArg returns the certutil database argument for dir
+func dbArg(dir string) string {
+	if fileExists(filepath.Join(dir, "cert9.db")) {
+		return "sql:" + dir
+	}
+	return "dbm:" + dir
+}
+
+func (s nssStore) Install(t Target, ca *CA) error {
+	dbs := s.databases(t)
+	if len(dbs) == 0 {
+		return ErrNotPresent
+	}
+
+	// certutil reads the certificate from a file
+	tmp, err := os.CreateTemp("", "gotransport-ca-*.pem")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(ca.PEM); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	tmp.Close()
+
+	var errs []error
+	for _, db := range dbs {
+		if err := run("certutil", "-A", "-d", dbArg(db), "-t", "C,,", "-n", ca.Nickname, "-i", tmp.Name()); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", db, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s nssStore) Uninstall(t Target, ca *CA) error {
+	dbs := s.databases(t)
+	if len(dbs) == 0 {
+		return ErrNotPresent
+	}
+
+	var errs []error
+	for _, db := range dbs {
+		if err := run("certutil", "-D", "-d", dbArg(db), "-n", ca.Nickname); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", db, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,81 @@
+package truststore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// fakeCertutil appends its arguments to $CERTUTIL_LOG, one call per line
+const fakeCertutil = `#!/bin/sh
+echo "$@" >> "$CERTUTIL_LOG"
+`
+
+func TestNSSStore(t *testing.T) {
+	fakeTool(t, "certutil", fakeCertutil)
+	log := filepath.Join(t.TempDir(), "certutil.log")
+	t.Setenv("CERTUTIL_LOG", log)
+
+	root := t.TempDir()
+	target := Target{Root: root, Home: "home/user"}
+	ca := NewCA([]byte("pem"), testCert())
+	store := nssStore{}
+	if err := store.Install(target, ca); !errors.Is(err, ErrNotPresent) {
+		t.Fatalf("install without databases: %v, want ErrNotPresent", err)
+	}
+
+	system := filepath.Dir(touch(t, root, "etc", "pki", "nssdb", "cert9.db"))
+	chromium := filepath.Dir(touch(t, root, "home", "user", ".pki", "nssdb", "cert9.db"))
+	firefox := filepath.Dir(touch(t, root, "home", "user", ".mozilla", "firefox", "abc.default", "cert8.db"))
+	// Profiles without a database are skipped
+	if err := os.MkdirAll(filepath.Join(root, "home", "user", ".mozilla", "firefox", "empty.default"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	dbs := store.databases(target)
+	if want := []string{system, chromium, firefox}; strings.Join(dbs, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("databases %q, want %q", dbs, want)
+	}
+
+	if err := store.Install(target, ca); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Uninstall(target, ca); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The temporary certificate file has a random name
+	calls := regexp.MustCompile(` -i \S+`).ReplaceAllString(strings.TrimSpace(string(data)), " -i <file>")
+	var wantCalls []string
+	for _, db := range dbs {
+		wantCalls = append(wantCalls, "-A -d "+dbArg(db)+" -t C,, -n "+ca.Nickname+" -i <file>")
+	}
+	for _, db := range dbs {
+		wantCalls = append(wantCalls, "-D -d "+dbArg(db)+" -n "+ca.Nickname)
+	}
+	if calls != strings.Join(wantCalls, "\n") {
+		t.Errorf("certutil calls:\n%s\nwant:\n%s", calls, strings.Join(wantCalls, "\n"))
+	}
+}
+
+func TestDBArg(t *testing.T) {
+	root := t.TempDir()
+	sql := filepath.Dir(touch(t, root, "sql", "cert9.db"))
+	dbm := filepath.Dir(touch(t, root, "dbm", "cert8.db"))
+	// A migrated database keeps the old file next to the new one
+	both := filepath.Dir(touch(t, root, "both", "cert9.db"))
+	touch(t, root, "both", "cert8.db")
+
+	for dir, want := range map[string]string{sql: "sql:" + sql, dbm: "dbm:" + dbm, both: "sql:" + both} {
+		if got := dbArg(dir); got != want {
+			t.Errorf("dbArg(%q) = %q, want %q", dir, got, want)
+		}
+	}
+}
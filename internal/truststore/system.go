@@ -0,0 +1,79 @@
+package truststore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// debianStore is the Debian/Ubuntu ca-certificates store
+type debianStore struct{}
+
+func (debianStore) Name() string { return "debian" }
+
+func (debianStore) dir(t Target) string {
+	return t.path("usr", "local", "share", "ca-certificates")
+}
+
+func (s debianStore) Install(t Target, ca *CA) error {
+	// update-ca-certificates only picks up files ending in .crt
+	return installAnchor(t, s.dir(t), ca.Nickname+".crt", ca.PEM, "update-ca-certificates")
+}
+
+func (s debianStore) Uninstall(t Target, ca *CA) error {
+	return uninstallAnchor(t, s.dir(t), ca.Nickname+".crt", "update-ca-certificates", "--fresh")
+}
+
+// rhelStore is the RHEL/Fedora ca-trust store
+type rhelStore struct{}
+
+func (rhelStore) Name() string { return "rhel" }
+
+func (rhelStore) dir(t Target) string {
+	return t.path("etc", "pki", "ca-trust", "source", "anchors")
+}
+
+func (s rhelStore) Install(t Target, ca *CA) error {
+	return installAnchor(t, s.dir(t), ca.Nickname+".pem", ca.PEM, "update-ca-trust", "extract")
+}
+
+func (s rhelStore) Uninstall(t Target, ca *CA) error {
+	return uninstallAnchor(t, s.dir(t), ca.Nickname+".pem", "update-ca-trust", "extract")
+}
+
+// installAnchor writes a PEM anchor file and refreshes the system store.
+// The refresh command is only run against the live system, since it would
+// otherwise update the host rather than the target root.
+func installAnchor(t Target, dir, name string, certPEM []byte, refresh ...string) error {
+	if !dirExists(dir) {
+		return ErrNotPresent
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, name), certPEM, 0o644); err != nil {
+		return fmt.Errorf("failed to write anchor: %w", err)
+	}
+
+	if t.IsSystemRoot() {
+		return run(refresh[0], refresh[1:]...)
+	}
+	return nil
+}
+
+// uninstallAnchor removes a PEM anchor file and refreshes the system store
+func uninstallAnchor(t Target, dir, name string, refresh ...string) error {
+	if !dirExists(dir) {
+		return ErrNotPresent
+	}
+
+	if err := os.Remove(filepath.Join(dir, name)); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotPresent
+		}
+		return fmt.Errorf("failed to remove anchor: %w", err)
+	}
+
+	if t.IsSystemRoot() {
+		return run(refresh[0], refresh[1:]...)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package truststore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSystemStores(t *testing.T) {
+	// The refresh tools must not run against the host for a --root target
+	marker := filepath.Join(t.TempDir(), "refreshed")
+	for _, tool := range []string{"update-ca-certificates", "update-ca-trust"} {
+		fakeTool(t, tool, "#!/bin/sh\ntouch "+marker+"\n")
+	}
+
+	tests := []struct {
+		store Store
+		dir   []string
+		ext   string
+	}{
+		{debianStore{}, []string{"usr", "local", "share", "ca-certificates"}, ".crt"},
+		{rhelStore{}, []string{"etc", "pki", "ca-trust", "source", "anchors"}, ".pem"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.store.Name(), func(t *testing.T) {
+			root := t.TempDir()
+			target := Target{Root: root}
+			ca := NewCA([]byte("first"), testCert())
+			if err := tt.store.Install(target, ca); !errors.Is(err, ErrNotPresent) {
+				t.Fatalf("install without store directory: %v, want ErrNotPresent", err)
+			}
+
+			dir := filepath.Join(append([]string{root}, tt.dir...)...)
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			anchor := filepath.Join(dir, ca.Nickname+tt.ext)
+
+			// Installing again replaces the anchor
+			for _, pem := range []string{"first", "second"} {
+				if err := tt.store.Install(target, NewCA([]byte(pem), testCert())); err != nil {
+					t.Fatal(err)
+				}
+				got, err := os.ReadFile(anchor)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != pem {
+					t.Fatalf("anchor holds %q, want %q", got, pem)
+				}
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("store directory has %d files, want 1", len(entries))
+			}
+
+			if err := tt.store.Uninstall(target, ca); err != nil {
+				t.Fatal(err)
+			}
+			if fileExists(anchor) {
+				t.Fatal("anchor still present after uninstall")
+			}
+			// A second uninstall finds nothing to remove and changes nothing
+			if err := tt.store.Uninstall(target, ca); !errors.Is(err, ErrNotPresent) {
+				t.Errorf("second uninstall: %v, want ErrNotPresent", err)
+			}
+			if !dirExists(dir) {
+				t.Error("store directory removed")
+			}
+
+			if fileExists(marker) {
+				t.Error("refresh tool run for a --root target")
+			}
+		})
+	}
+}
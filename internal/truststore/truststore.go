@@ -0,0 +1,128 @@
+package truststore
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ErrNotPresent is returned when a trust store does not exist on the target
+var ErrNotPresent = errors.New("trust store not present")
+
+// Store is a trust store that CA certificates can be installed into
+type Store interface {
+	// Name returns a short identifier used on the command line
+	Name() string
+	// Install adds the CA certificate to the store
+	Install(t Target, ca *CA) error
+	// Uninstall removes the CA certificate from the store
+	Uninstall(t Target, ca *CA) error
+}
+
+// Target describes the filesystem the stores live on
+type Target struct {
+	// Root is prepended to every store path, allowing installation into a
+	// chroot or test directory
+	Root string
+	// Home is the user's home directory, relative to Root
+	Home string
+	// JavaHome is the Java installation, relative to Root
+	JavaHome string
+}
+
+// CA is a certificate to be installed into trust stores
+type CA struct {
+	Cert *x509.Certificate
+	PEM  []byte
+	// Nickname identifies the certificate in stores that support it
+	Nickname string
+}
+
+// Result reports the outcome of an operation on a single store
+type Result struct {
+	Store string
+	Err   error
+}
+
+// Stores returns every supported trust store
+func Stores() []Store {
+	return []Store{debianStore{}, rhelStore{}, nssStore{}, javaStore{}}
+}
+
+// NewCA prepares a PEM encoded CA certificate for installation
+func NewCA(certPEM []byte, cert *x509.Certificate) *CA {
+	return &CA{
+		Cert:     cert,
+		PEM:      certPEM,
+		Nickname: nickname(cert),
+	}
+}
+
+// IsSystemRoot reports whether the target is the running system
+func (t Target) IsSystemRoot() bool {
+	return t.Root == "" || filepath.Clean(t.Root) == "/"
+}
+
+// path resolves a store path against the target root
+func (t Target) path(elem ...string) string {
+	return filepath.Join(append([]string{t.Root}, elem...)...)
+}
+
+// Install installs ca into each of stores, skipping those not present
+func Install(t Target, ca *CA, stores []Store) []Result {
+	results := make([]Result, 0, len(stores))
+	for _, store := range stores {
+		results = append(results, Result{Store: store.Name(), Err: store.Install(t, ca)})
+	}
+	return results
+}
+
+// Uninstall removes ca from each of stores, skipping those not present
+func Uninstall(t Target, ca *CA, stores []Store) []Result {
+	results := make([]Result, 0, len(stores))
+	for _, store := range stores {
+		results = append(results, Result{Store: store.Name(), Err: store.Uninstall(t, ca)})
+	}
+	return results
+}
+
+// nickname derives a stable, filesystem-safe name from the certificate
+func nickname(cert *x509.Certificate) string {
+	name := strings.ToLower(cert.Subject.CommonName)
+	name = regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(name, "-")
+	name = strings.Trim(name, "-")
+	if name == "" {
+		name = "ca"
+	}
+	return fmt.Sprintf("gotransport-%s-%s", name, cert.SerialNumber.String())
+}
+
+// dirExists reports whether path is an existing directory
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// fileExists reports whether path is an existing regular file
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// run executes an external tool, including its output in any error
+func run(name string, args ...string) error {
+	if _, err := exec.LookPath(name); err != nil {
+		return fmt.Errorf("%s not found in PATH", name)
+	}
+
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
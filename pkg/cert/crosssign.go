@@ -0,0 +1,89 @@
+package cert
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// CrossSignCACert issues a copy of the CA certificate subjectCert signed by
+// another CA. The result keeps the subject, public key and key identifier of
+// subjectCert, so clients that trust only the signing CA can build a chain to
+// certificates issued by subjectCert.
+func CrossSignCACert(subjectCert []byte, signerKey crypto.Signer, signerCert []byte) ([]byte, error) {
+	// Parse the CA certificate being cross-signed
+	subject, err := PemToX509(subjectCert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse subject CA certificate: %w", err)
+	}
+	if !subject.IsCA {
+		return nil, fmt.Errorf("certificate %q is not a CA", subject.Subject.CommonName)
+	}
+
+	// Parse signing CA certificate
+	signer, err := PemToX509(signerCert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signer certificate: %w", err)
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	// A cross certificate must not outlive its issuer
+	notAfter := subject.NotAfter
+	if signer.NotAfter.Before(notAfter) {
+		notAfter = signer.NotAfter
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject.Subject,
+		SubjectKeyId:          subject.SubjectKeyId,
+		NotBefore:             subject.NotBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		ExtKeyUsage:           subject.ExtKeyUsage,
+		KeyUsage:              subject.KeyUsage,
+		BasicConstraintsValid: true,
+	}
+
+	template = withSignerAlgorithm(template, signerKey)
+
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, signer, subject.PublicKey, signerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cross-sign certificate: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes}), nil
+}
+
+// WriteBundle concatenates PEM encoded certificates into a single file
+func WriteBundle(path string, certs ...[]byte) error {
+	var bundle bytes.Buffer
+	for _, c := range certs {
+		bundle.Write(bytes.TrimSpace(c))
+		bundle.WriteByte('\n')
+	}
+
+	if err := os.WriteFile(path, bundle.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write bundle file: %w", err)
+	}
+
+	return nil
+}
+
+// randomSerial returns a random 128-bit certificate serial number
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
@@ -0,0 +1,78 @@
+package cert_test
+
+import (
+	"bytes"
+	"crypto/x509"
+	"testing"
+
+	"github.com/bxtal-lsn/gotransport/pkg/cert"
+	"github.com/bxtal-lsn/gotransport/pkg/pkitest"
+)
+
+// crossSign signs subject with signer and parses the result
+func crossSign(t *testing.T, subject, signer *pkitest.CA) *x509.Certificate {
+	t.Helper()
+	crossPEM, err := cert.CrossSignCACert(subject.CertPEM(), signer.Key, signer.CertPEM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cross, err := cert.PemToX509(crossPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cross
+}
+
+func TestCrossSignCACert(t *testing.T) {
+	oldCA := pkitest.NewCA("Example CA")
+	// A key ID Go would not derive from the key, so it must be copied
+	newCA := pkitest.NewCA("Example CA G2", func(c *x509.Certificate) {
+		c.SubjectKeyId = []byte("example-ca-g2")
+	})
+
+	newByOld := crossSign(t, newCA, oldCA)
+	if !bytes.Equal(newByOld.RawSubject, newCA.Cert.RawSubject) || !newByOld.IsCA {
+		t.Errorf("cross certificate subject %q, want the CA %q", newByOld.Subject, newCA.Cert.Subject)
+	}
+	if len(newByOld.SubjectKeyId) == 0 || !bytes.Equal(newByOld.SubjectKeyId, newCA.Cert.SubjectKeyId) {
+		t.Errorf("subject key ID %x, want %x", newByOld.SubjectKeyId, newCA.Cert.SubjectKeyId)
+	}
+	if !bytes.Equal(newByOld.AuthorityKeyId, oldCA.Cert.SubjectKeyId) {
+		t.Errorf("authority key ID %x, want %x", newByOld.AuthorityKeyId, oldCA.Cert.SubjectKeyId)
+	}
+	if newByOld.NotAfter.After(oldCA.Cert.NotAfter) {
+		t.Errorf("cross certificate outlives its issuer")
+	}
+
+	// A leaf from the new CA chains to the old root through the cross
+	// certificate, and not without it
+	leaf := newCA.Server("web.test")
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(newByOld)
+	chains, err := leaf.Cert.Verify(x509.VerifyOptions{DNSName: "web.test", Roots: oldCA.Pool(), Intermediates: intermediates})
+	if err != nil {
+		t.Fatalf("leaf from new CA does not verify against old root: %v", err)
+	}
+	if chain := chains[0]; len(chain) != 3 || !chain[1].Equal(newByOld) || !chain[2].Equal(oldCA.Cert) {
+		t.Errorf("chain does not run through the cross certificate to the old root")
+	}
+	if _, err := leaf.Cert.Verify(x509.VerifyOptions{DNSName: "web.test", Roots: oldCA.Pool()}); err == nil {
+		t.Error("leaf from new CA verifies against old root without the cross certificate")
+	}
+
+	// And the other way round for leaves still issued by the old CA
+	legacy := oldCA.Server("legacy.test")
+	intermediates = x509.NewCertPool()
+	intermediates.AddCert(crossSign(t, oldCA, newCA))
+	if _, err := legacy.Cert.Verify(x509.VerifyOptions{DNSName: "legacy.test", Roots: newCA.Pool(), Intermediates: intermediates}); err != nil {
+		t.Errorf("leaf from old CA does not verify against new root: %v", err)
+	}
+}
+
+func TestCrossSignCACertRejectsLeaf(t *testing.T) {
+	ca := pkitest.NewCA("Example CA")
+	leaf := ca.Server("web.test")
+	if _, err := cert.CrossSignCACert(leaf.CertPEM(), ca.Key, ca.CertPEM()); err == nil {
+		t.Error("cross-signed a leaf certificate")
+	}
+}
@@ -0,0 +1,80 @@
+package cert
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// SPIFFEScheme is the URI scheme of SPIFFE IDs
+const SPIFFEScheme = "spiffe"
+
+// ParseSPIFFEID parses and validates a SPIFFE ID such as
+// spiffe://example.org/ns/prod/sa/api
+func ParseSPIFFEID(id string) (*url.URL, error) {
+	u, err := url.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SPIFFE ID %q: %w", id, err)
+	}
+
+	switch {
+	case u.Scheme != SPIFFEScheme:
+		return nil, fmt.Errorf("invalid SPIFFE ID %q: scheme must be %s", id, SPIFFEScheme)
+	case u.Host == "":
+		return nil, fmt.Errorf("invalid SPIFFE ID %q: missing trust domain", id)
+	case u.User != nil, u.Port() != "":
+		return nil, fmt.Errorf("invalid SPIFFE ID %q: trust domain must not contain user info or port", id)
+	case u.RawQuery != "", u.Fragment != "", u.ForceQuery:
+		return nil, fmt.Errorf("invalid SPIFFE ID %q: query and fragment are not allowed", id)
+	}
+
+	if err := validateTrustDomain(u.Host); err != nil {
+		return nil, fmt.Errorf("invalid SPIFFE ID %q: %w", id, err)
+	}
+
+	if u.Path != "" {
+		for _, segment := range strings.Split(strings.TrimPrefix(u.Path, "/"), "/") {
+			switch segment {
+			case "":
+				return nil, fmt.Errorf("invalid SPIFFE ID %q: empty path segment", id)
+			case ".", "..":
+				return nil, fmt.Errorf("invalid SPIFFE ID %q: relative path segment", id)
+			}
+			for _, c := range segment {
+				if !isSPIFFEPathChar(c) {
+					return nil, fmt.Errorf("invalid SPIFFE ID %q: invalid character %q in path", id, c)
+				}
+			}
+		}
+	}
+
+	return u, nil
+}
+
+// SPIFFEIDFromCert returns the SPIFFE ID of an X.509-SVID. An SVID carries
+// exactly one URI SAN, which must be a SPIFFE ID.
+func SPIFFEIDFromCert(cert *x509.Certificate) (*url.URL, error) {
+	if len(cert.URIs) == 0 {
+		return nil, fmt.Errorf("certificate has no URI SAN")
+	}
+	if len(cert.URIs) > 1 {
+		return nil, fmt.Errorf("certificate has %d URI SANs, an SVID must have exactly one", len(cert.URIs))
+	}
+	return ParseSPIFFEID(cert.URIs[0].String())
+}
+
+// validateTrustDomain checks a trust domain name contains only the
+// characters allowed by the SPIFFE specification
+func validateTrustDomain(td string) error {
+	for _, c := range td {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return fmt.Errorf("invalid character %q in trust domain", c)
+		}
+	}
+	return nil
+}
+
+func isSPIFFEPathChar(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_'
+}
@@ -15,6 +15,7 @@ type Cert struct {
 	ValidForYears int         `yaml:"validForYears"`
 	Subject       CertSubject `yaml:"subject"`
 	DNSNames      []string    `yaml:"dnsNames"`
+	SPIFFEID      string      `yaml:"spiffeID"`
 }
 
 // CertSubject represents the subject fields of a certificate
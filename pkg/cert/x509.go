@@ -1,152 +1,216 @@
 package cert
 
 import (
-	"bytes"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
+	"net/url"
 	"os"
 	"time"
 
 	"github.com/bxtal-lsn/gotransport/pkg/key"
+	"github.com/bxtal-lsn/gotransport/pkg/signer"
 )
 
+// Issued is a certificate together with its private key
+type Issued struct {
+	Cert    *x509.Certificate
+	Key     *rsa.PrivateKey
+	CertPEM []byte
+	KeyPEM  []byte
+}
+
 // CreateCACert creates a new Certificate Authority certificate and key
 func CreateCACert(ca *CACert, keyFilePath, caCertFilePath string) error {
-	// Create certificate template
-	template := &x509.Certificate{
-		SerialNumber: ca.Serial,
-		Subject: pkix.Name{
-			Country:            removeEmptyString([]string{ca.Subject.Country}),
-			Organization:       removeEmptyString([]string{ca.Subject.Organization}),
-			OrganizationalUnit: removeEmptyString([]string{ca.Subject.OrganizationalUnit}),
-			Locality:           removeEmptyString([]string{ca.Subject.Locality}),
-			Province:           removeEmptyString([]string{ca.Subject.Province}),
-			StreetAddress:      removeEmptyString([]string{ca.Subject.StreetAddress}),
-			PostalCode:         removeEmptyString([]string{ca.Subject.PostalCode}),
-			CommonName:         ca.Subject.CommonName,
-		},
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(ca.ValidForYears, 0, 0),
-		IsCA:                  true,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
-		BasicConstraintsValid: true,
+	issued, err := NewCACert(ca)
+	if err != nil {
+		return err
 	}
 
-	// Create certificate and key
-	keyBytes, certBytes, err := createCert(template, nil, nil)
+	return issued.WriteFiles(keyFilePath, caCertFilePath)
+}
+
+// CreateCert creates a new certificate signed by a CA
+func CreateCert(cert *Cert, caKey []byte, caCert []byte, keyFilePath, certFilePath string) error {
+	// Parse CA key
+	caKeyParsed, err := signer.ParsePrivateKeyPEM(caKey)
 	if err != nil {
-		return fmt.Errorf("failed to create CA certificate: %w", err)
+		return fmt.Errorf("failed to parse CA key: %w", err)
 	}
 
-	// Write key file
-	if err := os.WriteFile(keyFilePath, keyBytes, 0o600); err != nil {
-		return fmt.Errorf("failed to write key file: %w", err)
+	return CreateCertWithSigner(cert, caKeyParsed, caCert, keyFilePath, certFilePath)
+}
+
+// CreateCertWithSigner creates a new certificate signed by a CA whose key is
+// available only as a crypto.Signer, such as a key held in Vault or an HSM
+func CreateCertWithSigner(cert *Cert, caKey crypto.Signer, caCert []byte, keyFilePath, certFilePath string) error {
+	// Parse CA certificate
+	caCertParsed, err := PemToX509(caCert)
+	if err != nil {
+		return fmt.Errorf("failed to parse CA certificate: %w", err)
 	}
 
-	// Write certificate file
-	if err := os.WriteFile(caCertFilePath, certBytes, 0o644); err != nil {
-		return fmt.Errorf("failed to write certificate file: %w", err)
+	issued, err := NewCert(cert, caKey, caCertParsed)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return issued.WriteFiles(keyFilePath, certFilePath)
 }
 
-// CreateCert creates a new certificate signed by a CA
-func CreateCert(cert *Cert, caKey []byte, caCert []byte, keyFilePath, certFilePath string) error {
-	// Create certificate template
-	template := &x509.Certificate{
-		SerialNumber: cert.Serial,
-		Subject: pkix.Name{
-			Country:            removeEmptyString([]string{cert.Subject.Country}),
-			Organization:       removeEmptyString([]string{cert.Subject.Organization}),
-			OrganizationalUnit: removeEmptyString([]string{cert.Subject.OrganizationalUnit}),
-			Locality:           removeEmptyString([]string{cert.Subject.Locality}),
-			Province:           removeEmptyString([]string{cert.Subject.Province}),
-			StreetAddress:      removeEmptyString([]string{cert.Subject.StreetAddress}),
-			PostalCode:         removeEmptyString([]string{cert.Subject.PostalCode}),
-			CommonName:         cert.Subject.CommonName,
-		},
-		NotBefore:   time.Now(),
-		NotAfter:    time.Now().AddDate(cert.ValidForYears, 0, 0),
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:    x509.KeyUsageDigitalSignature,
-		DNSNames:    removeEmptyString(cert.DNSNames),
+// NewCACert creates a new self-signed Certificate Authority certificate and
+// key in memory
+func NewCACert(ca *CACert) (*Issued, error) {
+	issued, err := issue(CACertTemplate(ca), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %w", err)
 	}
+	return issued, nil
+}
 
-	// Parse CA key
-	caKeyParsed, err := key.PrivateKeyPemToRSA(caKey)
+// NewCert creates a new certificate and key signed by a CA in memory
+func NewCert(cert *Cert, caKey crypto.Signer, caCert *x509.Certificate) (*Issued, error) {
+	template, err := CertTemplate(cert)
 	if err != nil {
-		return fmt.Errorf("failed to parse CA key: %w", err)
+		return nil, err
 	}
 
-	// Parse CA certificate
-	caCertParsed, err := PemToX509(caCert)
+	issued, err := issue(template, caKey, caCert)
 	if err != nil {
-		return fmt.Errorf("failed to parse CA certificate: %w", err)
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	return issued, nil
+}
+
+// CACertTemplate returns the x509 template for a CA configuration
+func CACertTemplate(ca *CACert) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber:          ca.Serial,
+		Subject:               ca.Subject.Name(),
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(ca.ValidForYears, 0, 0),
+		IsCA:                  true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+}
+
+// CertTemplate returns the x509 template for a certificate configuration
+func CertTemplate(cert *Cert) (*x509.Certificate, error) {
+	template := &x509.Certificate{
+		SerialNumber: cert.Serial,
+		Subject:      cert.Subject.Name(),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().AddDate(cert.ValidForYears, 0, 0),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		DNSNames:     removeEmptyString(cert.DNSNames),
+	}
+
+	// X.509-SVIDs carry the SPIFFE ID as their only URI SAN
+	if cert.SPIFFEID != "" {
+		id, err := ParseSPIFFEID(cert.SPIFFEID)
+		if err != nil {
+			return nil, err
+		}
+		template.URIs = []*url.URL{id}
+		template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
 	}
 
-	// Create certificate and key
-	keyBytes, certBytes, err := createCert(template, caKeyParsed, caCertParsed)
+	return template, nil
+}
+
+// Name converts the subject configuration to a pkix.Name
+func (s CertSubject) Name() pkix.Name {
+	return pkix.Name{
+		Country:            removeEmptyString([]string{s.Country}),
+		Organization:       removeEmptyString([]string{s.Organization}),
+		OrganizationalUnit: removeEmptyString([]string{s.OrganizationalUnit}),
+		Locality:           removeEmptyString([]string{s.Locality}),
+		Province:           removeEmptyString([]string{s.Province}),
+		StreetAddress:      removeEmptyString([]string{s.StreetAddress}),
+		PostalCode:         removeEmptyString([]string{s.PostalCode}),
+		CommonName:         s.CommonName,
+	}
+}
+
+// SignCertificate signs template for the public key pub. A nil issuer
+// self-signs the certificate with issuerKey.
+func SignCertificate(template *x509.Certificate, pub crypto.PublicKey, issuer *x509.Certificate, issuerKey crypto.Signer) (*x509.Certificate, error) {
+	if issuer == nil {
+		issuer = template
+	}
+	template = withSignerAlgorithm(template, issuerKey)
+
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, issuer, pub, issuerKey)
 	if err != nil {
-		return fmt.Errorf("failed to create certificate: %w", err)
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	return x509.ParseCertificate(derBytes)
+}
+
+// withSignerAlgorithm returns template set to the signature algorithm of
+// signers bound to one, such as cloud KMS keys, unless it names its own
+func withSignerAlgorithm(template *x509.Certificate, signer crypto.Signer) *x509.Certificate {
+	bound, ok := signer.(interface {
+		SignatureAlgorithm() x509.SignatureAlgorithm
+	})
+	if !ok || template.SignatureAlgorithm != x509.UnknownSignatureAlgorithm {
+		return template
 	}
 
+	withAlgorithm := *template
+	withAlgorithm.SignatureAlgorithm = bound.SignatureAlgorithm()
+	return &withAlgorithm
+}
+
+// WriteFiles writes the key and certificate PEM files
+func (i *Issued) WriteFiles(keyFilePath, certFilePath string) error {
 	// Write key file
-	if err := os.WriteFile(keyFilePath, keyBytes, 0o600); err != nil {
+	if err := os.WriteFile(keyFilePath, i.KeyPEM, 0o600); err != nil {
 		return fmt.Errorf("failed to write key file: %w", err)
 	}
 
 	// Write certificate file
-	if err := os.WriteFile(certFilePath, certBytes, 0o644); err != nil {
+	if err := os.WriteFile(certFilePath, i.CertPEM, 0o644); err != nil {
 		return fmt.Errorf("failed to write certificate file: %w", err)
 	}
 
 	return nil
 }
 
-// createCert is a helper function that creates a certificate and key pair
-func createCert(template *x509.Certificate, caKey *rsa.PrivateKey, caCert *x509.Certificate) ([]byte, []byte, error) {
-	var (
-		derBytes []byte
-		certOut  bytes.Buffer
-		keyOut   bytes.Buffer
-		err      error
-	)
-
+// issue is a helper function that creates a key and a certificate for it.
+// A CA template is self-signed, anything else is signed by caKey.
+func issue(template *x509.Certificate, caKey crypto.Signer, caCert *x509.Certificate) (*Issued, error) {
 	// Create private key
 	privateKey, err := key.CreateRSAPrivateKey(4096)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create private key: %w", err)
+		return nil, fmt.Errorf("failed to create private key: %w", err)
 	}
 
 	// Create certificate based on whether it's a CA or not
+	var certificate *x509.Certificate
 	if template.IsCA {
-		// Self-signed certificate for CA
-		derBytes, err = x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+		certificate, err = SignCertificate(template, &privateKey.PublicKey, nil, privateKey)
 	} else {
-		// Certificate signed by CA
-		derBytes, err = x509.CreateCertificate(rand.Reader, template, caCert, &privateKey.PublicKey, caKey)
+		certificate, err = SignCertificate(template, &privateKey.PublicKey, caCert, caKey)
 	}
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create certificate: %w", err)
-	}
-
-	// Encode certificate to PEM
-	if err = pem.Encode(&certOut, &pem.Block{Type: "CERTIFICATE", Bytes: derBytes}); err != nil {
-		return nil, nil, fmt.Errorf("failed to encode certificate: %w", err)
-	}
-
-	// Encode key to PEM
-	if err = pem.Encode(&keyOut, key.RSAPrivateKeyToPEM(privateKey)); err != nil {
-		return nil, nil, fmt.Errorf("failed to encode key: %w", err)
+		return nil, err
 	}
 
-	return keyOut.Bytes(), certOut.Bytes(), nil
+	return &Issued{
+		Cert:    certificate,
+		Key:     privateKey,
+		CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw}),
+		KeyPEM:  pem.EncodeToMemory(key.RSAPrivateKeyToPEM(privateKey)),
+	}, nil
 }
 
 // removeEmptyString filters out empty strings from a slice
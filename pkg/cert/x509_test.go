@@ -0,0 +1,64 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// pssOnlySigner signs like a KMS key version fixed to RSASSA-PSS
+type pssOnlySigner struct {
+	*rsa.PrivateKey
+}
+
+func (s pssOnlySigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := opts.(*rsa.PSSOptions); !ok {
+		return nil, errors.New("key only signs RSASSA-PSS")
+	}
+	return s.PrivateKey.Sign(rand, digest, opts)
+}
+
+func (s pssOnlySigner) SignatureAlgorithm() x509.SignatureAlgorithm {
+	return x509.SHA256WithRSAPSS
+}
+
+func TestSignCertificateSignerAlgorithm(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := pssOnlySigner{key}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "KMS CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	ca, err := SignCertificate(template, key.Public(), nil, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca.SignatureAlgorithm != x509.SHA256WithRSAPSS {
+		t.Fatalf("signed with %s, want the signer's SHA256-RSAPSS", ca.SignatureAlgorithm)
+	}
+	if template.SignatureAlgorithm != x509.UnknownSignatureAlgorithm {
+		t.Fatal("template was modified")
+	}
+
+	// An algorithm named by the template is kept
+	template.SignatureAlgorithm = x509.SHA256WithRSA
+	if _, err := SignCertificate(template, key.Public(), nil, signer); err == nil {
+		t.Fatal("template algorithm was replaced by the signer's")
+	}
+}
@@ -0,0 +1,150 @@
+package dns
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// maxCacheTTL caps how long a response is cached, whatever its TTLs say
+const maxCacheTTL = time.Hour
+
+// cacheKey identifies a question, names compare case-insensitively
+type cacheKey struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+}
+
+// cacheEntry is a cached response and when it was stored
+type cacheEntry struct {
+	msg     *dns.Msg
+	stored  time.Time
+	expires time.Time
+}
+
+// cache holds upstream responses until their TTLs run out. A nil cache
+// stores nothing.
+type cache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[cacheKey]cacheEntry
+}
+
+// newCache creates a cache of size responses, nil if size is 0
+func newCache(size int) *cache {
+	if size <= 0 {
+		return nil
+	}
+	return &cache{
+		size:    size,
+		entries: make(map[cacheKey]cacheEntry),
+	}
+}
+
+func newCacheKey(q dns.Question) cacheKey {
+	return cacheKey{strings.ToLower(q.Name), q.Qtype, q.Qclass}
+}
+
+// get returns a copy of the cached response to q with TTLs reduced by the
+// time spent in the cache, or nil
+func (c *cache) get(q dns.Question) *dns.Msg {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[newCacheKey(q)]
+	c.mu.Unlock()
+
+	now := time.Now()
+	if !ok || !now.Before(entry.expires) {
+		return nil
+	}
+
+	msg := entry.msg.Copy()
+	elapsed := uint32(now.Sub(entry.stored) / time.Second)
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+			if rr.Header().Ttl > elapsed {
+				rr.Header().Ttl -= elapsed
+			} else {
+				rr.Header().Ttl = 0
+			}
+		}
+	}
+	return msg
+}
+
+// set caches resp as the answer to q for its lowest TTL. Negative answers
+// are cached for the SOA minimum (RFC 2308), errors and truncated
+// responses are not cached.
+func (c *cache) set(q dns.Question, resp *dns.Msg) {
+	if c == nil || resp.Truncated {
+		return
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return
+	}
+
+	ttl, ok := responseTTL(resp)
+	if !ok || ttl == 0 {
+		return
+	}
+	if ttl > maxCacheTTL {
+		ttl = maxCacheTTL
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Make room, dropping expired entries first and any entry if needed
+	if len(c.entries) >= c.size {
+		for key, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+	}
+	for key := range c.entries {
+		if len(c.entries) < c.size {
+			break
+		}
+		delete(c.entries, key)
+	}
+
+	c.entries[newCacheKey(q)] = cacheEntry{
+		msg:     resp.Copy(),
+		stored:  now,
+		expires: now.Add(ttl),
+	}
+}
+
+// responseTTL returns how long resp may be cached: the lowest TTL of the
+// answer and authority sections, or for negative answers the lower of the
+// SOA TTL and its minimum field
+func responseTTL(resp *dns.Msg) (time.Duration, bool) {
+	if len(resp.Answer) == 0 {
+		for _, rr := range resp.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				return time.Duration(min(soa.Hdr.Ttl, soa.Minttl)) * time.Second, true
+			}
+		}
+		// Negative answers without a SOA must not be cached
+		return 0, false
+	}
+
+	lowest := ^uint32(0)
+	for _, section := range [][]dns.RR{resp.Answer, resp.Ns} {
+		for _, rr := range section {
+			lowest = min(lowest, rr.Header().Ttl)
+		}
+	}
+	return time.Duration(lowest) * time.Second, true
+}
@@ -0,0 +1,128 @@
+package dns
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// DoHPath is where DNS over HTTPS queries are served (RFC 8484)
+	DoHPath = "/dns-query"
+	// dohMediaType is the content type of DNS messages over HTTPS
+	dohMediaType = "application/dns-message"
+)
+
+// ServeHTTP answers DNS over HTTPS queries sent with GET, in the dns query
+// parameter, or with POST as the request body (RFC 8484)
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var packed []byte
+	switch r.Method {
+	case http.MethodGet:
+		param := r.URL.Query().Get("dns")
+		if param == "" {
+			http.Error(w, "missing dns query parameter", http.StatusBadRequest)
+			return
+		}
+		decoded, err := base64.RawURLEncoding.DecodeString(param)
+		if err != nil {
+			http.Error(w, "invalid dns query parameter", http.StatusBadRequest)
+			return
+		}
+		packed = decoded
+	case http.MethodPost:
+		if r.Header.Get("Content-Type") != dohMediaType {
+			http.Error(w, "content type must be "+dohMediaType, http.StatusUnsupportedMediaType)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, dns.MaxMsgSize+1))
+		if err != nil || len(body) > dns.MaxMsgSize {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		packed = body
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req := new(dns.Msg)
+	if err := req.Unpack(packed); err != nil {
+		http.Error(w, "invalid DNS message", http.StatusBadRequest)
+		return
+	}
+
+	// Answer through the same handler as the other listeners
+	rw := &dohResponseWriter{remote: r.RemoteAddr}
+	s.handleRequest(rw, req)
+	if rw.msg == nil {
+		http.Error(w, "no response", http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := rw.msg.Pack()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to pack response: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// HTTP caches may keep the response as long as its records (RFC 8484 5.1)
+	w.Header().Set("Content-Type", dohMediaType)
+	w.Header().Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(minTTL(rw.msg)), 10))
+	w.Write(resp)
+}
+
+// minTTL returns the lowest TTL in the answer and authority sections of m
+func minTTL(m *dns.Msg) uint32 {
+	ttl, ok := responseTTL(m)
+	if !ok {
+		return 0
+	}
+	return uint32(ttl.Seconds())
+}
+
+// dohResponseWriter captures the response of the DNS handler to a query
+// received over HTTPS
+type dohResponseWriter struct {
+	remote string
+	msg    *dns.Msg
+}
+
+func (w *dohResponseWriter) LocalAddr() net.Addr {
+	return &net.TCPAddr{}
+}
+
+// RemoteAddr returns the client as a TCP address, so responses are not
+// truncated to UDP sizes
+func (w *dohResponseWriter) RemoteAddr() net.Addr {
+	addr, err := net.ResolveTCPAddr("tcp", w.remote)
+	if err != nil {
+		return &net.TCPAddr{}
+	}
+	return addr
+}
+
+func (w *dohResponseWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
+
+func (w *dohResponseWriter) Write(b []byte) (int, error) {
+	m := new(dns.Msg)
+	if err := m.Unpack(b); err != nil {
+		return 0, err
+	}
+	w.msg = m
+	return len(b), nil
+}
+
+func (w *dohResponseWriter) Close() error        { return nil }
+func (w *dohResponseWriter) TsigStatus() error   { return nil }
+func (w *dohResponseWriter) TsigTimersOnly(bool) {}
+func (w *dohResponseWriter) Hijack()             {}
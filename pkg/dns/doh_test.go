@@ -0,0 +1,270 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bxtal-lsn/gotransport/internal/dnsrecords"
+	"github.com/bxtal-lsn/gotransport/pkg/pkitest"
+	gotls "github.com/bxtal-lsn/gotransport/pkg/tls"
+	"github.com/miekg/dns"
+)
+
+// packQuery returns a packed query for name and qtype with id
+func packQuery(t *testing.T, id uint16, name string, qtype uint16) []byte {
+	t.Helper()
+	req := new(dns.Msg)
+	req.SetQuestion(name, qtype)
+	req.Id = id
+	packed, err := req.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packed
+}
+
+// dohGet returns a GET request for packed in the dns query parameter
+func dohGet(packed []byte) *http.Request {
+	return httptest.NewRequest(http.MethodGet, DoHPath+"?dns="+base64.RawURLEncoding.EncodeToString(packed), nil)
+}
+
+// dohPost returns a POST request with packed as a body of contentType
+func dohPost(packed []byte, contentType string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, DoHPath, bytes.NewReader(packed))
+	req.Header.Set("Content-Type", contentType)
+	return req
+}
+
+// serveDoH answers req and returns the response and the unpacked message
+// for successful requests
+func serveDoH(t *testing.T, s *Server, req *http.Request) (*http.Response, *dns.Msg) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	resp := rec.Result()
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != dohMediaType {
+		t.Errorf("content type %q, want %q", ct, dohMediaType)
+	}
+	m := new(dns.Msg)
+	if err := m.Unpack(rec.Body.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	return resp, m
+}
+
+func TestDoH(t *testing.T) {
+	s := newTestServer(t, dnsrecords.Record{Domain: "web.test", Type: dnsrecords.A, Value: "10.0.0.1", TTL: 60})
+	query := packQuery(t, 0x1234, "web.test.", dns.TypeA)
+	notDNS := []byte("not a DNS message")
+
+	tests := []struct {
+		name    string
+		req     *http.Request
+		status  int
+		answers []string
+		maxAge  string
+	}{
+		{"GET", dohGet(query), http.StatusOK, []string{"web.test. 10.0.0.1"}, "max-age=60"},
+		{"POST", dohPost(query, dohMediaType), http.StatusOK, []string{"web.test. 10.0.0.1"}, "max-age=60"},
+		{"NXDOMAIN not cacheable", dohPost(packQuery(t, 0x1234, "none.test.", dns.TypeA), dohMediaType), http.StatusOK, nil, "max-age=0"},
+		{"GET without dns parameter", httptest.NewRequest(http.MethodGet, DoHPath, nil), http.StatusBadRequest, nil, ""},
+		{"GET with standard base64", httptest.NewRequest(http.MethodGet, DoHPath+"?dns=%2B%2F%3D%3D", nil), http.StatusBadRequest, nil, ""},
+		{"GET malformed message", dohGet(notDNS), http.StatusBadRequest, nil, ""},
+		{"POST wrong content type", dohPost(query, "application/octet-stream"), http.StatusUnsupportedMediaType, nil, ""},
+		{"POST without content type", dohPost(query, ""), http.StatusUnsupportedMediaType, nil, ""},
+		{"POST malformed body", dohPost(notDNS, dohMediaType), http.StatusBadRequest, nil, ""},
+		{"POST oversized body", dohPost(make([]byte, dns.MaxMsgSize+1), dohMediaType), http.StatusBadRequest, nil, ""},
+		{"PUT", httptest.NewRequest(http.MethodPut, DoHPath, bytes.NewReader(query)), http.StatusMethodNotAllowed, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, m := serveDoH(t, s, tt.req)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+			if m == nil {
+				return
+			}
+			if m.Id != 0x1234 || !m.Response {
+				t.Errorf("response ID %#x, want the query ID 0x1234", m.Id)
+			}
+			if got := answers(m); strings.Join(got, "\n") != strings.Join(tt.answers, "\n") {
+				t.Errorf("answers %q, want %q", got, tt.answers)
+			}
+			if cc := resp.Header.Get("Cache-Control"); cc != tt.maxAge {
+				t.Errorf("Cache-Control %q, want %q", cc, tt.maxAge)
+			}
+		})
+	}
+}
+
+func TestDoHCachedAnswer(t *testing.T) {
+	var exchanges atomic.Int32
+	upstream := startUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		exchanges.Add(1)
+		answering(dns.RcodeSuccess)(w, r)
+	})
+	forwarder, err := NewForwarder(ForwarderOptions{Upstreams: []*Upstream{upstream}, CacheSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t)
+	s.Forwarder = forwarder
+
+	// RFC 8484 asks GET clients for ID 0, which must come back unchanged
+	// even when the cached response had another ID
+	for i, id := range []uint16{0x4321, 0} {
+		packed := packQuery(t, id, "example.com.", dns.TypeA)
+
+		resp, m := serveDoH(t, s, dohGet(packed))
+		if m == nil {
+			t.Fatalf("status %d", resp.StatusCode)
+		}
+		if m.Id != id {
+			t.Errorf("query %d: response ID %#x, want %#x", i, m.Id, id)
+		}
+		if len(m.Answer) != 1 {
+			t.Fatalf("query %d: %d answers, want 1", i, len(m.Answer))
+		}
+
+		// Cached answers count down their TTL, and so does max-age
+		wantTTL := uint32(60)
+		if i > 0 {
+			wantTTL = 30
+		}
+		if ttl := m.Answer[0].Header().Ttl; ttl != wantTTL {
+			t.Errorf("query %d: TTL %d, want %d", i, ttl, wantTTL)
+		}
+		if cc := resp.Header.Get("Cache-Control"); cc != "max-age="+strconv.Itoa(int(wantTTL)) {
+			t.Errorf("query %d: Cache-Control %q, want max-age=%d", i, cc, wantTTL)
+		}
+
+		// Age the cached response by 30 seconds
+		forwarder.cache.mu.Lock()
+		for key, entry := range forwarder.cache.entries {
+			entry.stored = entry.stored.Add(-30 * time.Second)
+			entry.expires = entry.expires.Add(-30 * time.Second)
+			forwarder.cache.entries[key] = entry
+		}
+		forwarder.cache.mu.Unlock()
+	}
+	if n := exchanges.Load(); n != 1 {
+		t.Errorf("%d upstream exchanges, want 1", n)
+	}
+}
+
+// freePort returns a local TCP port that was free a moment ago
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestEncryptedListeners(t *testing.T) {
+	ca := pkitest.NewCA("DNS CA")
+	server := ca.Server("127.0.0.1")
+	client := ca.Client("client")
+	paths := make(map[string]string)
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{"ca.crt": ca.CertPEM(), "server.crt": server.CertPEM(), "server.key": server.KeyPEM()} {
+		paths[name] = filepath.Join(dir, name)
+		if err := os.WriteFile(paths[name], data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := newTestServer(t, dnsrecords.Record{Domain: "web.test", Type: dnsrecords.A, Value: "10.0.0.1", TTL: 60})
+	s.Address = "127.0.0.1"
+	s.TLSPort = freePort(t)
+	s.HTTPSPort = freePort(t)
+	s.TLS = gotls.Config{
+		CAPath:     paths["ca.crt"],
+		CertPath:   paths["server.crt"],
+		KeyPath:    paths["server.key"],
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Start() }()
+	t.Cleanup(func() {
+		s.Stop()
+		<-done
+	})
+
+	dotAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(s.TLSPort))
+	dohURL := "https://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(s.HTTPSPort)) + DoHPath
+	req := new(dns.Msg)
+	req.SetQuestion("web.test.", dns.TypeA)
+
+	// Wait for the listeners
+	withCert := &dns.Client{Net: "tcp-tls", TLSConfig: pkitest.ClientConfig(ca, "127.0.0.1", client), Timeout: 2 * time.Second}
+	var resp *dns.Msg
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if resp, _, err = withCert.Exchange(req, dotAddr); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("DNS over TLS: %v", err)
+	}
+	if got := answers(resp); len(got) != 1 || got[0] != "web.test. 10.0.0.1" {
+		t.Errorf("DNS over TLS answers %q", got)
+	}
+
+	withoutCert := &dns.Client{Net: "tcp-tls", TLSConfig: pkitest.ClientConfig(ca, "127.0.0.1", nil), Timeout: 2 * time.Second}
+	if _, _, err := withoutCert.Exchange(req, dotAddr); err == nil {
+		t.Error("DNS over TLS answered a client without a certificate")
+	}
+
+	packed, _ := req.Pack()
+	for _, tt := range []struct {
+		name string
+		leaf *pkitest.Leaf
+		ok   bool
+	}{
+		{"with client certificate", client, true},
+		{"without client certificate", nil, false},
+	} {
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: pkitest.ClientConfig(ca, "127.0.0.1", tt.leaf)}, Timeout: 2 * time.Second}
+		httpResp, err := httpClient.Post(dohURL, dohMediaType, bytes.NewReader(packed))
+		if !tt.ok {
+			if err == nil {
+				httpResp.Body.Close()
+				t.Errorf("DNS over HTTPS %s: answered", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("DNS over HTTPS %s: %v", tt.name, err)
+		}
+		body := new(bytes.Buffer)
+		body.ReadFrom(httpResp.Body)
+		httpResp.Body.Close()
+		m := new(dns.Msg)
+		if err := m.Unpack(body.Bytes()); err != nil {
+			t.Fatalf("DNS over HTTPS %s: status %d: %v", tt.name, httpResp.StatusCode, err)
+		}
+		if got := answers(m); len(got) != 1 || got[0] != "web.test. 10.0.0.1" {
+			t.Errorf("DNS over HTTPS %s: answers %q", tt.name, got)
+		}
+	}
+}
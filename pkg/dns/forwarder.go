@@ -0,0 +1,334 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gotls "github.com/bxtal-lsn/gotransport/pkg/tls"
+	"github.com/miekg/dns"
+)
+
+const (
+	// DefaultForwardTimeout bounds one exchange with an upstream
+	DefaultForwardTimeout = 2 * time.Second
+	// DefaultHealthInterval is how often unhealthy upstreams are probed
+	DefaultHealthInterval = 10 * time.Second
+	// DefaultCacheSize is the number of responses kept by default
+	DefaultCacheSize = 10000
+)
+
+// Upstream is a resolver queries are forwarded to
+type Upstream struct {
+	// Address is the host:port of the resolver
+	Address string
+	// Net is "udp", "tcp" or "tcp-tls" for DNS over TLS
+	Net string
+
+	client *dns.Client
+	// tcp retries truncated UDP answers
+	tcp *dns.Client
+
+	mu      sync.Mutex
+	healthy bool
+}
+
+// ParseUpstream parses an upstream address. Plain addresses and udp://
+// use UDP with TCP for truncated answers, tcp:// uses TCP only and tls://
+// uses DNS over TLS (RFC 7858) on port 853. A #name suffix sets the server
+// name verified for tls://, which otherwise defaults to the host. tlsConfig
+// supplies the CA and client certificate for tls:// upstreams.
+func ParseUpstream(address string, tlsConfig gotls.Config, timeout time.Duration) (*Upstream, error) {
+	if timeout <= 0 {
+		timeout = DefaultForwardTimeout
+	}
+
+	network, port := "udp", "53"
+	switch {
+	case strings.HasPrefix(address, "udp://"):
+		address = strings.TrimPrefix(address, "udp://")
+	case strings.HasPrefix(address, "tcp://"):
+		network, address = "tcp", strings.TrimPrefix(address, "tcp://")
+	case strings.HasPrefix(address, "tls://"):
+		network, port, address = "tcp-tls", "853", strings.TrimPrefix(address, "tls://")
+	case strings.Contains(address, "://"):
+		return nil, fmt.Errorf("unsupported upstream scheme in %q (use udp://, tcp:// or tls://)", address)
+	}
+
+	serverName := ""
+	if i := strings.Index(address, "#"); i >= 0 {
+		address, serverName = address[:i], address[i+1:]
+		if network != "tcp-tls" {
+			return nil, fmt.Errorf("server name is only valid for tls:// upstreams: %s", address)
+		}
+	}
+
+	// Add the default port unless one is given
+	host := address
+	if h, p, err := net.SplitHostPort(address); err == nil {
+		host = h
+		port = p
+	}
+	if host == "" {
+		return nil, fmt.Errorf("invalid upstream address %q", address)
+	}
+	upstream := &Upstream{
+		Address: net.JoinHostPort(host, port),
+		Net:     network,
+		healthy: true,
+	}
+
+	upstream.client = &dns.Client{Net: network, Timeout: timeout}
+	if network == "udp" {
+		upstream.tcp = &dns.Client{Net: "tcp", Timeout: timeout}
+	}
+	if network == "tcp-tls" {
+		if serverName == "" {
+			serverName = host
+		}
+		tlsConfig.ServerName = serverName
+		clientConfig, err := gotls.NewClientTLSConfig(tlsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("upstream %s TLS error: %w", address, err)
+		}
+		upstream.client.TLSConfig = clientConfig
+	}
+
+	return upstream, nil
+}
+
+// String returns the upstream in the form ParseUpstream accepts
+func (u *Upstream) String() string {
+	switch u.Net {
+	case "tcp":
+		return "tcp://" + u.Address
+	case "tcp-tls":
+		return "tls://" + u.Address
+	}
+	return u.Address
+}
+
+// Exchange sends req to the upstream and records whether it answered.
+// Any response counts as an answer, SERVFAIL included: it reports a
+// failure to resolve one name, such as a broken zone, not a down upstream.
+func (u *Upstream) Exchange(req *dns.Msg) (*dns.Msg, error) {
+	resp, _, err := u.client.Exchange(req, u.Address)
+	if err == nil && resp.Truncated && u.tcp != nil {
+		resp, _, err = u.tcp.Exchange(req, u.Address)
+	}
+	u.setHealth(err)
+	return resp, err
+}
+
+// Healthy reports whether the last exchange with the upstream got a
+// response
+func (u *Upstream) Healthy() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.healthy
+}
+
+// setHealth records the outcome of an exchange and logs changes
+func (u *Upstream) setHealth(err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if err != nil && u.healthy {
+		fmt.Printf("Upstream %s is down: %v\n", u, err)
+	} else if err == nil && !u.healthy {
+		fmt.Printf("Upstream %s is back up\n", u)
+	}
+	u.healthy = err == nil
+}
+
+// ForwardRule sends queries for names at or below Zone to its upstreams
+// instead of the default ones
+type ForwardRule struct {
+	Zone      string
+	Upstreams []*Upstream
+}
+
+// ForwarderOptions configures a Forwarder
+type ForwarderOptions struct {
+	// Upstreams receive every query not matched by a rule, in order of
+	// preference
+	Upstreams []*Upstream
+	// Rules forward zones to their own upstreams, the longest matching
+	// zone wins
+	Rules []ForwardRule
+	// CacheSize is the number of responses cached, 0 disables the cache
+	CacheSize int
+	// HealthInterval is how often upstreams that failed are probed,
+	// DefaultHealthInterval if zero
+	HealthInterval time.Duration
+}
+
+// Forwarder resolves queries through upstream resolvers, failing over to
+// the next upstream when one does not answer
+type Forwarder struct {
+	upstreams      []*Upstream
+	rules          []ForwardRule
+	cache          *cache
+	healthInterval time.Duration
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewForwarder creates a forwarder. Call Start to begin health checks.
+func NewForwarder(opts ForwarderOptions) (*Forwarder, error) {
+	if len(opts.Upstreams) == 0 && len(opts.Rules) == 0 {
+		return nil, errors.New("no upstreams configured")
+	}
+
+	rules := make([]ForwardRule, 0, len(opts.Rules))
+	for _, rule := range opts.Rules {
+		if len(rule.Upstreams) == 0 {
+			return nil, fmt.Errorf("forward rule for %s has no upstreams", rule.Zone)
+		}
+		rule.Zone = dns.CanonicalName(rule.Zone)
+		rules = append(rules, rule)
+	}
+
+	// Try the most specific zones first
+	sort.SliceStable(rules, func(i, j int) bool {
+		return dns.CountLabel(rules[i].Zone) > dns.CountLabel(rules[j].Zone)
+	})
+
+	interval := opts.HealthInterval
+	if interval <= 0 {
+		interval = DefaultHealthInterval
+	}
+
+	return &Forwarder{
+		upstreams:      opts.Upstreams,
+		rules:          rules,
+		cache:          newCache(opts.CacheSize),
+		healthInterval: interval,
+		stop:           make(chan struct{}),
+	}, nil
+}
+
+// Start begins probing unhealthy upstreams in the background
+func (f *Forwarder) Start() {
+	go f.checkHealth()
+}
+
+// Stop ends the health checks
+func (f *Forwarder) Stop() {
+	f.once.Do(func() { close(f.stop) })
+}
+
+// Forward resolves req through the upstreams for its question, answering
+// from the cache when possible. The response carries the ID of req. An
+// error means no upstream responded.
+func (f *Forwarder) Forward(req *dns.Msg) (*dns.Msg, error) {
+	if len(req.Question) == 0 {
+		return nil, errors.New("query has no question")
+	}
+	q := req.Question[0]
+
+	if resp := f.cache.get(q); resp != nil {
+		resp.Id = req.Id
+		resp.Question = req.Question
+		return resp, nil
+	}
+
+	upstreams := f.upstreamsFor(q.Name)
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("no upstream for %s", q.Name)
+	}
+
+	// Healthy upstreams first, the others as a last resort
+	ordered := make([]*Upstream, 0, len(upstreams))
+	for _, upstream := range upstreams {
+		if upstream.Healthy() {
+			ordered = append(ordered, upstream)
+		}
+	}
+	for _, upstream := range upstreams {
+		if !upstream.Healthy() {
+			ordered = append(ordered, upstream)
+		}
+	}
+
+	// SERVFAIL is retried on the next upstream, which may still resolve
+	// the name, and passed through if none does
+	var servfail *dns.Msg
+	var lastErr error
+	for _, upstream := range ordered {
+		resp, err := upstream.Exchange(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.Rcode == dns.RcodeServerFailure {
+			servfail = resp
+			continue
+		}
+		f.cache.set(q, resp)
+		return resp, nil
+	}
+	if servfail != nil {
+		return servfail, nil
+	}
+	return nil, fmt.Errorf("all upstreams failed for %s: %w", q.Name, lastErr)
+}
+
+// upstreamsFor returns the upstreams of the most specific rule covering
+// name, or the default upstreams
+func (f *Forwarder) upstreamsFor(name string) []*Upstream {
+	name = dns.CanonicalName(name)
+	for _, rule := range f.rules {
+		if dns.IsSubDomain(rule.Zone, name) {
+			return rule.Upstreams
+		}
+	}
+	return f.upstreams
+}
+
+// checkHealth periodically probes the upstreams marked down, so they are
+// preferred again once they recover
+func (f *Forwarder) checkHealth() {
+	ticker := time.NewTicker(f.healthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			for _, upstream := range f.allUpstreams() {
+				if upstream.Healthy() {
+					continue
+				}
+				probe := new(dns.Msg)
+				probe.SetQuestion(".", dns.TypeNS)
+				upstream.Exchange(probe)
+			}
+		}
+	}
+}
+
+// allUpstreams returns every upstream once
+func (f *Forwarder) allUpstreams() []*Upstream {
+	seen := make(map[*Upstream]bool)
+	var all []*Upstream
+	add := func(upstreams []*Upstream) {
+		for _, upstream := range upstreams {
+			if !seen[upstream] {
+				seen[upstream] = true
+				all = append(all, upstream)
+			}
+		}
+	}
+	add(f.upstreams)
+	for _, rule := range f.rules {
+		add(rule.Upstreams)
+	}
+	return all
+}
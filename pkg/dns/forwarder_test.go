@@ -0,0 +1,142 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bxtal-lsn/gotransport/internal/dnsrecords"
+	gotls "github.com/bxtal-lsn/gotransport/pkg/tls"
+	"github.com/miekg/dns"
+)
+
+// startUpstream serves handler on a local UDP port and returns an Upstream
+// for it
+func startUpstream(t *testing.T, handler dns.HandlerFunc) *Upstream {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: conn, Handler: handler}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+
+	return parseTestUpstream(t, conn.LocalAddr().String())
+}
+
+// parseTestUpstream parses address with a short timeout
+func parseTestUpstream(t *testing.T, address string) *Upstream {
+	t.Helper()
+	upstream, err := ParseUpstream(address, gotls.Config{}, 500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return upstream
+}
+
+// answering replies with rcode and, for NOERROR, an A record
+func answering(rcode int) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(r, rcode)
+		if rcode == dns.RcodeSuccess {
+			rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A 192.0.2.1")
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	}
+}
+
+func TestForwardServfail(t *testing.T) {
+	// A port nobody listens on, so exchanges fail at the transport
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadAddr := conn.LocalAddr().String()
+	conn.Close()
+
+	tests := []struct {
+		name      string
+		upstreams []dns.HandlerFunc
+		dead      bool
+		rcode     int
+		answers   int
+	}{
+		{"next upstream resolves", []dns.HandlerFunc{answering(dns.RcodeServerFailure), answering(dns.RcodeSuccess)}, false, dns.RcodeSuccess, 1},
+		{"servfail passed through", []dns.HandlerFunc{answering(dns.RcodeServerFailure), answering(dns.RcodeServerFailure)}, false, dns.RcodeServerFailure, 0},
+		{"servfail after dead upstream", []dns.HandlerFunc{answering(dns.RcodeServerFailure)}, true, dns.RcodeServerFailure, 0},
+		{"nxdomain not retried", []dns.HandlerFunc{answering(dns.RcodeNameError), answering(dns.RcodeSuccess)}, false, dns.RcodeNameError, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upstreams []*Upstream
+			for _, handler := range tt.upstreams {
+				upstreams = append(upstreams, startUpstream(t, handler))
+			}
+			if tt.dead {
+				upstreams = append(upstreams, parseTestUpstream(t, deadAddr))
+			}
+			forwarder, err := NewForwarder(ForwarderOptions{Upstreams: upstreams})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := new(dns.Msg)
+			req.SetQuestion("example.com.", dns.TypeA)
+			resp, err := forwarder.Forward(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Rcode != tt.rcode || len(resp.Answer) != tt.answers {
+				t.Errorf("response %s with %d answers, want %s with %d",
+					dns.RcodeToString[resp.Rcode], len(resp.Answer), dns.RcodeToString[tt.rcode], tt.answers)
+			}
+
+			// Only the upstream that did not respond is marked down
+			for i, upstream := range upstreams {
+				if dead := tt.dead && i == len(upstreams)-1; upstream.Healthy() == dead {
+					t.Errorf("upstream %d healthy = %v", i, upstream.Healthy())
+				}
+			}
+		})
+	}
+}
+
+func TestForwardNoResponse(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := parseTestUpstream(t, conn.LocalAddr().String())
+	conn.Close()
+
+	forwarder, err := NewForwarder(ForwarderOptions{Upstreams: []*Upstream{upstream}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+	if _, err := forwarder.Forward(req); err == nil {
+		t.Fatal("forwarded without a responding upstream")
+	}
+	if upstream.Healthy() {
+		t.Error("upstream that did not respond is healthy")
+	}
+}
+
+func TestCNAMETargetServfail(t *testing.T) {
+	s := newTestServer(t, dnsrecords.Record{Domain: "alias.test", Type: dnsrecords.CNAME, Value: "broken.example.com.", TTL: 60})
+	forwarder, err := NewForwarder(ForwarderOptions{Upstreams: []*Upstream{startUpstream(t, answering(dns.RcodeServerFailure))}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Forwarder = forwarder
+
+	// The rcode describes the end of the chain (RFC 6604)
+	m := query(s, "alias.test.", dns.TypeA)
+	if m.Rcode != dns.RcodeServerFailure || len(m.Answer) != 1 {
+		t.Fatalf("response %s with %d answers, want SERVFAIL with the CNAME", dns.RcodeToString[m.Rcode], len(m.Answer))
+	}
+}
@@ -0,0 +1,132 @@
+package dns
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bxtal-lsn/gotransport/internal/dnsrecords"
+)
+
+// DefaultRecordsInterval is how often a records file is checked for changes
+const DefaultRecordsInterval = 2 * time.Second
+
+// RecordsFile serves records from a read-only YAML file in the format of
+// dns.yaml. The file is validated as a whole and replaced in one step when
+// it changes, so queries never see a partly loaded file.
+type RecordsFile struct {
+	path     string
+	interval time.Duration
+	records  atomic.Pointer[dnsrecords.Storage]
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// LoadRecordsFile reads and validates the records file at path. A zero
+// interval uses DefaultRecordsInterval.
+func LoadRecordsFile(path string, interval time.Duration) (*RecordsFile, error) {
+	if interval <= 0 {
+		interval = DefaultRecordsInterval
+	}
+
+	f := &RecordsFile{
+		path:     path,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Path returns the path of the records file
+func (f *RecordsFile) Path() string {
+	return f.path
+}
+
+// Start begins watching the file for changes
+func (f *RecordsFile) Start() {
+	go func() {
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-f.stop:
+				return
+			case <-ticker.C:
+				if !f.changed() {
+					continue
+				}
+				if err := f.Reload(); err != nil {
+					fmt.Printf("Keeping previous records, reload failed: %v\n", err)
+					continue
+				}
+				fmt.Printf("Reloaded %d records from %s\n", len(f.Records().List()), f.path)
+			}
+		}
+	}()
+}
+
+// Stop stops watching the file
+func (f *RecordsFile) Stop() {
+	f.once.Do(func() { close(f.stop) })
+}
+
+// Reload reads the file and replaces the served records if it is valid
+func (f *RecordsFile) Reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to read records file: %w", err)
+	}
+
+	// Remember the version read, a failed load is not retried until the
+	// file changes again
+	f.mu.Lock()
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	f.mu.Unlock()
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to read records file: %w", err)
+	}
+	defer file.Close()
+
+	records, err := dnsrecords.ParseYAML(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.path, err)
+	}
+	storage, err := dnsrecords.NewMemoryStorage(records)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.path, err)
+	}
+
+	f.records.Store(storage)
+	return nil
+}
+
+// changed reports whether the file differs from the version last read
+func (f *RecordsFile) changed() bool {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !info.ModTime().Equal(f.modTime) || info.Size() != f.size
+}
+
+// Records returns the records currently served
+func (f *RecordsFile) Records() *dnsrecords.Storage {
+	return f.records.Load()
+}
@@ -1,165 +1,547 @@
 package dns
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/bxtal-lsn/gotransport/internal/dnsrecords"
+	gotls "github.com/bxtal-lsn/gotransport/pkg/tls"
+	"github.com/bxtal-lsn/gotransport/pkg/tls/transport"
 	"github.com/miekg/dns"
 )
 
+// ednsBufferSize is the UDP payload size advertised to EDNS0 clients, the
+// size recommended to avoid IP fragmentation
+const ednsBufferSize = 1232
+
+// maxCNAMEChain is how many CNAMEs are followed before giving up with
+// SERVFAIL, so loops and long chains cannot stall the server
+const maxCNAMEChain = 8
+
+// recordTypes maps the query types answered from storage to record types
+var recordTypes = map[uint16]dnsrecords.RecordType{
+	dns.TypeA:     dnsrecords.A,
+	dns.TypeAAAA:  dnsrecords.AAAA,
+	dns.TypeCNAME: dnsrecords.CNAME,
+	dns.TypeTXT:   dnsrecords.TXT,
+	dns.TypeMX:    dnsrecords.MX,
+	dns.TypeSRV:   dnsrecords.SRV,
+	dns.TypePTR:   dnsrecords.PTR,
+	dns.TypeCAA:   dnsrecords.CAA,
+	dns.TypeNS:    dnsrecords.NS,
+}
+
 // Server represents a DNS server
 type Server struct {
 	Address string
 	Port    int
 	Storage *dnsrecords.Storage
-	server  *dns.Server
+
+	// RecordsFile, if set, serves read-only records from a file. A name
+	// with records in the file is answered from the file alone, hiding
+	// its records in Storage, which may be nil.
+	RecordsFile *RecordsFile
+
+	// TLS holds the certificate, and the CA for client authentication,
+	// used by the DNS over TLS and DNS over HTTPS listeners
+	TLS gotls.Config
+	// TLSPort and HTTPSPort enable DNS over TLS (RFC 7858) and DNS over
+	// HTTPS (RFC 8484) on Address when non-zero
+	TLSPort   int
+	HTTPSPort int
+
+	mu          sync.Mutex
+	servers     []*dns.Server
+	httpsServer *http.Server
+
+	// Forwarder, if set, resolves names without local records for clients
+	// asking for recursion
+	Forwarder *Forwarder
+
+	// rotation advances on every answer so record sets are served round-robin
+	rotation atomic.Uint32
 }
 
-// NewServer creates a new DNS server
+// NewServer creates a new DNS server. An empty storagePath creates a
+// server without storage, to serve a RecordsFile only.
 func NewServer(address string, port int, storagePath string) (*Server, error) {
-	storage, err := dnsrecords.NewStorage(storagePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize storage: %w", err)
-	}
-
 	server := &Server{
 		Address: address,
 		Port:    port,
-		Storage: storage,
+	}
+
+	if storagePath != "" {
+		storage, err := dnsrecords.NewStorage(storagePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize storage: %w", err)
+		}
+		server.Storage = storage
 	}
 
 	return server, nil
 }
 
-// Start starts the DNS server
-// In pkg/dns/server.go, modify the Start() method
+// Start starts the DNS server on UDP and TCP, and on the DNS over TLS and
+// DNS over HTTPS ports if set. It blocks until any listener stops.
 func (s *Server) Start() error {
-	addr := fmt.Sprintf("%s:%d", s.Address, s.Port)
+	// Build the encrypted listeners first, so certificate errors are
+	// reported before anything is bound
+	var tlsConfig *tls.Config
+	var httpsServer *http.Server
+	var err error
+	if s.TLSPort > 0 {
+		tlsConfig, err = gotls.NewServerTLSConfig(s.TLS)
+		if err != nil {
+			return fmt.Errorf("DNS over TLS: %w", err)
+		}
+	}
+	if s.HTTPSPort > 0 {
+		mux := http.NewServeMux()
+		mux.Handle(DoHPath, s)
+		httpsServer, err = transport.NewHTTPServer(net.JoinHostPort(s.Address, strconv.Itoa(s.HTTPSPort)), mux, s.TLS, transport.ServerOptions{})
+		if err != nil {
+			return fmt.Errorf("DNS over HTTPS: %w", err)
+		}
+	}
 
-	// Try to bind to the port to check if it's available
-	listener, err := net.ListenPacket("udp", addr)
+	packetConn, listener, err := s.listen()
 	if err != nil {
-		// If the original port is unavailable, try to find a free port
-		if s.Port > 1024 { // Only for non-privileged ports
-			for testPort := s.Port + 1; testPort < s.Port+100; testPort++ {
-				testAddr := fmt.Sprintf("%s:%d", s.Address, testPort)
-				listener, err = net.ListenPacket("udp", testAddr)
-				if err == nil {
-					s.Port = testPort
-					addr = testAddr
-					fmt.Printf("Original port was busy, using port %d instead\n", testPort)
-					break
-				}
-			}
+		return err
+	}
+
+	// All listeners share the handler, TCP carries answers too large
+	// for UDP
+	handler := dns.HandlerFunc(s.handleRequest)
+	servers := []*dns.Server{
+		{PacketConn: packetConn, Net: "udp", Handler: handler},
+		{Listener: listener, Net: "tcp", Handler: handler},
+	}
+	listeners := []net.Listener{listener}
+
+	if tlsConfig != nil {
+		addr := net.JoinHostPort(s.Address, strconv.Itoa(s.TLSPort))
+		tlsListener, err := tls.Listen("tcp", addr, tlsConfig)
+		if err != nil {
+			closeAll(packetConn, listeners)
+			return fmt.Errorf("failed to bind DNS over TLS to %s: %w", addr, err)
 		}
+		servers = append(servers, &dns.Server{Listener: tlsListener, Net: "tcp-tls", Handler: handler})
+		listeners = append(listeners, tlsListener)
+		fmt.Printf("Serving DNS over TLS on %s\n", addr)
+	}
 
+	var httpsListener net.Listener
+	if httpsServer != nil {
+		httpsListener, err = net.Listen("tcp", httpsServer.Addr)
 		if err != nil {
-			return fmt.Errorf("failed to bind to any port: %w", err)
+			closeAll(packetConn, listeners)
+			return fmt.Errorf("failed to bind DNS over HTTPS to %s: %w", httpsServer.Addr, err)
 		}
+		fmt.Printf("Serving DNS over HTTPS on https://%s%s\n", httpsServer.Addr, DoHPath)
+	}
+
+	// Store server references
+	s.mu.Lock()
+	s.servers = servers
+	s.httpsServer = httpsServer
+	s.mu.Unlock()
+
+	// Start servers
+	fmt.Printf("Starting DNS server on %s (UDP and TCP)\n", net.JoinHostPort(s.Address, strconv.Itoa(s.Port)))
+	errChan := make(chan error, len(servers)+1)
+	for _, server := range servers {
+		go func(server *dns.Server) {
+			errChan <- server.ActivateAndServe()
+		}(server)
+	}
+	if httpsServer != nil {
+		go func() {
+			err := httpsServer.ServeTLS(httpsListener, "", "")
+			if errors.Is(err, http.ErrServerClosed) {
+				err = nil
+			}
+			errChan <- err
+		}()
+	}
+
+	// When one listener fails, take the others down with it
+	err = <-errChan
+	s.Stop()
+	return err
+}
+
+// closeAll closes the sockets bound so far when a later bind fails
+func closeAll(packetConn net.PacketConn, listeners []net.Listener) {
+	packetConn.Close()
+	for _, listener := range listeners {
+		listener.Close()
+	}
+}
+
+// listen binds the UDP and TCP sockets on the same port. If the port is
+// busy, the next free non-privileged port is used instead.
+func (s *Server) listen() (net.PacketConn, net.Listener, error) {
+	packetConn, listener, err := listenPort(s.Address, s.Port)
+	if err == nil {
+		return packetConn, listener, nil
 	}
 
-	// Create a DNS server using the established listener
-	dnsServer := &dns.Server{
-		PacketConn: listener,
-		Net:        "udp",
+	// If the original port is unavailable, try to find a free port
+	if s.Port > 1024 { // Only for non-privileged ports
+		for testPort := s.Port + 1; testPort < s.Port+100; testPort++ {
+			packetConn, listener, err = listenPort(s.Address, testPort)
+			if err == nil {
+				s.Port = testPort
+				fmt.Printf("Original port was busy, using port %d instead\n", testPort)
+				return packetConn, listener, nil
+			}
+		}
 	}
 
-	// Set request handler
-	dns.HandleFunc(".", s.handleRequest)
+	return nil, nil, fmt.Errorf("failed to bind to any port: %w", err)
+}
 
-	// Store server reference
-	s.server = dnsServer
+// listenPort binds UDP and TCP on address:port, closing both if either fails
+func listenPort(address string, port int) (net.PacketConn, net.Listener, error) {
+	addr := net.JoinHostPort(address, strconv.Itoa(port))
 
-	// Start server
-	fmt.Printf("Starting DNS server on %s\n", addr)
-	return dnsServer.ActivateAndServe()
+	packetConn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		packetConn.Close()
+		return nil, nil, err
+	}
+	return packetConn, listener, nil
 }
 
 func (s *Server) handleRequest(w dns.ResponseWriter, r *dns.Msg) {
 	// Create a new response message
 	m := new(dns.Msg)
 	m.SetReply(r)
-	m.Compress = false
 	m.Authoritative = true
 
-	// Copy recursion desired flag from request (but don't actually do recursion)
+	// Recursion is only available through a forwarder
 	m.RecursionDesired = r.RecursionDesired
-	m.RecursionAvailable = false
+	m.RecursionAvailable = s.Forwarder != nil
+	recurse := s.Forwarder != nil && r.RecursionDesired
 
 	// Initialize response code as success
 	m.Rcode = dns.RcodeSuccess
 
+	// Names without local records are resolved upstream
+	if recurse && len(r.Question) == 1 {
+		if _, local := s.findOwner(r.Question[0].Name); !local {
+			s.forward(w, r)
+			return
+		}
+	}
+
 	// Flag to track if we found any valid records
 	recordFound := false
+	nameExists := false
 
 	// Process each question
 	for _, question := range r.Question {
 		fmt.Printf("Query: %s, type: %d\n", question.Name, question.Qtype)
 
-		switch question.Qtype {
-		case dns.TypeA:
-			foundRecord := s.handleARecord(question, m)
-			recordFound = recordFound || foundRecord
-		case dns.TypeAAAA:
-			// We don't support IPv6 yet
-			// Don't set NXDOMAIN here, just don't add any records
-		default:
-			// For other types, just don't add any records
-		}
+		found, exists := s.answerQuestion(question, m, recurse)
+		recordFound = recordFound || found
+		nameExists = nameExists || exists
 	}
 
-	// Only set NXDOMAIN if we didn't find any records for any question
-	if !recordFound && len(m.Answer) == 0 {
+	// A name that exists without records of the queried type gets an empty
+	// NOERROR (NODATA), only unknown names get NXDOMAIN
+	if !recordFound && len(m.Answer) == 0 && !nameExists {
 		m.Rcode = dns.RcodeNameError
 	}
 
 	// Send response
-	w.WriteMsg(m)
+	writeResponse(w, r, m)
 }
 
-// Modified handleARecord to return whether it found a record
-func (s *Server) handleARecord(q dns.Question, m *dns.Msg) bool {
-	// Look for an exact match first
-	record, exists := s.Storage.Get(q.Name)
+// writeResponse sends m in reply to r, compressed and truncated to the
+// size the client can receive. Over UDP that is 512 bytes, or the EDNS0
+// buffer size of r (RFC 6891) capped at the size we advertise, with TC set
+// when records had to be dropped so the client retries over TCP.
+func writeResponse(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg) {
+	m.Compress = true
 
-	// If not found, try to match wildcards
-	if !exists {
-		// Wildcard matching code...
+	// Answer EDNS0 with our own OPT record, and only if the client sent one
+	extra := make([]dns.RR, 0, len(m.Extra))
+	for _, rr := range m.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			extra = append(extra, rr)
+		}
+	}
+	m.Extra = extra
+	opt := r.IsEdns0()
+	if opt != nil {
+		m.SetEdns0(ednsBufferSize, opt.Do())
 	}
 
-	if exists {
-		if record.Type == dnsrecords.A {
-			rr, err := dns.NewRR(fmt.Sprintf("%s %d IN A %s", q.Name, record.TTL, record.Value))
-			if err == nil {
-				m.Answer = append(m.Answer, rr)
-				return true
+	size := dns.MaxMsgSize
+	if _, udp := w.RemoteAddr().(*net.UDPAddr); udp {
+		size = dns.MinMsgSize
+		if opt != nil {
+			size = max(min(int(opt.UDPSize()), ednsBufferSize), dns.MinMsgSize)
+		}
+	}
+	m.Truncate(size)
+
+	if err := w.WriteMsg(m); err != nil {
+		fmt.Printf("Failed to send response: %v\n", err)
+	}
+}
+
+// hasName reports whether name exists in the records file or storage
+func (s *Server) hasName(name string) bool {
+	if s.RecordsFile != nil && s.RecordsFile.Records().HasName(name) {
+		return true
+	}
+	return s.Storage != nil && s.Storage.HasName(name)
+}
+
+// getRecords returns the record set of recordType at name from the layer
+// owning name
+func (s *Server) getRecords(name string, recordType dnsrecords.RecordType, value string) ([]dnsrecords.Record, bool) {
+	layer := s.layerFor(name)
+	if layer == nil {
+		return nil, false
+	}
+	return layer.Get(name, recordType, value)
+}
+
+// layerFor returns the records answering for name: the records file if it
+// holds any record at name, otherwise storage. Mixing layers per type would
+// let a CNAME in one hide or contradict the records of the other.
+func (s *Server) layerFor(name string) *dnsrecords.Storage {
+	if s.RecordsFile != nil {
+		if records := s.RecordsFile.Records(); records.HasRecords(name) {
+			return records
+		}
+	}
+	return s.Storage
+}
+
+// findOwner returns the stored name whose records answer qname, following
+// RFC 4592: qname itself if it exists, otherwise the wildcard at its
+// closest encloser. Explicit names, including empty non-terminals, always
+// take priority over wildcards.
+func (s *Server) findOwner(qname string) (string, bool) {
+	if s.hasName(qname) {
+		return qname, true
+	}
+
+	// Walk up to the closest existing ancestor, the root always exists
+	encloser := qname
+	for encloser != "." {
+		if i := strings.Index(encloser, "."); i >= 0 && i < len(encloser)-1 {
+			encloser = encloser[i+1:]
+		} else {
+			encloser = "."
+		}
+		if encloser == "." || s.hasName(encloser) {
+			break
+		}
+	}
+
+	// Only the wildcard directly below the closest encloser applies
+	wildcard := "*." + strings.TrimPrefix(encloser, ".")
+	if s.hasName(wildcard) {
+		return wildcard, true
+	}
+	return "", false
+}
+
+// forward answers r with the response of the upstreams, SERVFAIL if none
+// of them answers
+func (s *Server) forward(w dns.ResponseWriter, r *dns.Msg) {
+	resp, err := s.Forwarder.Forward(r)
+	if err != nil {
+		fmt.Printf("Forwarding %s failed: %v\n", r.Question[0].Name, err)
+		resp = new(dns.Msg)
+		resp.SetRcode(r, dns.RcodeServerFailure)
+	}
+	resp.RecursionAvailable = true
+	writeResponse(w, r, resp)
+}
+
+// answerQuestion adds the answers for q to m, following CNAMEs between
+// local names, and to upstream names if recurse is set. A loop or a chain
+// longer than maxCNAMEChain sets SERVFAIL, like resolvers do, with the
+// chain followed so far. It returns whether any record was added and
+// whether the query name exists.
+func (s *Server) answerQuestion(q dns.Question, m *dns.Msg, recurse bool) (bool, bool) {
+	recordType, supported := recordTypes[q.Qtype]
+
+	found := false
+	name := q.Name
+	visited := make(map[string]bool)
+	for depth := 0; depth <= maxCNAMEChain; depth++ {
+		// Find the name holding the answer, which may be a wildcard
+		owner, exists := s.findOwner(name)
+		if !exists {
+			// Targets outside the local records are resolved upstream
+			// when recursing, otherwise left to the client
+			if depth > 0 && recurse {
+				found = s.resolveTarget(name, q, m) || found
+			}
+			return found, depth > 0
+		}
+		visited[strings.ToLower(name)] = true
+
+		// A CNAME replaces every other type at its name (RFC 1034 3.6.2)
+		if q.Qtype != dns.TypeCNAME {
+			if cname, isCNAME := s.getRecords(owner, dnsrecords.CNAME, ""); isCNAME {
+				found = s.handleRecords(name, cname, m) || found
+				name = cname[0].Value
+				if visited[name] {
+					fmt.Printf("CNAME loop at %s\n", name)
+					m.Rcode = dns.RcodeServerFailure
+					return found, true
+				}
+				continue
 			}
-		} else if record.Type == dnsrecords.CNAME {
-			// CNAME handling...
-			return true
 		}
+
+		if supported {
+			records, _ := s.getRecords(owner, recordType, "")
+			found = s.handleRecords(name, records, m) || found
+			s.addGlue(records, m)
+		}
+		return found, true
 	}
 
-	return false
+	fmt.Printf("CNAME chain for %s longer than %d, stopped\n", q.Name, maxCNAMEChain)
+	m.Rcode = dns.RcodeServerFailure
+	return found, true
 }
 
-// Stop stops the DNS server
+// resolveTarget adds the upstream answer for the CNAME target name to m
+// and returns whether any record was added
+func (s *Server) resolveTarget(name string, q dns.Question, m *dns.Msg) bool {
+	req := new(dns.Msg)
+	req.SetQuestion(name, q.Qtype)
+	req.Question[0].Qclass = q.Qclass
+
+	resp, err := s.Forwarder.Forward(req)
+	if err != nil {
+		fmt.Printf("Resolving CNAME target %s failed: %v\n", name, err)
+		m.Rcode = dns.RcodeServerFailure
+		return false
+	}
+
+	// The answer is no longer all authoritative data, and the rcode
+	// describes the end of the chain (RFC 6604)
+	m.Authoritative = false
+	m.Answer = append(m.Answer, resp.Answer...)
+	if resp.Rcode == dns.RcodeNameError || resp.Rcode == dns.RcodeServerFailure {
+		m.Rcode = resp.Rcode
+	}
+	return len(resp.Answer) > 0
+}
+
+// handleRecords adds records to the answer under name, which is the query
+// name rather than the owner for wildcard matches, and returns whether any
+// were added
+func (s *Server) handleRecords(name string, records []dnsrecords.Record, m *dns.Msg) bool {
+	added := false
+	for _, record := range s.rotate(records) {
+		m.Answer = append(m.Answer, record.RR(name))
+		added = true
+	}
+	return added
+}
+
+// addGlue adds the local addresses of the hosts named by MX, SRV and NS
+// records to the additional section, saving clients a lookup
+func (s *Server) addGlue(records []dnsrecords.Record, m *dns.Msg) {
+	for _, record := range records {
+		if record.Type != dnsrecords.MX && record.Type != dnsrecords.SRV && record.Type != dnsrecords.NS {
+			continue
+		}
+		for _, recordType := range []dnsrecords.RecordType{dnsrecords.A, dnsrecords.AAAA} {
+			addresses, _ := s.getRecords(record.Value, recordType, "")
+			for _, address := range addresses {
+				m.Extra = append(m.Extra, address.RR(record.Value))
+			}
+		}
+	}
+}
+
+// rotate returns records starting at a position that advances with every
+// call, so clients taking the first address are spread over the set
+func (s *Server) rotate(records []dnsrecords.Record) []dnsrecords.Record {
+	if len(records) < 2 {
+		return records
+	}
+
+	start := int(s.rotation.Add(1) % uint32(len(records)))
+	rotated := make([]dnsrecords.Record, 0, len(records))
+	rotated = append(rotated, records[start:]...)
+	return append(rotated, records[:start]...)
+}
+
+// Stop stops all listeners of the DNS server
 func (s *Server) Stop() error {
-	if s.server != nil {
-		return s.server.Shutdown()
+	s.mu.Lock()
+	servers := s.servers
+	httpsServer := s.httpsServer
+	s.servers = nil
+	s.httpsServer = nil
+	s.mu.Unlock()
+
+	var errs []error
+	if httpsServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := httpsServer.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop DNS over HTTPS listener: %w", err))
+		}
+	}
+	for _, server := range servers {
+		if err := server.Shutdown(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop %s listener: %w", server.Net, err))
+		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
-// StartWithSignalHandling starts the DNS server and handles termination signals
+// Reload rereads the storage and records files, as on SIGHUP
+func (s *Server) Reload() {
+	if s.Storage != nil {
+		reloadStorage(s.Storage)
+	}
+	if s.RecordsFile != nil {
+		if err := s.RecordsFile.Reload(); err != nil {
+			fmt.Printf("Keeping previous records, reload failed: %v\n", err)
+		} else {
+			fmt.Printf("Reloaded %d records from %s\n", len(s.RecordsFile.Records().List()), s.RecordsFile.Path())
+		}
+	}
+}
+
+// StartWithSignalHandling starts the DNS server and handles termination
+// signals. SIGHUP reloads the records.
 func (s *Server) StartWithSignalHandling() error {
 	// Create a channel to listen for OS signals
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
 	// Start the server in a goroutine
 	errChan := make(chan error)
@@ -170,12 +552,19 @@ func (s *Server) StartWithSignalHandling() error {
 	}()
 
 	// Wait for either an error or a signal
-	select {
-	case err := <-errChan:
-		return err
-	case sig := <-sigChan:
-		fmt.Printf("Received signal: %v\n", sig)
-		fmt.Println("Shutting down DNS server...")
-		return s.Stop()
+	for {
+		select {
+		case err := <-errChan:
+			return err
+		case sig := <-sigChan:
+			if sig == syscall.SIGHUP {
+				fmt.Println("Received SIGHUP, reloading records...")
+				s.Reload()
+				continue
+			}
+			fmt.Printf("Received signal: %v\n", sig)
+			fmt.Println("Shutting down DNS server...")
+			return s.Stop()
+		}
 	}
 }
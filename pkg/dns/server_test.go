@@ -0,0 +1,378 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bxtal-lsn/gotransport/internal/dnsrecords"
+	"github.com/miekg/dns"
+)
+
+// recorder is a dns.ResponseWriter that keeps the response it is given
+type recorder struct {
+	dns.ResponseWriter
+	remote net.Addr
+	msg    *dns.Msg
+}
+
+func (r *recorder) RemoteAddr() net.Addr {
+	return r.remote
+}
+
+func (r *recorder) WriteMsg(m *dns.Msg) error {
+	r.msg = m
+	return nil
+}
+
+// newTestServer returns a server answering from records held in storage
+func newTestServer(t *testing.T, records ...dnsrecords.Record) *Server {
+	t.Helper()
+	storage, err := dnsrecords.NewMemoryStorage(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Server{Storage: storage}
+}
+
+// query sends a question for name and qtype to s over TCP and returns
+// the response
+func query(s *Server, name string, qtype uint16) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(name, qtype)
+	w := &recorder{remote: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}}
+	s.handleRequest(w, req)
+	return w.msg
+}
+
+// answers returns the answer section as "<owner> <data>" lines
+func answers(m *dns.Msg) []string {
+	var lines []string
+	for _, rr := range m.Answer {
+		data := strings.TrimPrefix(rr.String(), rr.Header().String())
+		lines = append(lines, rr.Header().Name+" "+data)
+	}
+	return lines
+}
+
+func TestWildcards(t *testing.T) {
+	s := newTestServer(t,
+		dnsrecords.Record{Domain: "*.a.example", Type: dnsrecords.A, Value: "10.0.0.1", TTL: 60},
+		dnsrecords.Record{Domain: "*.b.a.example", Type: dnsrecords.A, Value: "10.0.0.2", TTL: 60},
+		dnsrecords.Record{Domain: "explicit.a.example", Type: dnsrecords.A, Value: "10.0.0.3", TTL: 60},
+		dnsrecords.Record{Domain: "deep.ent.a.example", Type: dnsrecords.A, Value: "10.0.0.4", TTL: 60},
+	)
+
+	tests := []struct {
+		name  string
+		qname string
+		qtype uint16
+		rcode int
+		want  []string
+	}{
+		{"wildcard", "x.a.example.", dns.TypeA, dns.RcodeSuccess, []string{"x.a.example. 10.0.0.1"}},
+		{"several labels below wildcard", "y.x.a.example.", dns.TypeA, dns.RcodeSuccess, []string{"y.x.a.example. 10.0.0.1"}},
+		{"closest encloser wildcard", "x.b.a.example.", dns.TypeA, dns.RcodeSuccess, []string{"x.b.a.example. 10.0.0.2"}},
+		{"several labels below closer wildcard", "y.x.b.a.example.", dns.TypeA, dns.RcodeSuccess, []string{"y.x.b.a.example. 10.0.0.2"}},
+		{"query name case kept", "X.A.Example.", dns.TypeA, dns.RcodeSuccess, []string{"X.A.Example. 10.0.0.1"}},
+		{"wildcard name itself", "*.a.example.", dns.TypeA, dns.RcodeSuccess, []string{"*.a.example. 10.0.0.1"}},
+		{"explicit name below wildcard", "explicit.a.example.", dns.TypeA, dns.RcodeSuccess, []string{"explicit.a.example. 10.0.0.3"}},
+		{"explicit name without type", "explicit.a.example.", dns.TypeAAAA, dns.RcodeSuccess, nil},
+		{"below explicit name", "z.explicit.a.example.", dns.TypeA, dns.RcodeNameError, nil},
+		{"empty non-terminal", "ent.a.example.", dns.TypeA, dns.RcodeSuccess, nil},
+		{"below empty non-terminal", "x.ent.a.example.", dns.TypeA, dns.RcodeNameError, nil},
+		{"empty non-terminal above wildcard", "b.a.example.", dns.TypeA, dns.RcodeSuccess, nil},
+		{"wildcard without type", "x.a.example.", dns.TypeAAAA, dns.RcodeSuccess, nil},
+		{"closest encloser without wildcard", "a.example.", dns.TypeA, dns.RcodeSuccess, nil},
+		{"unknown name", "other.example.", dns.TypeA, dns.RcodeNameError, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := query(s, tt.qname, tt.qtype)
+			if m.Rcode != tt.rcode {
+				t.Errorf("rcode %s, want %s", dns.RcodeToString[m.Rcode], dns.RcodeToString[tt.rcode])
+			}
+			if got := answers(m); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("answers %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// serveLocal serves s on local UDP and TCP ports and returns their addresses
+func serveLocal(t *testing.T, s *Server) (string, string) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+
+	handler := dns.HandlerFunc(s.handleRequest)
+	for _, server := range []*dns.Server{
+		{PacketConn: conn, Net: "udp", Handler: handler},
+		{Listener: listener, Net: "tcp", Handler: handler},
+	} {
+		go server.ActivateAndServe()
+		t.Cleanup(func() { server.Shutdown() })
+	}
+	return conn.LocalAddr().String(), listener.Addr().String()
+}
+
+func TestTruncation(t *testing.T) {
+	// 100 addresses need about 1.6 KB even compressed
+	var records []dnsrecords.Record
+	for i := 0; i < 100; i++ {
+		records = append(records, dnsrecords.Record{Domain: "many.test", Type: dnsrecords.A, Value: fmt.Sprintf("10.0.%d.%d", i/250, i%250+1), TTL: 60})
+	}
+	udpAddr, tcpAddr := serveLocal(t, newTestServer(t, records...))
+
+	tests := []struct {
+		name    string
+		bufsize uint16
+		limit   int
+	}{
+		{"no EDNS0", 0, dns.MinMsgSize},
+		{"small buffer", 256, dns.MinMsgSize},
+		{"advertised buffer", ednsBufferSize, ednsBufferSize},
+		{"larger buffer capped", 4096, ednsBufferSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := new(dns.Msg)
+			req.SetQuestion("many.test.", dns.TypeA)
+			if tt.bufsize > 0 {
+				req.SetEdns0(tt.bufsize, false)
+			}
+
+			// The client reads up to 64 KB so it sees whatever was sent
+			udp := &dns.Client{Net: "udp", UDPSize: dns.MaxMsgSize, Timeout: 2 * time.Second}
+			resp, _, err := udp.Exchange(req, udpAddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Packed as sent, with name compression
+			resp.Compress = true
+			packed, _ := resp.Pack()
+			if !resp.Truncated || len(resp.Answer) == len(records) {
+				t.Errorf("UDP response with %d of %d answers, TC = %v", len(resp.Answer), len(records), resp.Truncated)
+			}
+			if len(packed) > tt.limit {
+				t.Errorf("UDP response of %d bytes, limit %d", len(packed), tt.limit)
+			}
+
+			// Retried over TCP, as the TC bit asks, the answer is complete
+			tcp := &dns.Client{Net: "tcp", Timeout: 2 * time.Second}
+			resp, _, err = tcp.Exchange(req, tcpAddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Truncated || len(resp.Answer) != len(records) {
+				t.Errorf("TCP response with %d of %d answers, TC = %v", len(resp.Answer), len(records), resp.Truncated)
+			}
+		})
+	}
+}
+
+// newLayeredServer returns a server answering from a records file holding
+// fileRecords, layered over a storage holding storageRecords
+func newLayeredServer(t *testing.T, fileRecords, storageRecords []dnsrecords.Record) *Server {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "dns.yaml")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dnsrecords.WriteYAML(file, fileRecords); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	recordsFile, err := LoadRecordsFile(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, storageRecords...)
+	s.RecordsFile = recordsFile
+	return s
+}
+
+func TestRecordsFileLayering(t *testing.T) {
+	s := newLayeredServer(t,
+		[]dnsrecords.Record{
+			{Domain: "web.test", Type: dnsrecords.A, Value: "10.1.0.1", TTL: 60},
+			{Domain: "alias.test", Type: dnsrecords.CNAME, Value: "web.test.", TTL: 60},
+			{Domain: "mail.test", Type: dnsrecords.TXT, Text: []string{"from file"}, TTL: 60},
+		},
+		[]dnsrecords.Record{
+			{Domain: "web.test", Type: dnsrecords.A, Value: "10.2.0.1", TTL: 60},
+			{Domain: "web.test", Type: dnsrecords.AAAA, Value: "fd00::1", TTL: 60},
+			{Domain: "alias.test", Type: dnsrecords.A, Value: "10.2.0.2", TTL: 60},
+			{Domain: "mail.test", Type: dnsrecords.CNAME, Value: "elsewhere.test.", TTL: 60},
+			{Domain: "only.test", Type: dnsrecords.A, Value: "10.2.0.3", TTL: 60},
+			{Domain: "mx.test", Type: dnsrecords.MX, Value: "web.test.", Priority: 10, TTL: 60},
+		})
+
+	tests := []struct {
+		name  string
+		qname string
+		qtype uint16
+		want  []string
+		extra []string
+	}{
+		{"file set replaces storage set", "web.test.", dns.TypeA, []string{"web.test. 10.1.0.1"}, nil},
+		{"file name hides other storage types", "web.test.", dns.TypeAAAA, nil, nil},
+		{"file CNAME hides storage records", "alias.test.", dns.TypeA, []string{"alias.test. web.test.", "web.test. 10.1.0.1"}, nil},
+		{"storage CNAME does not shadow file records", "mail.test.", dns.TypeTXT, []string{`mail.test. "from file"`}, nil},
+		{"storage CNAME not followed for file name", "mail.test.", dns.TypeA, nil, nil},
+		{"storage answers names not in the file", "only.test.", dns.TypeA, []string{"only.test. 10.2.0.3"}, nil},
+		{"glue comes from the owning layer", "mx.test.", dns.TypeMX, []string{"mx.test. 10 web.test."}, []string{"web.test. 10.1.0.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := query(s, tt.qname, tt.qtype)
+			if m.Rcode != dns.RcodeSuccess {
+				t.Errorf("rcode %s", dns.RcodeToString[m.Rcode])
+			}
+			if got := answers(m); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("answers %q, want %q", got, tt.want)
+			}
+			var extra []string
+			for _, rr := range m.Extra {
+				if rr.Header().Rrtype != dns.TypeOPT {
+					extra = append(extra, rr.Header().Name+" "+strings.TrimPrefix(rr.String(), rr.Header().String()))
+				}
+			}
+			if strings.Join(extra, "\n") != strings.Join(tt.extra, "\n") {
+				t.Errorf("additional %q, want %q", extra, tt.extra)
+			}
+		})
+	}
+}
+
+func TestAddressRecords(t *testing.T) {
+	s := newTestServer(t,
+		dnsrecords.Record{Domain: "dual.test", Type: dnsrecords.A, Value: "10.0.0.1", TTL: 60},
+		dnsrecords.Record{Domain: "dual.test", Type: dnsrecords.A, Value: "10.0.0.2", TTL: 60},
+		dnsrecords.Record{Domain: "dual.test", Type: dnsrecords.AAAA, Value: "fd00::1", TTL: 60},
+		dnsrecords.Record{Domain: "v4.test", Type: dnsrecords.A, Value: "10.0.0.3", TTL: 60},
+		dnsrecords.Record{Domain: "v6.test", Type: dnsrecords.AAAA, Value: "fd00::2", TTL: 60},
+	)
+
+	tests := []struct {
+		name  string
+		qname string
+		qtype uint16
+		rcode int
+		want  []string
+	}{
+		{"A set", "dual.test.", dns.TypeA, dns.RcodeSuccess, []string{"dual.test. 10.0.0.1", "dual.test. 10.0.0.2"}},
+		{"AAAA beside A", "dual.test.", dns.TypeAAAA, dns.RcodeSuccess, []string{"dual.test. fd00::1"}},
+		{"AAAA only", "v6.test.", dns.TypeAAAA, dns.RcodeSuccess, []string{"v6.test. fd00::2"}},
+		{"NODATA for AAAA", "v4.test.", dns.TypeAAAA, dns.RcodeSuccess, nil},
+		{"NODATA for A", "v6.test.", dns.TypeA, dns.RcodeSuccess, nil},
+		{"NXDOMAIN for AAAA", "none.test.", dns.TypeAAAA, dns.RcodeNameError, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := query(s, tt.qname, tt.qtype)
+			if m.Rcode != tt.rcode {
+				t.Errorf("rcode %s, want %s", dns.RcodeToString[m.Rcode], dns.RcodeToString[tt.rcode])
+			}
+			// Sets are served in rotating order
+			got := answers(m)
+			sort.Strings(got)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("answers %q, want %q", got, tt.want)
+			}
+			for _, rr := range m.Answer {
+				if rr.Header().Rrtype != tt.qtype {
+					t.Errorf("answer %s is not of the queried type", rr)
+				}
+			}
+		})
+	}
+}
+
+// cnameChain returns CNAMEs from <prefix>0.test through <prefix><n-1>.test,
+// each pointing to the next, and an A record at <prefix><n>.test
+func cnameChain(prefix string, n int) []dnsrecords.Record {
+	var records []dnsrecords.Record
+	for i := 0; i < n; i++ {
+		records = append(records, dnsrecords.Record{Domain: fmt.Sprintf("%s%d.test", prefix, i), Type: dnsrecords.CNAME, Value: fmt.Sprintf("%s%d.test.", prefix, i+1), TTL: 60})
+	}
+	return append(records, dnsrecords.Record{Domain: fmt.Sprintf("%s%d.test", prefix, n), Type: dnsrecords.A, Value: "10.0.9.1", TTL: 60})
+}
+
+func TestCNAMEs(t *testing.T) {
+	records := []dnsrecords.Record{
+		{Domain: "web.test", Type: dnsrecords.A, Value: "10.0.0.1", TTL: 60},
+		{Domain: "web.test", Type: dnsrecords.TXT, Text: []string{"web"}, TTL: 60},
+		{Domain: "alias.test", Type: dnsrecords.CNAME, Value: "web.test.", TTL: 60},
+		{Domain: "double.test", Type: dnsrecords.CNAME, Value: "alias.test.", TTL: 60},
+		{Domain: "*.wild.test", Type: dnsrecords.CNAME, Value: "web.test.", TTL: 60},
+		{Domain: "outside.test", Type: dnsrecords.CNAME, Value: "example.com.", TTL: 60},
+		{Domain: "dangling.test", Type: dnsrecords.CNAME, Value: "missing.test.", TTL: 60},
+		{Domain: "a.loop.test", Type: dnsrecords.CNAME, Value: "b.loop.test.", TTL: 60},
+		{Domain: "b.loop.test", Type: dnsrecords.CNAME, Value: "a.loop.test.", TTL: 60},
+		{Domain: "self.loop.test", Type: dnsrecords.CNAME, Value: "a.loop.test.", TTL: 60},
+	}
+	records = append(records, cnameChain("max", maxCNAMEChain)...)
+	records = append(records, cnameChain("long", maxCNAMEChain+1)...)
+	s := newTestServer(t, records...)
+
+	chain := func(prefix string, n int, end string) []string {
+		var lines []string
+		for i := 0; i < n; i++ {
+			lines = append(lines, fmt.Sprintf("%s%d.test. %s%d.test.", prefix, i, prefix, i+1))
+		}
+		if end != "" {
+			lines = append(lines, end)
+		}
+		return lines
+	}
+
+	tests := []struct {
+		name  string
+		qname string
+		qtype uint16
+		rcode int
+		want  []string
+	}{
+		{"CNAME query not chased", "alias.test.", dns.TypeCNAME, dns.RcodeSuccess, []string{"alias.test. web.test."}},
+		{"chased to in-zone target", "alias.test.", dns.TypeA, dns.RcodeSuccess, []string{"alias.test. web.test.", "web.test. 10.0.0.1"}},
+		{"chased for other types", "alias.test.", dns.TypeTXT, dns.RcodeSuccess, []string{"alias.test. web.test.", `web.test. "web"`}},
+		{"target without type", "alias.test.", dns.TypeAAAA, dns.RcodeSuccess, []string{"alias.test. web.test."}},
+		{"chain of two", "double.test.", dns.TypeA, dns.RcodeSuccess, []string{"double.test. alias.test.", "alias.test. web.test.", "web.test. 10.0.0.1"}},
+		{"owner case insensitive", "ALIAS.Test.", dns.TypeA, dns.RcodeSuccess, []string{"ALIAS.Test. web.test.", "web.test. 10.0.0.1"}},
+		{"under wildcard", "x.wild.test.", dns.TypeA, dns.RcodeSuccess, []string{"x.wild.test. web.test.", "web.test. 10.0.0.1"}},
+		{"wildcard CNAME query", "x.wild.test.", dns.TypeCNAME, dns.RcodeSuccess, []string{"x.wild.test. web.test."}},
+		{"out-of-zone target without forwarder", "outside.test.", dns.TypeA, dns.RcodeSuccess, []string{"outside.test. example.com."}},
+		{"dangling in-zone target", "dangling.test.", dns.TypeA, dns.RcodeSuccess, []string{"dangling.test. missing.test."}},
+		{"loop", "a.loop.test.", dns.TypeA, dns.RcodeServerFailure, []string{"a.loop.test. b.loop.test.", "b.loop.test. a.loop.test."}},
+		{"into loop", "self.loop.test.", dns.TypeA, dns.RcodeServerFailure, []string{"self.loop.test. a.loop.test.", "a.loop.test. b.loop.test.", "b.loop.test. a.loop.test."}},
+		{"loop CNAME query", "a.loop.test.", dns.TypeCNAME, dns.RcodeSuccess, []string{"a.loop.test. b.loop.test."}},
+		{"chain at depth limit", "max0.test.", dns.TypeA, dns.RcodeSuccess, chain("max", maxCNAMEChain, fmt.Sprintf("max%d.test. 10.0.9.1", maxCNAMEChain))},
+		{"chain over depth limit", "long0.test.", dns.TypeA, dns.RcodeServerFailure, chain("long", maxCNAMEChain+1, "")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := query(s, tt.qname, tt.qtype)
+			if m.Rcode != tt.rcode {
+				t.Errorf("rcode %s, want %s", dns.RcodeToString[m.Rcode], dns.RcodeToString[tt.rcode])
+			}
+			if got := answers(m); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("answers %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
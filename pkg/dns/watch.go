@@ -0,0 +1,139 @@
+package dns
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bxtal-lsn/gotransport/internal/dnsrecords"
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay lets a burst of file events settle before reloading
+const reloadDelay = 100 * time.Millisecond
+
+// StorageWatcher reloads a storage when another process, such as dns add,
+// changes its file. It uses file system notifications and falls back to
+// polling where they are unavailable.
+type StorageWatcher struct {
+	storage  *dnsrecords.Storage
+	interval time.Duration
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewStorageWatcher creates a watcher for storage. A zero interval polls
+// every DefaultRecordsInterval when notifications are unavailable.
+func NewStorageWatcher(storage *dnsrecords.Storage, interval time.Duration) *StorageWatcher {
+	if interval <= 0 {
+		interval = DefaultRecordsInterval
+	}
+	return &StorageWatcher{
+		storage:  storage,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start begins watching the storage file
+func (w *StorageWatcher) Start() {
+	// Watch the directory, as saving replaces the file rather than
+	// writing to it
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		if err = watcher.Add(filepath.Dir(w.storage.Path())); err != nil {
+			watcher.Close()
+		}
+	}
+	if err != nil {
+		fmt.Printf("File notifications unavailable (%v), checking %s every %s\n", err, w.storage.Path(), w.interval)
+		go w.poll()
+		return
+	}
+	go w.notify(watcher)
+}
+
+// Stop stops watching the storage file
+func (w *StorageWatcher) Stop() {
+	w.once.Do(func() { close(w.stop) })
+}
+
+// notify reloads after events for the storage file
+func (w *StorageWatcher) notify(watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+
+	path := filepath.Clean(w.storage.Path())
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			timer.Stop()
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) == path && event.Has(fsnotify.Create|fsnotify.Write|fsnotify.Rename) {
+				timer.Reset(reloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			fmt.Printf("Watching %s failed: %v\n", path, err)
+		case <-timer.C:
+			reloadStorage(w.storage)
+		}
+	}
+}
+
+// poll reloads when the modification time or size of the file changes
+func (w *StorageWatcher) poll() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	var modTime time.Time
+	var size int64
+	if info, err := os.Stat(w.storage.Path()); err == nil {
+		modTime, size = info.ModTime(), info.Size()
+	}
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(w.storage.Path())
+			if err != nil || (info.ModTime().Equal(modTime) && info.Size() == size) {
+				continue
+			}
+			modTime, size = info.ModTime(), info.Size()
+			reloadStorage(w.storage)
+		}
+	}
+}
+
+// reloadStorage rereads storage and logs the records that changed
+func reloadStorage(storage *dnsrecords.Storage) {
+	diff, err := storage.Reload()
+	if err != nil {
+		fmt.Printf("Keeping previous records, reload failed: %v\n", err)
+		return
+	}
+	if diff.Empty() {
+		return
+	}
+
+	fmt.Printf("Reloaded %s: %d added, %d removed\n", storage.Path(), len(diff.Added), len(diff.Removed))
+	for _, record := range diff.Removed {
+		fmt.Printf("  - %s\n", record.RR(record.Domain))
+	}
+	for _, record := range diff.Added {
+		fmt.Printf("  + %s\n", record.RR(record.Domain))
+	}
+}
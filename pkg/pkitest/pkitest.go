@@ -0,0 +1,312 @@
+// Package pkitest creates certificate authorities and certificates entirely
+// in memory for use in tests. Keys are ECDSA P-256 so setups stay fast.
+//
+// Like net/http/httptest, functions panic on failure, since they only fail
+// on programming errors or a broken random source.
+package pkitest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/bxtal-lsn/gotransport/pkg/cert"
+)
+
+// DefaultValidity is the lifetime of certificates unless overridden
+const DefaultValidity = 24 * time.Hour
+
+// CA is an in-memory certificate authority, either a root or an intermediate
+type CA struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+	// Chain holds the intermediates between this CA and its root, nearest
+	// first. It is empty for a root.
+	Chain []*x509.Certificate
+	root  *x509.Certificate
+}
+
+// Leaf is an issued end-entity certificate with its key and issuing chain
+type Leaf struct {
+	Cert  *x509.Certificate
+	Key   crypto.Signer
+	Chain []*x509.Certificate
+}
+
+// Option customizes an issued certificate
+type Option func(*x509.Certificate)
+
+// NewCA creates a self-signed root CA
+func NewCA(commonName string, opts ...Option) *CA {
+	key := newKey()
+	template := &x509.Certificate{
+		SerialNumber:          newSerial(),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(10 * DefaultValidity),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	for _, opt := range opts {
+		opt(template)
+	}
+
+	c := sign(template, key.Public(), nil, key)
+	return &CA{Cert: c, Key: key, root: c}
+}
+
+// Intermediate creates a CA signed by ca
+func (ca *CA) Intermediate(commonName string, opts ...Option) *CA {
+	key := newKey()
+	template := &x509.Certificate{
+		SerialNumber:          newSerial(),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(5 * DefaultValidity),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	for _, opt := range opts {
+		opt(template)
+	}
+
+	c := sign(template, key.Public(), ca.Cert, ca.Key)
+	return &CA{
+		Cert:  c,
+		Key:   key,
+		Chain: append([]*x509.Certificate{c}, ca.Chain...),
+		root:  ca.root,
+	}
+}
+
+// Issue creates a leaf certificate valid for both server and client auth.
+// Without options it has no names; use WithDNSNames and friends.
+func (ca *CA) Issue(commonName string, opts ...Option) *Leaf {
+	key := newKey()
+	template := &x509.Certificate{
+		SerialNumber: newSerial(),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(DefaultValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, opt := range opts {
+		opt(template)
+	}
+
+	return &Leaf{
+		Cert:  sign(template, key.Public(), ca.Cert, ca.Key),
+		Key:   key,
+		Chain: ca.Chain,
+	}
+}
+
+// Server issues a server certificate for the given DNS names or IP addresses
+func (ca *CA) Server(names ...string) *Leaf {
+	cn := "server"
+	if len(names) > 0 {
+		cn = names[0]
+	}
+	return ca.Issue(cn, WithHosts(names...), WithExtKeyUsage(x509.ExtKeyUsageServerAuth))
+}
+
+// Client issues a client certificate with the given common name
+func (ca *CA) Client(commonName string, opts ...Option) *Leaf {
+	return ca.Issue(commonName, append([]Option{WithExtKeyUsage(x509.ExtKeyUsageClientAuth)}, opts...)...)
+}
+
+// Expired issues a server certificate that expired an hour ago
+func (ca *CA) Expired(names ...string) *Leaf {
+	return ca.Issue("expired", WithHosts(names...), WithValidity(time.Now().Add(-2*DefaultValidity), time.Now().Add(-time.Hour)))
+}
+
+// NotYetValid issues a server certificate that becomes valid in an hour
+func (ca *CA) NotYetValid(names ...string) *Leaf {
+	return ca.Issue("not-yet-valid", WithHosts(names...), WithValidity(time.Now().Add(time.Hour), time.Now().Add(DefaultValidity)))
+}
+
+// WrongEKU issues a certificate for names that is only valid for client
+// auth, so it is rejected when presented by a server
+func (ca *CA) WrongEKU(names ...string) *Leaf {
+	return ca.Issue("wrong-eku", WithHosts(names...), WithExtKeyUsage(x509.ExtKeyUsageClientAuth))
+}
+
+// WrongHost issues a server certificate for a name no test will dial
+func (ca *CA) WrongHost() *Leaf {
+	return ca.Server("wrong-host.invalid")
+}
+
+// Pool returns a pool containing the root of ca
+func (ca *CA) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.root)
+	return pool
+}
+
+// Root returns the root certificate ca chains to
+func (ca *CA) Root() *x509.Certificate {
+	return ca.root
+}
+
+// CertPEM returns the PEM encoded CA certificate
+func (ca *CA) CertPEM() []byte {
+	return certPEM(ca.Cert)
+}
+
+// TLSCertificate returns the leaf and its chain as a tls.Certificate
+func (l *Leaf) TLSCertificate() tls.Certificate {
+	der := [][]byte{l.Cert.Raw}
+	for _, c := range l.Chain {
+		der = append(der, c.Raw)
+	}
+	return tls.Certificate{
+		Certificate: der,
+		PrivateKey:  l.Key,
+		Leaf:        l.Cert,
+	}
+}
+
+// CertPEM returns the PEM encoded leaf followed by its chain
+func (l *Leaf) CertPEM() []byte {
+	out := certPEM(l.Cert)
+	for _, c := range l.Chain {
+		out = append(out, certPEM(c)...)
+	}
+	return out
+}
+
+// KeyPEM returns the PEM encoded PKCS #8 private key
+func (l *Leaf) KeyPEM() []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(l.Key)
+	if err != nil {
+		panic("pkitest: marshal key: " + err.Error())
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// ServerConfig returns a server configuration presenting leaf. If clientCA
+// is not nil, clients must present a certificate issued under it.
+func ServerConfig(leaf *Leaf, clientCA *CA) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{leaf.TLSCertificate()},
+	}
+	if clientCA != nil {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = clientCA.Pool()
+	}
+	return cfg
+}
+
+// ClientConfig returns a client configuration trusting serverCA and
+// verifying serverName. If leaf is not nil it is presented to the server.
+func ClientConfig(serverCA *CA, serverName string, leaf *Leaf) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    serverCA.Pool(),
+		ServerName: serverName,
+	}
+	if leaf != nil {
+		cfg.Certificates = []tls.Certificate{leaf.TLSCertificate()}
+	}
+	return cfg
+}
+
+// WithHosts adds DNS names or, for parseable addresses, IP SANs
+func WithHosts(hosts ...string) Option {
+	return func(c *x509.Certificate) {
+		for _, h := range hosts {
+			if ip := net.ParseIP(h); ip != nil {
+				c.IPAddresses = append(c.IPAddresses, ip)
+			} else {
+				c.DNSNames = append(c.DNSNames, h)
+			}
+		}
+	}
+}
+
+// WithURIs adds URI SANs
+func WithURIs(uris ...string) Option {
+	return func(c *x509.Certificate) {
+		for _, u := range uris {
+			parsed, err := url.Parse(u)
+			if err != nil {
+				panic("pkitest: invalid URI " + u)
+			}
+			c.URIs = append(c.URIs, parsed)
+		}
+	}
+}
+
+// WithSPIFFEID makes the certificate an X.509-SVID for id
+func WithSPIFFEID(id string) Option {
+	return func(c *x509.Certificate) {
+		parsed, err := cert.ParseSPIFFEID(id)
+		if err != nil {
+			panic("pkitest: " + err.Error())
+		}
+		c.URIs = []*url.URL{parsed}
+	}
+}
+
+// WithSubject replaces the subject
+func WithSubject(name pkix.Name) Option {
+	return func(c *x509.Certificate) {
+		c.Subject = name
+	}
+}
+
+// WithExtKeyUsage replaces the extended key usages
+func WithExtKeyUsage(usages ...x509.ExtKeyUsage) Option {
+	return func(c *x509.Certificate) {
+		c.ExtKeyUsage = usages
+	}
+}
+
+// WithValidity sets the validity period
+func WithValidity(notBefore, notAfter time.Time) Option {
+	return func(c *x509.Certificate) {
+		c.NotBefore = notBefore
+		c.NotAfter = notAfter
+	}
+}
+
+func newKey() crypto.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic("pkitest: generate key: " + err.Error())
+	}
+	return key
+}
+
+func newSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		panic("pkitest: generate serial: " + err.Error())
+	}
+	return serial
+}
+
+func sign(template *x509.Certificate, pub crypto.PublicKey, issuer *x509.Certificate, issuerKey crypto.Signer) *x509.Certificate {
+	c, err := cert.SignCertificate(template, pub, issuer, issuerKey)
+	if err != nil {
+		panic("pkitest: " + err.Error())
+	}
+	return c
+}
+
+func certPEM(c *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+}
@@ -0,0 +1,139 @@
+package pkitest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestIntermediateChain(t *testing.T) {
+	root := NewCA("Root CA")
+	intermediate := root.Intermediate("Intermediate CA")
+	issuing := intermediate.Intermediate("Issuing CA")
+	leaf := issuing.Server("example.test")
+
+	if len(leaf.Chain) != 2 || leaf.Chain[0] != issuing.Cert || leaf.Chain[1] != intermediate.Cert {
+		t.Fatal("leaf chain is not issuing CA then intermediate, nearest first")
+	}
+	if issuing.Root() != root.Cert {
+		t.Fatal("issuing CA does not chain to the root")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range leaf.Chain {
+		intermediates.AddCert(c)
+	}
+	chains, err := leaf.Cert.Verify(x509.VerifyOptions{
+		DNSName:       "example.test",
+		Roots:         issuing.Pool(),
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(chains[0]); got != 4 {
+		t.Fatalf("verified chain has %d certificates, want 4", got)
+	}
+
+	// Without the intermediates the leaf does not verify
+	if _, err := leaf.Cert.Verify(x509.VerifyOptions{DNSName: "example.test", Roots: root.Pool()}); err == nil {
+		t.Fatal("leaf verified without its intermediates")
+	}
+}
+
+func TestSPIFFEID(t *testing.T) {
+	ca := NewCA("Test CA")
+	leaf := ca.Client("workload", WithSPIFFEID("spiffe://example.org/ns/prod/sa/api"))
+
+	if len(leaf.Cert.URIs) != 1 || leaf.Cert.URIs[0].String() != "spiffe://example.org/ns/prod/sa/api" {
+		t.Fatalf("URI SANs = %v, want the SPIFFE ID only", leaf.Cert.URIs)
+	}
+	if _, err := leaf.Cert.Verify(x509.VerifyOptions{
+		Roots:     ca.Pool(),
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("WithSPIFFEID accepted an invalid ID")
+		}
+	}()
+	ca.Client("invalid", WithSPIFFEID("https://example.org/api"))
+}
+
+func TestInvalidCertificates(t *testing.T) {
+	ca := NewCA("Test CA")
+	verify := func(leaf *Leaf) error {
+		_, err := leaf.Cert.Verify(x509.VerifyOptions{DNSName: "example.test", Roots: ca.Pool()})
+		return err
+	}
+
+	if err := verify(ca.Server("example.test")); err != nil {
+		t.Fatalf("server certificate: %v", err)
+	}
+	for name, leaf := range map[string]*Leaf{
+		"expired":       ca.Expired("example.test"),
+		"not yet valid": ca.NotYetValid("example.test"),
+		"wrong EKU":     ca.WrongEKU("example.test"),
+		"wrong host":    ca.WrongHost(),
+	} {
+		if err := verify(leaf); err == nil {
+			t.Errorf("%s certificate verified", name)
+		}
+	}
+}
+
+func TestServerAndClientConfig(t *testing.T) {
+	serverCA := NewCA("Server CA")
+	clientCA := NewCA("Client CA").Intermediate("Client Issuing CA")
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", ServerConfig(serverCA.Server("127.0.0.1"), clientCA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	peer := make(chan *x509.Certificate, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			peer <- nil
+			return
+		}
+		defer conn.Close()
+		tlsConn := conn.(*tls.Conn)
+		if err := tlsConn.Handshake(); err != nil {
+			peer <- nil
+			return
+		}
+		peer <- tlsConn.ConnectionState().PeerCertificates[0]
+	}()
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", ln.Addr().String(), ClientConfig(serverCA, "127.0.0.1", clientCA.Client("client")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if got := <-peer; got == nil || got.Subject.CommonName != "client" {
+		t.Fatalf("server saw client %v", got)
+	}
+}
+
+func TestPEMRoundTrip(t *testing.T) {
+	ca := NewCA("Root CA").Intermediate("Intermediate CA")
+	leaf := ca.Server("example.test")
+
+	pair, err := tls.X509KeyPair(leaf.CertPEM(), leaf.KeyPEM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pair.Certificate) != 2 {
+		t.Fatalf("PEM holds %d certificates, want leaf and intermediate", len(pair.Certificate))
+	}
+}
@@ -0,0 +1,198 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Provider schemes for keys stored in files
+const (
+	SchemeFile          = "file"
+	SchemeEncryptedFile = "encfile"
+)
+
+// encryptedKeyType is the PEM type of passphrase-encrypted keys
+const encryptedKeyType = "GOTRANSPORT ENCRYPTED PRIVATE KEY"
+
+// scrypt parameters for newly encrypted keys
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// ParsePrivateKeyPEM parses an RSA (PKCS #1), EC (SEC 1) or PKCS #8 private
+// key in PEM form
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse key PEM")
+	}
+
+	var (
+		key interface{}
+		err error
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case encryptedKeyType:
+		return nil, fmt.Errorf("key is encrypted, use the %s: provider", SchemeEncryptedFile)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %s", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse private key: %w", err)
+	}
+
+	s, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("key of type %T cannot sign", key)
+	}
+	return s, nil
+}
+
+// EncryptPEM encrypts a PEM encoded private key with a passphrase. The key is
+// stored as PKCS #8, sealed with AES-256-GCM under a scrypt-derived key.
+func EncryptPEM(keyPEM, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase must not be empty")
+	}
+
+	key, err := ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	aead, err := newKeyCipher(passphrase, salt, scryptN, scryptR, scryptP)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	block := &pem.Block{
+		Type: encryptedKeyType,
+		Headers: map[string]string{
+			"KDF":   "scrypt",
+			"N":     strconv.Itoa(scryptN),
+			"R":     strconv.Itoa(scryptR),
+			"P":     strconv.Itoa(scryptP),
+			"Salt":  base64.StdEncoding.EncodeToString(salt),
+			"Nonce": base64.StdEncoding.EncodeToString(nonce),
+		},
+		Bytes: aead.Seal(nil, nonce, der, []byte(encryptedKeyType)),
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// DecryptPEM reverses EncryptPEM, returning the key
+func DecryptPEM(data, passphrase []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse key PEM")
+	}
+	if block.Type != encryptedKeyType {
+		return nil, fmt.Errorf("PEM block is not an encrypted key (type: %s)", block.Type)
+	}
+	if block.Headers["KDF"] != "scrypt" {
+		return nil, fmt.Errorf("unsupported key derivation %q", block.Headers["KDF"])
+	}
+
+	params := make(map[string]int)
+	for _, name := range []string{"N", "R", "P"} {
+		v, err := strconv.Atoi(block.Headers[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid scrypt parameter %s: %w", name, err)
+		}
+		params[name] = v
+	}
+	salt, err := base64.StdEncoding.DecodeString(block.Headers["Salt"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %w", err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(block.Headers["Nonce"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce: %w", err)
+	}
+
+	aead, err := newKeyCipher(passphrase, salt, params["N"], params["R"], params["P"])
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce length %d", len(nonce))
+	}
+
+	der, err := aead.Open(nil, nonce, block.Bytes, []byte(encryptedKeyType))
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or corrupted key")
+	}
+
+	return ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+// newKeyCipher derives the AES-256-GCM cipher for a passphrase
+func newKeyCipher(passphrase, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	derived, err := scrypt.Key(passphrase, salt, n, r, p, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// openFile is the provider for plain PEM key files
+func openFile(path string, opts Options) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("key read error: %w", err)
+	}
+	return ParsePrivateKeyPEM(data)
+}
+
+// openEncryptedFile is the provider for passphrase-encrypted key files
+func openEncryptedFile(path string, opts Options) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("key read error: %w", err)
+	}
+	if opts.Passphrase == nil {
+		return nil, fmt.Errorf("key %s is encrypted and no passphrase source was given", path)
+	}
+
+	passphrase, err := opts.Passphrase()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return DecryptPEM(data, passphrase)
+}
@@ -0,0 +1,62 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptedFile(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+	encrypted, err := EncryptPEM(keyPEM, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "ca.key.enc")
+	if err := os.WriteFile(path, encrypted, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	passphrase := func(p string) Options {
+		return Options{Passphrase: func() ([]byte, error) { return []byte(p), nil }}
+	}
+
+	s, err := Open(SchemeEncryptedFile+":"+path, passphrase("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.PublicKey.Equal(s.Public()) {
+		t.Fatal("decrypted key differs from the original")
+	}
+	selfSign(t, s, x509.ECDSAWithSHA256)
+
+	if _, err := Open(SchemeEncryptedFile+":"+path, passphrase("wrong")); err == nil {
+		t.Error("opened with the wrong passphrase")
+	}
+	if _, err := Open(SchemeEncryptedFile+":"+path, Options{}); err == nil {
+		t.Error("opened without a passphrase source")
+	}
+	if _, err := Open(path, Options{}); err == nil {
+		t.Error("encrypted key opened as a plain file")
+	}
+
+	failing := Options{Passphrase: func() ([]byte, error) { return nil, errors.New("no terminal") }}
+	if _, err := Open(SchemeEncryptedFile+":"+path, failing); err == nil {
+		t.Error("opened although the passphrase could not be read")
+	}
+}
@@ -0,0 +1,209 @@
+package signer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// SchemeGCPKMS is the provider scheme for Google Cloud KMS keys
+const SchemeGCPKMS = "gcp-kms"
+
+// Environment variables read by the Cloud KMS provider
+const (
+	gcpKMSTokenEnv    = "GOOGLE_OAUTH_ACCESS_TOKEN"
+	gcpKMSEndpointEnv = "GCP_KMS_ENDPOINT"
+)
+
+// gcpKMSEndpoint is the Cloud KMS API unless GCP_KMS_ENDPOINT is set
+const gcpKMSEndpoint = "https://cloudkms.googleapis.com"
+
+// gcpKMSAlgorithm describes how a Cloud KMS key version signs
+type gcpKMSAlgorithm struct {
+	hash      crypto.Hash
+	pss       bool
+	signature x509.SignatureAlgorithm
+}
+
+// gcpKMSAlgorithms are the asymmetric signing algorithms usable for X.509.
+// Cloud KMS fixes the hash and padding per key version, and PSS keys use a
+// salt as long as the hash.
+var gcpKMSAlgorithms = map[string]gcpKMSAlgorithm{
+	"EC_SIGN_P256_SHA256":        {crypto.SHA256, false, x509.ECDSAWithSHA256},
+	"EC_SIGN_P384_SHA384":        {crypto.SHA384, false, x509.ECDSAWithSHA384},
+	"RSA_SIGN_PKCS1_2048_SHA256": {crypto.SHA256, false, x509.SHA256WithRSA},
+	"RSA_SIGN_PKCS1_3072_SHA256": {crypto.SHA256, false, x509.SHA256WithRSA},
+	"RSA_SIGN_PKCS1_4096_SHA256": {crypto.SHA256, false, x509.SHA256WithRSA},
+	"RSA_SIGN_PKCS1_4096_SHA512": {crypto.SHA512, false, x509.SHA512WithRSA},
+	"RSA_SIGN_PSS_2048_SHA256":   {crypto.SHA256, true, x509.SHA256WithRSAPSS},
+	"RSA_SIGN_PSS_3072_SHA256":   {crypto.SHA256, true, x509.SHA256WithRSAPSS},
+	"RSA_SIGN_PSS_4096_SHA256":   {crypto.SHA256, true, x509.SHA256WithRSAPSS},
+	"RSA_SIGN_PSS_4096_SHA512":   {crypto.SHA512, true, x509.SHA512WithRSAPSS},
+}
+
+// gcpKMSSigner signs with a Cloud KMS key version. The private key never
+// leaves KMS; only digests are sent.
+type gcpKMSSigner struct {
+	endpoint  string
+	name      string
+	token     string
+	algorithm gcpKMSAlgorithm
+	public    crypto.PublicKey
+	client    *http.Client
+}
+
+// openGCPKMS opens a reference of the form
+// projects/<p>/locations/<l>/keyRings/<r>/cryptoKeys/<k>/cryptoKeyVersions/<v>.
+// The access token is read from GOOGLE_OAUTH_ACCESS_TOKEN, for example the
+// output of gcloud auth print-access-token.
+func openGCPKMS(location string, opts Options) (crypto.Signer, error) {
+	name := strings.Trim(location, "/")
+	parts := strings.Split(name, "/")
+	if len(parts) != 10 || parts[0] != "projects" || parts[2] != "locations" || parts[4] != "keyRings" ||
+		parts[6] != "cryptoKeys" || parts[8] != "cryptoKeyVersions" {
+		return nil, fmt.Errorf("Cloud KMS reference must be %s:projects/<p>/locations/<l>/keyRings/<r>/cryptoKeys/<k>/cryptoKeyVersions/<v>", SchemeGCPKMS)
+	}
+
+	token := os.Getenv(gcpKMSTokenEnv)
+	if token == "" {
+		return nil, fmt.Errorf("%s is not set", gcpKMSTokenEnv)
+	}
+
+	endpoint := os.Getenv(gcpKMSEndpointEnv)
+	if endpoint == "" {
+		endpoint = gcpKMSEndpoint
+	}
+
+	s := &gcpKMSSigner{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		name:     name,
+		token:    token,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	if err := s.loadPublicKey(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Public implements crypto.Signer
+func (s *gcpKMSSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+// SignatureAlgorithm returns the only algorithm the key version signs with
+func (s *gcpKMSSigner) SignatureAlgorithm() x509.SignatureAlgorithm {
+	return s.algorithm.signature
+}
+
+// Sign implements crypto.Signer by asking Cloud KMS to sign the digest
+func (s *gcpKMSSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != s.algorithm.hash {
+		return nil, fmt.Errorf("Cloud KMS key %s signs %v digests, not %v", s.name, s.algorithm.hash, opts.HashFunc())
+	}
+	pss, isPSS := opts.(*rsa.PSSOptions)
+	if isPSS != s.algorithm.pss {
+		return nil, fmt.Errorf("Cloud KMS key %s signs with %s", s.name, s.algorithm.signature)
+	}
+	if isPSS && pss.SaltLength != rsa.PSSSaltLengthEqualsHash && pss.SaltLength != s.algorithm.hash.Size() {
+		return nil, fmt.Errorf("Cloud KMS only signs with a salt as long as the hash")
+	}
+
+	digestName := map[crypto.Hash]string{
+		crypto.SHA256: "sha256",
+		crypto.SHA384: "sha384",
+		crypto.SHA512: "sha512",
+	}[s.algorithm.hash]
+	request := map[string]interface{}{
+		"digest": map[string]string{digestName: base64.StdEncoding.EncodeToString(digest)},
+	}
+
+	var response struct {
+		Signature string `json:"signature"`
+	}
+	if err := s.call(http.MethodPost, s.name+":asymmetricSign", request, &response); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(response.Signature)
+}
+
+// loadPublicKey fetches the public key and algorithm of the key version
+func (s *gcpKMSSigner) loadPublicKey() error {
+	var response struct {
+		PEM       string `json:"pem"`
+		Algorithm string `json:"algorithm"`
+	}
+	if err := s.call(http.MethodGet, s.name+"/publicKey", nil, &response); err != nil {
+		return err
+	}
+
+	algorithm, ok := gcpKMSAlgorithms[response.Algorithm]
+	if !ok {
+		return fmt.Errorf("Cloud KMS key %s has algorithm %s, it must be an RSA or NIST curve signing key", s.name, response.Algorithm)
+	}
+
+	block, _ := pem.Decode([]byte(response.PEM))
+	if block == nil {
+		return fmt.Errorf("Cloud KMS key %s returned no public key", s.name)
+	}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse Cloud KMS public key: %w", err)
+	}
+
+	s.algorithm = algorithm
+	s.public = public
+	return nil
+}
+
+// call sends a request to the Cloud KMS API and decodes the JSON response
+func (s *gcpKMSSigner) call(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal Cloud KMS request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/v1/%s", s.endpoint, path), reader)
+	if err != nil {
+		return fmt.Errorf("failed to create Cloud KMS request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Cloud KMS request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(msg, &apiErr) == nil && apiErr.Error.Message != "" {
+			return fmt.Errorf("Cloud KMS returned %s: %s", resp.Status, apiErr.Error.Message)
+		}
+		return fmt.Errorf("Cloud KMS returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode Cloud KMS response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const kmsKeyPrefix = "projects/p/locations/global/keyRings/ca/cryptoKeys/"
+
+// fakeKMSKey is a key version held by fakeKMS
+type fakeKMSKey struct {
+	signer    crypto.Signer
+	algorithm string
+}
+
+// fakeKMS stands in for the Cloud KMS asymmetric signing API
+type fakeKMS struct {
+	token string
+	keys  map[string]fakeKMSKey
+}
+
+func (f *fakeKMS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+f.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":{"code":401,"message":"Request had invalid authentication credentials."}}`))
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/publicKey"):
+		key, ok := f.keys[strings.TrimSuffix(path, "/publicKey")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		der, _ := x509.MarshalPKIXPublicKey(key.signer.Public())
+		json.NewEncoder(w).Encode(map[string]string{
+			"pem":       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+			"algorithm": key.algorithm,
+		})
+	case r.Method == http.MethodPost && strings.HasSuffix(path, ":asymmetricSign"):
+		key, ok := f.keys[strings.TrimSuffix(path, ":asymmetricSign")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			Digest map[string]string `json:"digest"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Digest) != 1 {
+			http.Error(w, "invalid digest", http.StatusBadRequest)
+			return
+		}
+
+		// The algorithm of the key version decides hash and padding
+		want := gcpKMSAlgorithms[key.algorithm]
+		name := map[crypto.Hash]string{crypto.SHA256: "sha256", crypto.SHA384: "sha384", crypto.SHA512: "sha512"}[want.hash]
+		digest, err := base64.StdEncoding.DecodeString(req.Digest[name])
+		if err != nil || len(digest) != want.hash.Size() {
+			http.Error(w, "digest does not match the key algorithm", http.StatusBadRequest)
+			return
+		}
+		var opts crypto.SignerOpts = want.hash
+		if want.pss {
+			opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: want.hash}
+		}
+		sig, err := key.signer.Sign(rand.Reader, digest, opts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"signature": base64.StdEncoding.EncodeToString(sig)})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newFakeKMS(t *testing.T) *fakeKMS {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	f := &fakeKMS{
+		token: "test-token",
+		keys: map[string]fakeKMSKey{
+			kmsKeyPrefix + "p256/cryptoKeyVersions/1":  {p256, "EC_SIGN_P256_SHA256"},
+			kmsKeyPrefix + "p384/cryptoKeyVersions/1":  {p384, "EC_SIGN_P384_SHA384"},
+			kmsKeyPrefix + "pkcs1/cryptoKeyVersions/1": {rsaKey, "RSA_SIGN_PKCS1_2048_SHA256"},
+			kmsKeyPrefix + "pss/cryptoKeyVersions/1":   {rsaKey, "RSA_SIGN_PSS_2048_SHA256"},
+			kmsKeyPrefix + "aes/cryptoKeyVersions/1":   {rsaKey, "GOOGLE_SYMMETRIC_ENCRYPTION"},
+		},
+	}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	t.Setenv(gcpKMSEndpointEnv, server.URL)
+	t.Setenv(gcpKMSTokenEnv, f.token)
+	return f
+}
+
+func TestGCPKMSSigner(t *testing.T) {
+	newFakeKMS(t)
+
+	tests := []struct {
+		key  string
+		want x509.SignatureAlgorithm
+	}{
+		{"p256", x509.ECDSAWithSHA256},
+		{"p384", x509.ECDSAWithSHA384},
+		{"pkcs1", x509.SHA256WithRSA},
+		{"pss", x509.SHA256WithRSAPSS},
+	}
+	for _, tt := range tests {
+		s, err := Open(SchemeGCPKMS+":"+kmsKeyPrefix+tt.key+"/cryptoKeyVersions/1", Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		bound, ok := s.(AlgorithmSigner)
+		if !ok || bound.SignatureAlgorithm() != tt.want {
+			t.Fatalf("%s: signer not bound to %s", tt.key, tt.want)
+		}
+		selfSign(t, s, bound.SignatureAlgorithm())
+	}
+}
+
+func TestGCPKMSErrors(t *testing.T) {
+	newFakeKMS(t)
+	ref := SchemeGCPKMS + ":" + kmsKeyPrefix + "pss/cryptoKeyVersions/1"
+
+	s, err := Open(ref, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := make([]byte, 32)
+	if _, err := s.Sign(rand.Reader, digest, crypto.SHA256); err == nil {
+		t.Error("PSS key signed PKCS #1 v1.5")
+	}
+	if _, err := s.Sign(rand.Reader, make([]byte, 48), &rsa.PSSOptions{Hash: crypto.SHA384}); err == nil {
+		t.Error("SHA-256 key signed a SHA-384 digest")
+	}
+
+	for name, location := range map[string]string{
+		"malformed reference": "projects/p/keyRings/ca",
+		"missing key":         kmsKeyPrefix + "missing/cryptoKeyVersions/1",
+		"encryption key":      kmsKeyPrefix + "aes/cryptoKeyVersions/1",
+	} {
+		if _, err := Open(SchemeGCPKMS+":"+location, Options{}); err == nil {
+			t.Errorf("%s opened", name)
+		}
+	}
+
+	t.Setenv(gcpKMSTokenEnv, "expired")
+	if _, err := Open(ref, Options{}); err == nil || !strings.Contains(err.Error(), "invalid authentication credentials") {
+		t.Errorf("wrong token: error = %v, want the API message", err)
+	}
+	t.Setenv(gcpKMSTokenEnv, "")
+	if _, err := Open(ref, Options{}); err == nil {
+		t.Errorf("opened without %s", gcpKMSTokenEnv)
+	}
+}
@@ -0,0 +1,120 @@
+package signer
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// SchemePKCS11 is the provider scheme for keys in a PKCS #11 token
+const SchemePKCS11 = "pkcs11"
+
+// pkcs11URI is the subset of an RFC 7512 PKCS #11 URI that selects a
+// private key and the module holding it
+type pkcs11URI struct {
+	token      string
+	serial     string
+	object     string
+	id         []byte
+	modulePath string
+	pinValue   string
+	pinSource  string
+}
+
+// parsePKCS11URI parses the part of a pkcs11: URI after the scheme, for
+// example token=CA;object=ca-key?module-path=/usr/lib/softhsm/libsofthsm2.so
+func parsePKCS11URI(location string) (*pkcs11URI, error) {
+	path, query, _ := strings.Cut(location, "?")
+
+	uri := &pkcs11URI{}
+	for _, attr := range strings.Split(path, ";") {
+		if attr == "" {
+			continue
+		}
+		name, value, err := pkcs11Attribute(attr)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "token":
+			uri.token = value
+		case "serial":
+			uri.serial = value
+		case "object":
+			uri.object = value
+		case "id":
+			uri.id = []byte(value)
+		case "type":
+			if value != "private" {
+				return nil, fmt.Errorf("PKCS #11 object type must be private, got %s", value)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported PKCS #11 URI attribute %s", name)
+		}
+	}
+
+	for _, attr := range strings.Split(query, "&") {
+		if attr == "" {
+			continue
+		}
+		name, value, err := pkcs11Attribute(attr)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "module-path":
+			uri.modulePath = value
+		case "pin-value":
+			uri.pinValue = value
+		case "pin-source":
+			uri.pinSource = strings.TrimPrefix(value, "file:")
+		default:
+			return nil, fmt.Errorf("unsupported PKCS #11 URI query attribute %s", name)
+		}
+	}
+
+	if uri.modulePath == "" {
+		return nil, fmt.Errorf("PKCS #11 reference must be %s:token=<label>;object=<label>?module-path=<module>", SchemePKCS11)
+	}
+	if uri.object == "" && uri.id == nil {
+		return nil, fmt.Errorf("PKCS #11 reference names no object or id")
+	}
+	return uri, nil
+}
+
+// pkcs11Attribute splits and percent-decodes a name=value URI attribute
+func pkcs11Attribute(attr string) (string, string, error) {
+	name, value, ok := strings.Cut(attr, "=")
+	if !ok {
+		return "", "", fmt.Errorf("invalid PKCS #11 URI attribute %q", attr)
+	}
+	value, err := url.PathUnescape(value)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid PKCS #11 URI attribute %s: %w", name, err)
+	}
+	return name, value, nil
+}
+
+// pin returns the user PIN from the URI, the file it names or, failing
+// both, the passphrase callback
+func (uri *pkcs11URI) pin(opts Options) (string, error) {
+	switch {
+	case uri.pinValue != "":
+		return uri.pinValue, nil
+	case uri.pinSource != "":
+		data, err := os.ReadFile(uri.pinSource)
+		if err != nil {
+			return "", fmt.Errorf("failed to read PIN: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case opts.Passphrase != nil:
+		pin, err := opts.Passphrase()
+		if err != nil {
+			return "", err
+		}
+		return string(pin), nil
+	default:
+		return "", fmt.Errorf("no PIN for PKCS #11 token, set pin-value or pin-source")
+	}
+}
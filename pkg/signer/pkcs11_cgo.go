@@ -0,0 +1,325 @@
+//go:build cgo
+
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+)
+
+// pkcs11Signer signs with a private key that never leaves a PKCS #11 token
+type pkcs11Signer struct {
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	key     pkcs11.ObjectHandle
+	public  crypto.PublicKey
+
+	// mu serialises operations, a session runs one at a time
+	mu sync.Mutex
+}
+
+// pkcs11DigestInfo holds the DER DigestInfo prefixes that CKM_RSA_PKCS
+// expects in front of a digest
+var pkcs11DigestInfo = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// pkcs11PSSHashes maps hashes to the CKM and CKG values of RSA-PSS
+// parameters
+var pkcs11PSSHashes = map[crypto.Hash][2]uint{
+	crypto.SHA256: {pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256},
+	crypto.SHA384: {pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384},
+	crypto.SHA512: {pkcs11.CKM_SHA512, pkcs11.CKG_MGF1_SHA512},
+}
+
+// pkcs11Curves maps the named curve OIDs of CKA_EC_PARAMS to curves
+var pkcs11Curves = map[string]elliptic.Curve{
+	"1.2.840.10045.3.1.7": elliptic.P256(),
+	"1.3.132.0.34":        elliptic.P384(),
+	"1.3.132.0.35":        elliptic.P521(),
+}
+
+// openPKCS11 opens a reference of the form
+// token=<label>;object=<label>?module-path=<module>&pin-value=<pin>, an RFC
+// 7512 URI without its scheme. id may replace or narrow object, and
+// pin-source=<file> may replace pin-value. Without either the PIN is
+// asked for like a passphrase.
+func openPKCS11(location string, opts Options) (crypto.Signer, error) {
+	uri, err := parsePKCS11URI(location)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := pkcs11.New(uri.modulePath)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load PKCS #11 module %s", uri.modulePath)
+	}
+	// Modules are initialised once per process and shared by all signers
+	if err := ctx.Initialize(); err != nil && !isPKCS11Error(err, pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		return nil, fmt.Errorf("failed to initialize PKCS #11 module: %w", err)
+	}
+
+	slot, err := findPKCS11Slot(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PKCS #11 session: %w", err)
+	}
+
+	s := &pkcs11Signer{ctx: ctx, session: session}
+	if err := s.open(uri, opts); err != nil {
+		ctx.CloseSession(session)
+		return nil, err
+	}
+	return s, nil
+}
+
+// findPKCS11Slot returns the slot of the only token matching uri
+func findPKCS11Slot(ctx *pkcs11.Ctx, uri *pkcs11URI) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list PKCS #11 slots: %w", err)
+	}
+
+	var matches []uint
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read PKCS #11 token: %w", err)
+		}
+		if uri.token != "" && strings.TrimRight(info.Label, " \x00") != uri.token {
+			continue
+		}
+		if uri.serial != "" && strings.TrimRight(info.SerialNumber, " \x00") != uri.serial {
+			continue
+		}
+		matches = append(matches, slot)
+	}
+
+	switch len(matches) {
+	case 0:
+		return 0, fmt.Errorf("no PKCS #11 token matches token=%s", uri.token)
+	case 1:
+		return matches[0], nil
+	default:
+		return 0, fmt.Errorf("%d PKCS #11 tokens match, narrow the reference with token or serial", len(matches))
+	}
+}
+
+// open logs in and loads the private key and its public half
+func (s *pkcs11Signer) open(uri *pkcs11URI, opts Options) error {
+	pin, err := uri.pin(opts)
+	if err != nil {
+		return err
+	}
+	// Logins are per token, another signer may have logged in already
+	if err := s.ctx.Login(s.session, pkcs11.CKU_USER, pin); err != nil && !isPKCS11Error(err, pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+		return fmt.Errorf("PKCS #11 login failed: %w", err)
+	}
+
+	s.key, err = s.findObject(pkcs11.CKO_PRIVATE_KEY, uri)
+	if err != nil {
+		return err
+	}
+
+	attrs, err := s.ctx.GetAttributeValue(s.session, s.key, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read PKCS #11 key type: %w", err)
+	}
+
+	switch keyType := pkcs11Uint(attrs[0].Value); keyType {
+	case pkcs11.CKK_RSA:
+		s.public, err = s.rsaPublicKey()
+	case pkcs11.CKK_EC:
+		s.public, err = s.ecdsaPublicKey(uri)
+	default:
+		err = fmt.Errorf("PKCS #11 key type %#x is not RSA or EC", keyType)
+	}
+	return err
+}
+
+// findObject returns the only object of class matching uri
+func (s *pkcs11Signer) findObject(class uint, uri *pkcs11URI) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, class)}
+	if uri.object != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, uri.object))
+	}
+	if uri.id != nil {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, uri.id))
+	}
+
+	if err := s.ctx.FindObjectsInit(s.session, template); err != nil {
+		return 0, fmt.Errorf("failed to search PKCS #11 token: %w", err)
+	}
+	objects, _, err := s.ctx.FindObjects(s.session, 2)
+	if finalErr := s.ctx.FindObjectsFinal(s.session); err == nil {
+		err = finalErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to search PKCS #11 token: %w", err)
+	}
+
+	kind := map[uint]string{pkcs11.CKO_PRIVATE_KEY: "private", pkcs11.CKO_PUBLIC_KEY: "public"}[class]
+	switch len(objects) {
+	case 0:
+		return 0, fmt.Errorf("no PKCS #11 %s key matches object=%s", kind, uri.object)
+	case 1:
+		return objects[0], nil
+	default:
+		return 0, fmt.Errorf("several PKCS #11 %s keys match, narrow the reference with id", kind)
+	}
+}
+
+// rsaPublicKey reads the modulus and exponent of the private key
+func (s *pkcs11Signer) rsaPublicKey() (crypto.PublicKey, error) {
+	attrs, err := s.ctx.GetAttributeValue(s.session, s.key, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PKCS #11 RSA public key: %w", err)
+	}
+
+	exponent := new(big.Int).SetBytes(attrs[1].Value)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("PKCS #11 RSA public exponent is too large")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(attrs[0].Value),
+		E: int(exponent.Int64()),
+	}, nil
+}
+
+// ecdsaPublicKey reads the curve and point of the matching public key
+// object, private EC key objects do not carry the point
+func (s *pkcs11Signer) ecdsaPublicKey(uri *pkcs11URI) (crypto.PublicKey, error) {
+	public, err := s.findObject(pkcs11.CKO_PUBLIC_KEY, uri)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := s.ctx.GetAttributeValue(s.session, public, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PKCS #11 EC public key: %w", err)
+	}
+
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(attrs[0].Value, &oid); err != nil {
+		return nil, fmt.Errorf("PKCS #11 EC key has no named curve: %w", err)
+	}
+	curve, ok := pkcs11Curves[oid.String()]
+	if !ok {
+		return nil, fmt.Errorf("PKCS #11 EC key uses unsupported curve %s", oid)
+	}
+
+	// CKA_EC_POINT is a DER OCTET STRING, some modules return it bare
+	point := attrs[1].Value
+	var wrapped []byte
+	if rest, err := asn1.Unmarshal(point, &wrapped); err == nil && len(rest) == 0 {
+		point = wrapped
+	}
+	x, y := elliptic.Unmarshal(curve, point)
+	if x == nil {
+		return nil, fmt.Errorf("invalid PKCS #11 EC point")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// Public implements crypto.Signer
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign implements crypto.Signer by signing the digest in the token
+func (s *pkcs11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	if hash == 0 || len(digest) != hash.Size() {
+		return nil, fmt.Errorf("PKCS #11 signer needs a %v digest", hash)
+	}
+
+	var mechanism *pkcs11.Mechanism
+	data := digest
+	switch s.public.(type) {
+	case *rsa.PublicKey:
+		if pss, isPSS := opts.(*rsa.PSSOptions); isPSS {
+			params, ok := pkcs11PSSHashes[hash]
+			if !ok {
+				return nil, fmt.Errorf("hash %v is not supported for RSA-PSS", hash)
+			}
+			// X.509 verifiers expect the salt to be as long as the hash
+			salt := pss.SaltLength
+			if salt == rsa.PSSSaltLengthEqualsHash || salt == rsa.PSSSaltLengthAuto {
+				salt = hash.Size()
+			}
+			mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_PSS, pkcs11.NewPSSParams(params[0], params[1], uint(salt)))
+		} else {
+			prefix, ok := pkcs11DigestInfo[hash]
+			if !ok {
+				return nil, fmt.Errorf("hash %v is not supported for RSA", hash)
+			}
+			data = append(append([]byte{}, prefix...), digest...)
+			mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)
+		}
+	case *ecdsa.PublicKey:
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.ctx.SignInit(s.session, []*pkcs11.Mechanism{mechanism}, s.key); err != nil {
+		return nil, fmt.Errorf("PKCS #11 sign failed: %w", err)
+	}
+	signature, err := s.ctx.Sign(s.session, data)
+	if err != nil {
+		return nil, fmt.Errorf("PKCS #11 sign failed: %w", err)
+	}
+
+	if _, isEC := s.public.(*ecdsa.PublicKey); isEC {
+		// CKM_ECDSA returns r and s concatenated, X.509 wants ASN.1
+		half := len(signature) / 2
+		return asn1.Marshal(struct{ R, S *big.Int }{
+			new(big.Int).SetBytes(signature[:half]),
+			new(big.Int).SetBytes(signature[half:]),
+		})
+	}
+	return signature, nil
+}
+
+// isPKCS11Error reports whether err is the PKCS #11 return value code
+func isPKCS11Error(err error, code pkcs11.Error) bool {
+	var p11Err pkcs11.Error
+	return errors.As(err, &p11Err) && p11Err == code
+}
+
+// pkcs11Uint decodes a CK_ULONG attribute value
+func pkcs11Uint(value []byte) uint {
+	switch len(value) {
+	case 8:
+		return uint(binary.NativeEndian.Uint64(value))
+	case 4:
+		return uint(binary.NativeEndian.Uint32(value))
+	default:
+		return ^uint(0)
+	}
+}
@@ -0,0 +1,172 @@
+//go:build cgo
+
+package signer
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/miekg/pkcs11"
+)
+
+const (
+	softHSMToken = "gotransport-test"
+	softHSMPIN   = "1234"
+)
+
+// softHSMModules are where distributions install SoftHSM v2
+var softHSMModules = []string{
+	"/usr/lib/softhsm/libsofthsm2.so",
+	"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/lib/aarch64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/lib64/pkcs11/libsofthsm2.so",
+	"/usr/local/lib/softhsm/libsofthsm2.so",
+	"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+}
+
+// newSoftHSM initialises a SoftHSM token in a temporary directory holding
+// an RSA key labelled "rsa" and a P-256 key labelled "ec", and returns the
+// module path. SOFTHSM2_MODULE overrides the module location; the test is
+// skipped when SoftHSM is not installed.
+func newSoftHSM(t *testing.T) string {
+	t.Helper()
+	module := os.Getenv("SOFTHSM2_MODULE")
+	for _, path := range softHSMModules {
+		if module != "" {
+			break
+		}
+		if _, err := os.Stat(path); err == nil {
+			module = path
+		}
+	}
+	if module == "" {
+		t.Skip("SoftHSM v2 is not installed, set SOFTHSM2_MODULE to its module")
+	}
+
+	dir := t.TempDir()
+	tokens := filepath.Join(dir, "tokens")
+	if err := os.Mkdir(tokens, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	conf := filepath.Join(dir, "softhsm2.conf")
+	if err := os.WriteFile(conf, []byte(fmt.Sprintf("directories.tokendir = %s\nobjectstore.backend = file\n", tokens)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOFTHSM2_CONF", conf)
+
+	ctx := pkcs11.New(module)
+	if ctx == nil {
+		t.Fatalf("failed to load %s", module)
+	}
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(ctx.Initialize())
+	// The signers under test initialise the module again on their own
+	defer ctx.Finalize()
+
+	slots, err := ctx.GetSlotList(false)
+	must(err)
+	must(ctx.InitToken(slots[0], "so-"+softHSMPIN, softHSMToken))
+
+	// SoftHSM moves an initialised token to a new slot
+	slots, err = ctx.GetSlotList(true)
+	must(err)
+	slot := slots[0]
+	for _, s := range slots {
+		if info, err := ctx.GetTokenInfo(s); err == nil && strings.TrimRight(info.Label, " ") == softHSMToken {
+			slot = s
+		}
+	}
+
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	must(err)
+	must(ctx.Login(session, pkcs11.CKU_SO, "so-"+softHSMPIN))
+	must(ctx.InitPIN(session, softHSMPIN))
+	must(ctx.Logout(session))
+	must(ctx.Login(session, pkcs11.CKU_USER, softHSMPIN))
+
+	keyPair := func(label string, id byte, mechanism uint, public ...*pkcs11.Attribute) {
+		t.Helper()
+		common := []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+			pkcs11.NewAttribute(pkcs11.CKA_ID, []byte{id}),
+		}
+		private := append([]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		}, common...)
+		public = append(append(public, pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true)), common...)
+		_, _, err := ctx.GenerateKeyPair(session, []*pkcs11.Mechanism{pkcs11.NewMechanism(mechanism, nil)}, public, private)
+		must(err)
+	}
+	keyPair("rsa", 1, pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN,
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, 2048),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}))
+	p256, _ := asn1.Marshal(asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7})
+	keyPair("ec", 2, pkcs11.CKM_EC_KEY_PAIR_GEN,
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, p256))
+
+	must(ctx.Logout(session))
+	must(ctx.CloseSession(session))
+	return module
+}
+
+func TestPKCS11Signer(t *testing.T) {
+	module := newSoftHSM(t)
+	ref := func(path, query string) string {
+		return SchemePKCS11 + ":token=" + softHSMToken + ";" + path + "?module-path=" + module + query
+	}
+
+	// Before any signer has logged in, a wrong PIN must fail
+	if _, err := Open(ref("object=rsa", "&pin-value=0000"), Options{}); err == nil {
+		t.Fatal("opened with a wrong PIN")
+	}
+
+	tests := []struct {
+		path      string
+		algorithm x509.SignatureAlgorithm
+	}{
+		{"object=rsa", x509.SHA256WithRSA},
+		{"object=rsa", x509.SHA512WithRSA},
+		{"object=rsa", x509.SHA256WithRSAPSS},
+		{"object=rsa", x509.SHA384WithRSAPSS},
+		{"id=%01", x509.SHA256WithRSA},
+		{"object=ec", x509.ECDSAWithSHA256},
+		{"object=ec;id=%02", x509.ECDSAWithSHA384},
+	}
+	for _, tt := range tests {
+		s, err := Open(ref(tt.path, "&pin-value="+softHSMPIN), Options{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		selfSign(t, s, tt.algorithm)
+	}
+
+	// The PIN falls back to the passphrase prompt
+	prompt := Options{Passphrase: func() ([]byte, error) { return []byte(softHSMPIN), nil }}
+	if _, err := Open(ref("object=ec", ""), prompt); err != nil {
+		t.Errorf("PIN from prompt: %v", err)
+	}
+
+	for name, reference := range map[string]string{
+		"missing object": ref("object=missing", "&pin-value="+softHSMPIN),
+		"wrong id":       ref("object=rsa;id=%02", "&pin-value="+softHSMPIN),
+		"missing token":  strings.Replace(ref("object=rsa", "&pin-value="+softHSMPIN), softHSMToken, "missing", 1),
+		"missing module": SchemePKCS11 + ":object=rsa?module-path=" + filepath.Join(t.TempDir(), "missing.so"),
+	} {
+		if _, err := Open(reference, Options{}); err == nil {
+			t.Errorf("%s opened", name)
+		}
+	}
+}
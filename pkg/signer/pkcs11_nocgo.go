@@ -0,0 +1,16 @@
+//go:build !cgo
+
+package signer
+
+import (
+	"crypto"
+	"fmt"
+)
+
+// openPKCS11 reports that PKCS #11 modules cannot be loaded without cgo
+func openPKCS11(location string, opts Options) (crypto.Signer, error) {
+	if _, err := parsePKCS11URI(location); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("PKCS #11 needs a build with cgo enabled")
+}
@@ -0,0 +1,67 @@
+package signer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePKCS11URI(t *testing.T) {
+	uri, err := parsePKCS11URI("token=Root%20CA;object=ca-key;id=%01%02;type=private?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.token != "Root CA" || uri.object != "ca-key" || !bytes.Equal(uri.id, []byte{1, 2}) {
+		t.Errorf("parsed %+v", uri)
+	}
+	if uri.modulePath != "/usr/lib/softhsm/libsofthsm2.so" || uri.pinValue != "1234" {
+		t.Errorf("parsed query %+v", uri)
+	}
+
+	for name, location := range map[string]string{
+		"no module":     "token=CA;object=ca-key",
+		"no object":     "token=CA?module-path=/lib/p11.so",
+		"public object": "token=CA;object=ca-key;type=public?module-path=/lib/p11.so",
+		"unknown":       "token=CA;object=ca-key;slot=1?module-path=/lib/p11.so",
+		"bad attribute": "token?module-path=/lib/p11.so",
+		"bad escape":    "token=CA;object=%zz?module-path=/lib/p11.so",
+		"unknown query": "object=ca-key?module-path=/lib/p11.so&pin=1234",
+	} {
+		if _, err := parsePKCS11URI(location); err == nil {
+			t.Errorf("%s: %q accepted", name, location)
+		}
+	}
+}
+
+func TestPKCS11PIN(t *testing.T) {
+	pinFile := filepath.Join(t.TempDir(), "pin")
+	if err := os.WriteFile(pinFile, []byte("5678\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	prompt := Options{Passphrase: func() ([]byte, error) { return []byte("9012"), nil }}
+
+	fromFile, err := parsePKCS11URI("object=ca-key?module-path=/lib/p11.so&pin-source=file:" + pinFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		uri  *pkcs11URI
+		want string
+	}{
+		{&pkcs11URI{pinValue: "1234", pinSource: pinFile}, "1234"},
+		{fromFile, "5678"},
+		{&pkcs11URI{}, "9012"},
+	}
+	for _, tt := range tests {
+		pin, err := tt.uri.pin(prompt)
+		if err != nil || pin != tt.want {
+			t.Errorf("pin = %q, %v, want %q", pin, err, tt.want)
+		}
+	}
+
+	if _, err := (&pkcs11URI{}).pin(Options{}); err == nil {
+		t.Error("PIN found without a source")
+	}
+}
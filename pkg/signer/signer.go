@@ -0,0 +1,100 @@
+// Package signer opens CA signing keys from pluggable providers. Every
+// provider returns a crypto.Signer, so issuance does not depend on where the
+// key lives.
+//
+// A key reference is either a plain file path or "<scheme>:<location>":
+//
+//	ca.key                                PEM file (same as file:ca.key)
+//	encfile:ca.key.enc                    passphrase-encrypted PEM file
+//	vault-transit://vault:8200/transit/ca HashiCorp Vault Transit key
+//	gcp-kms:projects/p/locations/l/keyRings/r/cryptoKeys/ca/cryptoKeyVersions/1
+//	                                      Google Cloud KMS key version
+//	pkcs11:token=CA;object=ca?module-path=/usr/lib/softhsm/libsofthsm2.so
+//	                                      key in a PKCS #11 token
+//
+// Further providers plug in by calling Register with their own scheme.
+package signer
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Options are passed to providers when opening a key
+type Options struct {
+	// Passphrase is called when a key is encrypted
+	Passphrase func() ([]byte, error)
+}
+
+// AlgorithmSigner is implemented by signers bound to a single signature
+// algorithm, such as cloud KMS keys. Certificates they sign must use it.
+type AlgorithmSigner interface {
+	crypto.Signer
+	SignatureAlgorithm() x509.SignatureAlgorithm
+}
+
+// Opener opens the signer identified by location, the part of the
+// reference after "<scheme>:"
+type Opener func(location string, opts Options) (crypto.Signer, error)
+
+var (
+	mu        sync.RWMutex
+	providers = make(map[string]Opener)
+)
+
+func init() {
+	Register(SchemeFile, openFile)
+	Register(SchemeEncryptedFile, openEncryptedFile)
+	Register(SchemeVaultTransit, openVaultTransit)
+	Register(SchemeGCPKMS, openGCPKMS)
+	Register(SchemePKCS11, openPKCS11)
+}
+
+// Register makes a provider available under scheme. It panics if the
+// scheme is already registered.
+func Register(scheme string, open Opener) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, exists := providers[scheme]; exists {
+		panic(fmt.Sprintf("signer: provider %q registered twice", scheme))
+	}
+	providers[scheme] = open
+}
+
+// Schemes returns the registered provider schemes
+func Schemes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	schemes := make([]string, 0, len(providers))
+	for scheme := range providers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Open returns the signer for a key reference. References without a
+// registered scheme are treated as file paths.
+func Open(ref string, opts Options) (crypto.Signer, error) {
+	scheme, location, found := strings.Cut(ref, ":")
+
+	mu.RLock()
+	open, ok := providers[scheme]
+	mu.RUnlock()
+
+	if !found || !ok {
+		scheme, location, open = SchemeFile, ref, openFile
+	}
+
+	s, err := open(location, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s signer: %w", scheme, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,199 @@
+package signer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchemeVaultTransit is the provider scheme for HashiCorp Vault Transit keys
+const SchemeVaultTransit = "vault-transit"
+
+// vaultTransitSigner signs with a key held by the Vault Transit engine.
+// The private key never leaves Vault; only digests are sent.
+type vaultTransitSigner struct {
+	addr   string
+	mount  string
+	name   string
+	token  string
+	public crypto.PublicKey
+	client *http.Client
+}
+
+// openVaultTransit opens a reference of the form
+// //host:port/<mount>/<key>. The address falls back to VAULT_ADDR when host
+// is empty, and the token is read from VAULT_TOKEN. Add ?insecure-http=true
+// to talk plain HTTP to a local dev server.
+func openVaultTransit(location string, opts Options) (crypto.Signer, error) {
+	u, err := url.Parse(SchemeVaultTransit + ":" + location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Vault reference: %w", err)
+	}
+
+	mount, name, ok := strings.Cut(strings.Trim(u.Path, "/"), "/")
+	if !ok || mount == "" || name == "" {
+		return nil, fmt.Errorf("Vault reference must be %s://host:port/<mount>/<key>", SchemeVaultTransit)
+	}
+
+	addr := os.Getenv("VAULT_ADDR")
+	if u.Host != "" {
+		scheme := "https"
+		if u.Query().Get("insecure-http") == "true" {
+			scheme = "http"
+		}
+		addr = scheme + "://" + u.Host
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("no Vault address in reference and VAULT_ADDR is not set")
+	}
+
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("VAULT_TOKEN is not set")
+	}
+
+	s := &vaultTransitSigner{
+		addr:   strings.TrimSuffix(addr, "/"),
+		mount:  mount,
+		name:   name,
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+	if err := s.loadPublicKey(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Public implements crypto.Signer
+func (s *vaultTransitSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign implements crypto.Signer by asking Vault to sign the digest
+func (s *vaultTransitSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hashName, ok := map[crypto.Hash]string{
+		crypto.SHA256: "sha2-256",
+		crypto.SHA384: "sha2-384",
+		crypto.SHA512: "sha2-512",
+	}[opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("hash %v is not supported by Vault Transit", opts.HashFunc())
+	}
+
+	request := map[string]interface{}{
+		"input":                base64.StdEncoding.EncodeToString(digest),
+		"prehashed":            true,
+		"marshaling_algorithm": "asn1",
+	}
+	if _, isRSA := s.public.(*rsa.PublicKey); isRSA {
+		request["signature_algorithm"] = "pkcs1v15"
+		if pss, isPSS := opts.(*rsa.PSSOptions); isPSS {
+			// Vault defaults to the longest salt, X.509 verifiers expect
+			// the salt to be as long as the hash
+			request["signature_algorithm"] = "pss"
+			request["salt_length"] = vaultSaltLength(pss)
+		}
+	}
+
+	var response struct {
+		Data struct {
+			Signature string `json:"signature"`
+		} `json:"data"`
+	}
+	if err := s.call(http.MethodPost, "sign/"+s.name+"/"+hashName, request, &response); err != nil {
+		return nil, err
+	}
+
+	// Signatures look like vault:v1:<base64>
+	parts := strings.SplitN(response.Data.Signature, ":", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("unexpected Vault signature format")
+	}
+	return base64.StdEncoding.DecodeString(parts[2])
+}
+
+// vaultSaltLength returns the Vault salt_length parameter for opts
+func vaultSaltLength(opts *rsa.PSSOptions) string {
+	switch opts.SaltLength {
+	case rsa.PSSSaltLengthEqualsHash:
+		return "hash"
+	case rsa.PSSSaltLengthAuto:
+		return "auto"
+	}
+	return strconv.Itoa(opts.SaltLength)
+}
+
+// loadPublicKey fetches the public half of the latest key version
+func (s *vaultTransitSigner) loadPublicKey() error {
+	var response struct {
+		Data struct {
+			LatestVersion int `json:"latest_version"`
+			Keys          map[string]struct {
+				PublicKey string `json:"public_key"`
+			} `json:"keys"`
+		} `json:"data"`
+	}
+	if err := s.call(http.MethodGet, "keys/"+s.name, nil, &response); err != nil {
+		return err
+	}
+
+	version := fmt.Sprintf("%d", response.Data.LatestVersion)
+	block, _ := pem.Decode([]byte(response.Data.Keys[version].PublicKey))
+	if block == nil {
+		return fmt.Errorf("Vault key %s has no public key, it must be an RSA or ECDSA key", s.name)
+	}
+
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse Vault public key: %w", err)
+	}
+	s.public = public
+	return nil
+}
+
+// call sends a request to the transit mount and decodes the JSON response
+func (s *vaultTransitSigner) call(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal Vault request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/v1/%s/%s", s.addr, s.mount, path), reader)
+	if err != nil {
+		return fmt.Errorf("failed to create Vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", s.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("Vault returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode Vault response: %w", err)
+	}
+	return nil
+}
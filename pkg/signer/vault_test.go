@@ -0,0 +1,202 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTransit stands in for the Vault Transit engine mounted at transit/
+type fakeTransit struct {
+	token string
+	keys  map[string]crypto.Signer
+
+	mu       sync.Mutex
+	requests []map[string]interface{}
+}
+
+func (f *fakeTransit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Vault-Token") != f.token {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/transit/"), "/")
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "keys":
+		key, ok := f.keys[parts[1]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		der, _ := x509.MarshalPKIXPublicKey(key.Public())
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"latest_version": 1,
+				"keys": map[string]interface{}{
+					"1": map[string]string{"public_key": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))},
+				},
+			},
+		})
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "sign":
+		key, ok := f.keys[parts[1]]
+		hash, known := map[string]crypto.Hash{"sha2-256": crypto.SHA256, "sha2-384": crypto.SHA384, "sha2-512": crypto.SHA512}[parts[2]]
+		if !ok || !known {
+			http.NotFound(w, r)
+			return
+		}
+
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.requests = append(f.requests, req)
+		f.mu.Unlock()
+
+		digest, _ := base64.StdEncoding.DecodeString(req["input"].(string))
+		var opts crypto.SignerOpts = hash
+		if req["signature_algorithm"] == "pss" {
+			// Like Vault, an absent salt_length means the longest salt
+			salt := rsa.PSSSaltLengthAuto
+			switch length, _ := req["salt_length"].(string); length {
+			case "", "auto":
+			case "hash":
+				salt = rsa.PSSSaltLengthEqualsHash
+			default:
+				salt, _ = strconv.Atoi(length)
+			}
+			opts = &rsa.PSSOptions{SaltLength: salt, Hash: hash}
+		}
+		sig, err := key.Sign(rand.Reader, digest, opts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]string{"signature": "vault:v1:" + base64.StdEncoding.EncodeToString(sig)},
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newFakeTransit(t *testing.T) (*fakeTransit, string) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeTransit{
+		token: "test-token",
+		keys:  map[string]crypto.Signer{"rsa": rsaKey, "ec": ecKey},
+	}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	t.Setenv("VAULT_TOKEN", f.token)
+	return f, strings.TrimPrefix(server.URL, "http://")
+}
+
+// selfSign creates a CA certificate signed by s with algorithm and checks
+// its signature
+func selfSign(t *testing.T, s crypto.Signer, algorithm x509.SignatureAlgorithm) {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		SignatureAlgorithm:    algorithm,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, s.Public(), s)
+	if err != nil {
+		t.Fatalf("%s: %v", algorithm, err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CheckSignatureFrom(c); err != nil {
+		t.Fatalf("%s: %v", algorithm, err)
+	}
+}
+
+func TestVaultTransitSigner(t *testing.T) {
+	f, host := newFakeTransit(t)
+
+	tests := []struct {
+		key       string
+		algorithm x509.SignatureAlgorithm
+	}{
+		{"ec", x509.ECDSAWithSHA256},
+		{"ec", x509.ECDSAWithSHA384},
+		{"rsa", x509.SHA256WithRSA},
+		{"rsa", x509.SHA512WithRSA},
+		{"rsa", x509.SHA256WithRSAPSS},
+		{"rsa", x509.SHA384WithRSAPSS},
+	}
+	for _, tt := range tests {
+		s, err := Open(SchemeVaultTransit+"://"+host+"/transit/"+tt.key+"?insecure-http=true", Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		selfSign(t, s, tt.algorithm)
+	}
+
+	// PSS signatures must use a salt as long as the hash
+	for _, req := range f.requests {
+		if req["signature_algorithm"] == "pss" && req["salt_length"] != "hash" {
+			t.Errorf("PSS request with salt_length %v, want hash", req["salt_length"])
+		}
+		if req["prehashed"] != true {
+			t.Errorf("request not marked prehashed: %v", req)
+		}
+	}
+}
+
+func TestVaultTransitErrors(t *testing.T) {
+	_, host := newFakeTransit(t)
+	ref := SchemeVaultTransit + "://" + host + "/transit/rsa?insecure-http=true"
+
+	if _, err := Open(SchemeVaultTransit+"://"+host+"/transit?insecure-http=true", Options{}); err == nil {
+		t.Error("reference without a key name accepted")
+	}
+	if _, err := Open(SchemeVaultTransit+"://"+host+"/transit/missing?insecure-http=true", Options{}); err == nil {
+		t.Error("missing key opened")
+	}
+
+	t.Setenv("VAULT_TOKEN", "wrong")
+	if _, err := Open(ref, Options{}); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("wrong token: error = %v, want 403", err)
+	}
+
+	t.Setenv("VAULT_TOKEN", "")
+	if _, err := Open(ref, Options{}); err == nil {
+		t.Error("opened without VAULT_TOKEN")
+	}
+}
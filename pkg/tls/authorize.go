@@ -0,0 +1,181 @@
+package tls
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Authorization rules reported in AuthorizationError
+const (
+	RuleCommonName         = "commonName"
+	RuleOrganizationalUnit = "organizationalUnit"
+	RuleDNSName            = "dnsName"
+	RuleURI                = "uri"
+	RuleSPKIPin            = "spkiPin"
+	RuleSPIFFEID           = "spiffeID"
+	RuleVerified           = "verified"
+)
+
+// PeerPolicy restricts which verified peers are accepted. Every non-empty
+// list must be satisfied; within a list any entry is enough. The same policy
+// applies to servers checking clients and clients checking servers.
+type PeerPolicy struct {
+	// CommonNames allows peers with one of these subject common names
+	CommonNames []string
+	// OrganizationalUnits allows peers with one of these subject OUs
+	OrganizationalUnits []string
+	// DNSNames allows peers with one of these DNS SANs. Entries may be
+	// wildcards such as *.example.com, matching a single label.
+	DNSNames []string
+	// URIs allows peers with one of these URI SANs
+	URIs []string
+	// SPKIPins pins the SHA-256 of a certificate's SubjectPublicKeyInfo,
+	// base64 or hex encoded. Any certificate of the verified chain may match.
+	SPKIPins []string
+}
+
+// AuthorizationError is returned when a verified peer is rejected by policy
+type AuthorizationError struct {
+	// Rule is the rule that rejected the peer, such as RuleCommonName
+	Rule string
+	// Peer is the subject of the peer certificate
+	Peer string
+	Err  error
+}
+
+func (e *AuthorizationError) Error() string {
+	return fmt.Sprintf("peer %q rejected by %s rule: %v", e.Peer, e.Rule, e.Err)
+}
+
+func (e *AuthorizationError) Unwrap() error {
+	return e.Err
+}
+
+// IsZero reports whether the policy has no rules
+func (p PeerPolicy) IsZero() bool {
+	return len(p.CommonNames) == 0 && len(p.OrganizationalUnits) == 0 &&
+		len(p.DNSNames) == 0 && len(p.URIs) == 0 && len(p.SPKIPins) == 0
+}
+
+// Authorize checks a verified chain, leaf first, against the policy
+func (p PeerPolicy) Authorize(chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return &AuthorizationError{Rule: RuleVerified, Err: fmt.Errorf("peer certificate was not verified")}
+	}
+	leaf := chain[0]
+
+	reject := func(rule, format string, args ...interface{}) error {
+		return &AuthorizationError{Rule: rule, Peer: leaf.Subject.String(), Err: fmt.Errorf(format, args...)}
+	}
+
+	if len(p.CommonNames) > 0 && !containsAny(p.CommonNames, []string{leaf.Subject.CommonName}, equalFold) {
+		return reject(RuleCommonName, "common name %q is not allowed", leaf.Subject.CommonName)
+	}
+	if len(p.OrganizationalUnits) > 0 && !containsAny(p.OrganizationalUnits, leaf.Subject.OrganizationalUnit, equalFold) {
+		return reject(RuleOrganizationalUnit, "organizational units %v are not allowed", leaf.Subject.OrganizationalUnit)
+	}
+	if len(p.DNSNames) > 0 && !containsAny(p.DNSNames, leaf.DNSNames, matchDNSName) {
+		return reject(RuleDNSName, "DNS names %v are not allowed", leaf.DNSNames)
+	}
+	if len(p.URIs) > 0 {
+		uris := make([]string, 0, len(leaf.URIs))
+		for _, u := range leaf.URIs {
+			uris = append(uris, u.String())
+		}
+		if !containsAny(p.URIs, uris, func(a, b string) bool { return a == b }) {
+			return reject(RuleURI, "URIs %v are not allowed", uris)
+		}
+	}
+	if len(p.SPKIPins) > 0 && !p.pinned(chain) {
+		return reject(RuleSPKIPin, "no certificate in the chain matches a pinned public key")
+	}
+
+	return nil
+}
+
+// VerifyPeerCertificate returns a tls.Config.VerifyPeerCertificate callback
+// enforcing the policy on the first verified chain
+func (p PeerPolicy) VerifyPeerCertificate() func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(verifiedChains) == 0 {
+			return p.Authorize(nil)
+		}
+		return p.Authorize(verifiedChains[0])
+	}
+}
+
+// pinned reports whether any certificate in chain matches a pin
+func (p PeerPolicy) pinned(chain []*x509.Certificate) bool {
+	for _, c := range chain {
+		sum := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+		for _, pin := range p.SPKIPins {
+			pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+			if pin == base64.StdEncoding.EncodeToString(sum[:]) || strings.EqualFold(pin, hex.EncodeToString(sum[:])) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SPKIPin returns the base64 SHA-256 pin of a certificate's public key
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// peerVerifier combines the policy and SPIFFE matcher of cfg into a single
+// VerifyPeerCertificate callback, or returns nil if neither is set
+func peerVerifier(cfg Config) func([][]byte, [][]*x509.Certificate) error {
+	var checks []func([][]byte, [][]*x509.Certificate) error
+	if !cfg.Peer.IsZero() {
+		checks = append(checks, cfg.Peer.VerifyPeerCertificate())
+	}
+	if cfg.AuthorizeSPIFFE != nil {
+		checks = append(checks, VerifyPeerSPIFFEID(cfg.AuthorizeSPIFFE))
+	}
+	if len(checks) == 0 {
+		return nil
+	}
+
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		for _, check := range checks {
+			if err := check(rawCerts, verifiedChains); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// containsAny reports whether any value matches any allowed entry
+func containsAny(allowed, values []string, match func(allowed, value string) bool) bool {
+	for _, a := range allowed {
+		for _, v := range values {
+			if match(a, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func equalFold(a, b string) bool {
+	return strings.EqualFold(a, b)
+}
+
+// matchDNSName matches a DNS name against an allowed name or wildcard
+func matchDNSName(allowed, name string) bool {
+	allowed = strings.TrimSuffix(strings.ToLower(allowed), ".")
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+
+	if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+		label, rest, found := strings.Cut(name, ".")
+		return found && label != "" && rest == suffix
+	}
+	return allowed == name
+}
@@ -0,0 +1,158 @@
+package tls
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// caFileExtensions are the files picked up from CA directories
+var caFileExtensions = []string{".pem", ".crt"}
+
+// CAParseError reports a PEM block that could not be used as a CA
+type CAParseError struct {
+	File string
+	// Block is the zero-based index of the PEM block within File
+	Block int
+	Err   error
+}
+
+func (e *CAParseError) Error() string {
+	return fmt.Sprintf("%s: PEM block %d: %v", e.File, e.Block, e.Err)
+}
+
+func (e *CAParseError) Unwrap() error {
+	return e.Err
+}
+
+// caSources returns every CA file or directory configured in cfg
+func (cfg Config) caSources() []string {
+	var sources []string
+	if cfg.CAPath != "" {
+		sources = append(sources, cfg.CAPath)
+	}
+	return append(sources, cfg.CAPaths...)
+}
+
+// hasCA reports whether cfg configures any CA trust
+func (cfg Config) hasCA() bool {
+	return len(cfg.caSources()) > 0 || cfg.UseSystemRoots
+}
+
+// caFiles expands CA sources into files, reading directories one level deep
+func caFiles(sources []string) ([]string, error) {
+	var files []string
+	for _, source := range sources {
+		info, err := os.Stat(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, source)
+			continue
+		}
+
+		entries, err := os.ReadDir(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA directory: %w", err)
+		}
+		var dirFiles []string
+		for _, entry := range entries {
+			ext := strings.ToLower(filepath.Ext(entry.Name()))
+			if entry.IsDir() || !containsString(caFileExtensions, ext) {
+				continue
+			}
+			dirFiles = append(dirFiles, filepath.Join(source, entry.Name()))
+		}
+		if len(dirFiles) == 0 {
+			return nil, fmt.Errorf("no %s files in CA directory %s", strings.Join(caFileExtensions, "/"), source)
+		}
+		sort.Strings(dirFiles)
+		files = append(files, dirFiles...)
+	}
+	return files, nil
+}
+
+// loadCACerts builds a certificate pool from CA files and directories,
+// optionally starting from the system pool. Every PEM block must be a
+// parseable certificate; failures are reported by file and block index.
+func loadCACerts(sources []string, system bool) (*x509.CertPool, error) {
+	caPool := x509.NewCertPool()
+	if system {
+		systemPool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load system CA certificates: %w", err)
+		}
+		caPool = systemPool
+	}
+
+	files, err := caFiles(sources)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		errs = append(errs, addCACerts(caPool, file, data)...)
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("failed to add CA certificates to pool: %w", errors.Join(errs...))
+	}
+
+	return caPool, nil
+}
+
+// addCACerts adds every certificate in the PEM data of file to caPool and
+// returns the problems found in that file
+func addCACerts(caPool *x509.CertPool, file string, data []byte) []error {
+	var errs []error
+	added := 0
+	rest := data
+	for block := 0; ; block++ {
+		var p *pem.Block
+		p, rest = pem.Decode(rest)
+		if p == nil {
+			if len(bytes.TrimSpace(rest)) > 0 {
+				errs = append(errs, &CAParseError{File: file, Block: block, Err: fmt.Errorf("invalid PEM data")})
+			}
+			break
+		}
+		if p.Type != "CERTIFICATE" {
+			errs = append(errs, &CAParseError{File: file, Block: block, Err: fmt.Errorf("unexpected PEM type %s", p.Type)})
+			continue
+		}
+
+		c, err := x509.ParseCertificate(p.Bytes)
+		if err != nil {
+			errs = append(errs, &CAParseError{File: file, Block: block, Err: err})
+			continue
+		}
+		caPool.AddCert(c)
+		added++
+	}
+
+	if added == 0 && len(errs) == 0 {
+		errs = append(errs, &CAParseError{File: file, Block: 0, Err: fmt.Errorf("no certificates found")})
+	}
+	return errs
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package tls
+
+import (
+	"crypto/x509"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/bxtal-lsn/gotransport/pkg/pkitest"
+)
+
+func TestLoadCACertsReportsEveryFile(t *testing.T) {
+	ca := pkitest.NewCA("Test CA")
+	leaf := ca.Server("localhost")
+	dir := t.TempDir()
+
+	// The key file fails first, the empty file must still be reported
+	writeFile(t, dir, "a-key.pem", leaf.KeyPEM())
+	writeFile(t, dir, "b-empty.pem", nil)
+	writeFile(t, dir, "c-ca.pem", ca.CertPEM())
+
+	_, err := loadCACerts([]string{dir}, false)
+	if err == nil {
+		t.Fatal("loadCACerts() accepted a directory with bad files")
+	}
+
+	var failed []string
+	joined, ok := errors.Unwrap(err).(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("loadCACerts() error = %v, want joined file errors", err)
+	}
+	for _, e := range joined.Unwrap() {
+		var parseErr *CAParseError
+		if errors.As(e, &parseErr) {
+			failed = append(failed, parseErr.File)
+		}
+	}
+	if len(failed) != 2 || filepath.Base(failed[0]) != "a-key.pem" || filepath.Base(failed[1]) != "b-empty.pem" {
+		t.Fatalf("errors reported for %v, want a-key.pem and b-empty.pem", failed)
+	}
+}
+
+func TestLoadCACertsBundle(t *testing.T) {
+	root := pkitest.NewCA("Root CA")
+	intermediate := root.Intermediate("Intermediate CA")
+	dir := t.TempDir()
+
+	bundle := append(root.CertPEM(), intermediate.CertPEM()...)
+	pool, err := loadCACerts([]string{writeFile(t, dir, "bundle.pem", bundle)}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := x509.NewCertPool()
+	want.AddCert(root.Cert)
+	want.AddCert(intermediate.Cert)
+	if !pool.Equal(want) {
+		t.Fatal("pool does not hold both bundle certificates")
+	}
+}
@@ -2,9 +2,7 @@ package tls
 
 import (
 	"crypto/tls"
-	"crypto/x509"
 	"fmt"
-	"os"
 )
 
 // Config holds TLS configuration options
@@ -15,31 +13,55 @@ type Config struct {
 	ServerName string
 	ClientAuth tls.ClientAuthType
 	MinVersion uint16
+	// CAPaths adds further CA files, bundles or directories of .pem/.crt
+	// files, trusted alongside CAPath
+	CAPaths []string
+	// UseSystemRoots starts the CA pool from the system trust store
+	UseSystemRoots bool
+	// Certificates and CertDir add further server certificates, selected
+	// per connection by SNI. CertDir holds <name>.crt/<name>.key pairs.
+	Certificates []KeyPair
+	CertDir      string
+	// Profile names the security profile providing protocol versions,
+	// cipher suites and curves. Empty selects ProfileIntermediate.
+	Profile string
+	// Peer restricts which verified peers are accepted
+	Peer PeerPolicy
+	// AuthorizeSPIFFE, if set, only admits peers whose verified
+	// certificate carries a SPIFFE ID accepted by the matcher
+	AuthorizeSPIFFE SPIFFEMatcher
 }
 
 // DefaultConfig returns a default secure TLS configuration
 func DefaultConfig() Config {
 	return Config{
 		ClientAuth: tls.NoClientCert,
-		MinVersion: tls.VersionTLS12,
+		Profile:    ProfileIntermediate,
 	}
 }
 
 // NewServerTLSConfig creates a server TLS configuration
 func NewServerTLSConfig(cfg Config) (*tls.Config, error) {
-	// Set default min version if not specified
-	if cfg.MinVersion == 0 {
-		cfg.MinVersion = tls.VersionTLS12
+	// Resolve the security profile
+	profile, err := resolveProfile(cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create base TLS config
 	tlsConfig := &tls.Config{
-		MinVersion: cfg.MinVersion,
 		ClientAuth: cfg.ClientAuth,
 	}
+	profile.apply(tlsConfig)
 
 	// Load server certificate and key if provided
-	if cfg.CertPath != "" && cfg.KeyPath != "" {
+	if cfg.hasCertificateSet() {
+		set, err := LoadCertificateSet(cfg.keyPairs(), cfg.CertDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load server certificates: %w", err)
+		}
+		tlsConfig.GetCertificate = set.GetCertificate
+	} else if cfg.CertPath != "" && cfg.KeyPath != "" {
 		cert, err := tls.LoadX509KeyPair(cfg.CertPath, cfg.KeyPath)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load server certificate: %w", err)
@@ -48,29 +70,44 @@ func NewServerTLSConfig(cfg Config) (*tls.Config, error) {
 	}
 
 	// Load CA certificate if provided
-	if cfg.CAPath != "" && cfg.ClientAuth != tls.NoClientCert {
-		caPool, err := loadCACert(cfg.CAPath)
+	if cfg.hasCA() && cfg.ClientAuth != tls.NoClientCert {
+		caPool, err := loadCACerts(cfg.caSources(), cfg.UseSystemRoots)
 		if err != nil {
 			return nil, err
 		}
 		tlsConfig.ClientCAs = caPool
 	}
 
+	// Authorize clients by identity. Policies judge the verified chain, so
+	// they need a mode in which crypto/tls verifies client certificates.
+	if (!cfg.Peer.IsZero() || cfg.AuthorizeSPIFFE != nil) && !verifiesClientCert(cfg.ClientAuth) {
+		return nil, fmt.Errorf("peer authorization requires client auth %s or %s, not %s",
+			tls.VerifyClientCertIfGiven, tls.RequireAndVerifyClientCert, cfg.ClientAuth)
+	}
+	tlsConfig.VerifyPeerCertificate = peerVerifier(cfg)
+
 	return tlsConfig, nil
 }
 
+// verifiesClientCert reports whether crypto/tls verifies client
+// certificates against ClientCAs in mode
+func verifiesClientCert(mode tls.ClientAuthType) bool {
+	return mode == tls.VerifyClientCertIfGiven || mode == tls.RequireAndVerifyClientCert
+}
+
 // NewClientTLSConfig creates a client TLS configuration
 func NewClientTLSConfig(cfg Config) (*tls.Config, error) {
-	// Set default min version if not specified
-	if cfg.MinVersion == 0 {
-		cfg.MinVersion = tls.VersionTLS12
+	// Resolve the security profile
+	profile, err := resolveProfile(cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create base TLS config
 	tlsConfig := &tls.Config{
-		MinVersion:         cfg.MinVersion,
 		InsecureSkipVerify: false, // Always verify server certs by default
 	}
+	profile.apply(tlsConfig)
 
 	// Set server name if provided
 	if cfg.ServerName != "" {
@@ -87,28 +124,16 @@ func NewClientTLSConfig(cfg Config) (*tls.Config, error) {
 	}
 
 	// Load CA certificate if provided
-	if cfg.CAPath != "" {
-		caPool, err := loadCACert(cfg.CAPath)
+	if cfg.hasCA() {
+		caPool, err := loadCACerts(cfg.caSources(), cfg.UseSystemRoots)
 		if err != nil {
 			return nil, err
 		}
 		tlsConfig.RootCAs = caPool
 	}
 
-	return tlsConfig, nil
-}
-
-// loadCACert loads a CA certificate from a file into a certificate pool
-func loadCACert(caPath string) (*x509.CertPool, error) {
-	caCert, err := os.ReadFile(caPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
-	}
-
-	caPool := x509.NewCertPool()
-	if !caPool.AppendCertsFromPEM(caCert) {
-		return nil, fmt.Errorf("failed to add CA certificate to pool")
-	}
+	// Authorize the server by identity
+	tlsConfig.VerifyPeerCertificate = peerVerifier(cfg)
 
-	return caPool, nil
+	return tlsConfig, nil
 }
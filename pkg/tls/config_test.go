@@ -0,0 +1,85 @@
+package tls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"testing"
+
+	"github.com/bxtal-lsn/gotransport/pkg/pkitest"
+)
+
+func TestNewServerTLSConfigPolicyNeedsVerifiedClients(t *testing.T) {
+	policies := map[string]Config{
+		"peer policy":   {Peer: PeerPolicy{CommonNames: []string{"client"}}},
+		"SPIFFE policy": {AuthorizeSPIFFE: MatchTrustDomain("example.org")},
+	}
+	modes := []struct {
+		mode    tls.ClientAuthType
+		wantErr bool
+	}{
+		{tls.NoClientCert, true},
+		{tls.RequestClientCert, true},
+		{tls.RequireAnyClientCert, true},
+		{tls.VerifyClientCertIfGiven, false},
+		{tls.RequireAndVerifyClientCert, false},
+	}
+
+	for name, cfg := range policies {
+		for _, m := range modes {
+			cfg.ClientAuth = m.mode
+			_, err := NewServerTLSConfig(cfg)
+			if (err != nil) != m.wantErr {
+				t.Errorf("%s with %s: error = %v, want error %v", name, m.mode, err, m.wantErr)
+			}
+		}
+	}
+}
+
+func TestServerPeerPolicyRejectsUnauthorizedClient(t *testing.T) {
+	ca := pkitest.NewCA("Test CA")
+	dir := t.TempDir()
+	server := ca.Server("localhost")
+
+	for _, mode := range []tls.ClientAuthType{tls.VerifyClientCertIfGiven, tls.RequireAndVerifyClientCert} {
+		serverConfig, err := NewServerTLSConfig(Config{
+			CAPath:     writeFile(t, dir, "ca.crt", ca.CertPEM()),
+			CertPath:   writeFile(t, dir, "server.crt", server.CertPEM()),
+			KeyPath:    writeFile(t, dir, "server.key", server.KeyPEM()),
+			ClientAuth: mode,
+			Peer:       PeerPolicy{CommonNames: []string{"allowed"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := serveTLS(t, serverConfig)
+
+		tests := []struct {
+			name    string
+			client  *pkitest.Leaf
+			wantErr bool
+		}{
+			{"authorized", ca.Client("allowed"), false},
+			{"unauthorized", ca.Client("intruder"), true},
+			{"anonymous", nil, true},
+			{"other CA", pkitest.NewCA("Other CA").Client("allowed"), true},
+		}
+		for _, tt := range tests {
+			err := dialTLS(addr, pkitest.ClientConfig(ca, "localhost", tt.client))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("%s client with %s: error = %v, want error %v", tt.name, mode, err, tt.wantErr)
+			}
+		}
+	}
+}
+
+func TestPeerPolicyAuthorizationError(t *testing.T) {
+	ca := pkitest.NewCA("Test CA")
+	client := ca.Client("intruder")
+
+	err := PeerPolicy{CommonNames: []string{"allowed"}}.Authorize([]*x509.Certificate{client.Cert, ca.Cert})
+	var authErr *AuthorizationError
+	if !errors.As(err, &authErr) || authErr.Rule != RuleCommonName {
+		t.Fatalf("Authorize() error = %v, want %s rejection", err, RuleCommonName)
+	}
+}
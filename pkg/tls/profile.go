@@ -0,0 +1,163 @@
+package tls
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// Names of the built-in security profiles
+const (
+	ProfileModern       = "modern"
+	ProfileIntermediate = "intermediate"
+	ProfileFIPS         = "fips"
+)
+
+// Profile is a named set of protocol, cipher and curve settings
+type Profile struct {
+	Name        string
+	Description string
+	MinVersion  uint16
+	MaxVersion  uint16
+	// CipherSuites applies to TLS 1.0-1.2 only. Go does not allow the TLS 1.3
+	// suites to be configured, they are listed in TLS13CipherSuites.
+	CipherSuites           []uint16
+	CurvePreferences       []tls.CurveID
+	SessionTicketsDisabled bool
+	Renegotiation          tls.RenegotiationSupport
+}
+
+// TLS13CipherSuites are the suites Go negotiates for TLS 1.3
+var TLS13CipherSuites = []uint16{
+	tls.TLS_AES_128_GCM_SHA256,
+	tls.TLS_AES_256_GCM_SHA384,
+	tls.TLS_CHACHA20_POLY1305_SHA256,
+}
+
+var profiles = []Profile{
+	{
+		Name:        ProfileModern,
+		Description: "TLS 1.3 only, for clients that all support it",
+		MinVersion:  tls.VersionTLS13,
+		MaxVersion:  tls.VersionTLS13,
+		CurvePreferences: []tls.CurveID{
+			tls.X25519,
+			tls.CurveP256,
+			tls.CurveP384,
+		},
+		Renegotiation: tls.RenegotiateNever,
+	},
+	{
+		Name:        ProfileIntermediate,
+		Description: "TLS 1.2 and 1.3 following the Mozilla intermediate guidelines (default)",
+		MinVersion:  tls.VersionTLS12,
+		MaxVersion:  tls.VersionTLS13,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+		CurvePreferences: []tls.CurveID{
+			tls.X25519,
+			tls.CurveP256,
+			tls.CurveP384,
+		},
+		Renegotiation: tls.RenegotiateNever,
+	},
+	{
+		// Go negotiates ChaCha20 for TLS 1.3 unless the binary runs in its
+		// FIPS 140 mode, and the TLS 1.3 suites can't be configured, so the
+		// profile stops at TLS 1.2 where the suites below are enforced
+		Name:        ProfileFIPS,
+		Description: "TLS 1.2 with FIPS 140 approved AES-GCM suites and NIST curves, no session tickets",
+		MinVersion:  tls.VersionTLS12,
+		MaxVersion:  tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		},
+		CurvePreferences: []tls.CurveID{
+			tls.CurveP256,
+			tls.CurveP384,
+			tls.CurveP521,
+		},
+		SessionTicketsDisabled: true,
+		Renegotiation:          tls.RenegotiateNever,
+	},
+}
+
+// Profiles returns the built-in security profiles
+func Profiles() []Profile {
+	result := make([]Profile, len(profiles))
+	copy(result, profiles)
+	return result
+}
+
+// LookupProfile returns the profile with the given name
+func LookupProfile(name string) (Profile, error) {
+	for _, p := range profiles {
+		if p.Name == strings.ToLower(name) {
+			return p, nil
+		}
+	}
+	names := make([]string, 0, len(profiles))
+	for _, p := range profiles {
+		names = append(names, p.Name)
+	}
+	return Profile{}, fmt.Errorf("unknown TLS profile %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+// TLS13Suites returns the TLS 1.3 suites a connection using the profile
+// may negotiate, none if the profile stops before TLS 1.3
+func (p Profile) TLS13Suites() []uint16 {
+	if p.MaxVersion < tls.VersionTLS13 {
+		return nil
+	}
+	return TLS13CipherSuites
+}
+
+// TLS12Suites returns the TLS 1.0-1.2 suites a connection using the
+// profile may negotiate, none if the profile starts at TLS 1.3
+func (p Profile) TLS12Suites() []uint16 {
+	if p.MinVersion >= tls.VersionTLS13 {
+		return nil
+	}
+	return p.CipherSuites
+}
+
+// apply copies the profile settings into a crypto/tls configuration
+func (p Profile) apply(tlsConfig *tls.Config) {
+	tlsConfig.MinVersion = p.MinVersion
+	tlsConfig.MaxVersion = p.MaxVersion
+	tlsConfig.CipherSuites = append([]uint16(nil), p.CipherSuites...)
+	tlsConfig.CurvePreferences = append([]tls.CurveID(nil), p.CurvePreferences...)
+	tlsConfig.SessionTicketsDisabled = p.SessionTicketsDisabled
+	tlsConfig.Renegotiation = p.Renegotiation
+}
+
+// resolveProfile returns the profile selected by cfg, with an explicit
+// MinVersion raising the profile minimum
+func resolveProfile(cfg Config) (Profile, error) {
+	name := cfg.Profile
+	if name == "" {
+		name = ProfileIntermediate
+	}
+
+	p, err := LookupProfile(name)
+	if err != nil {
+		return Profile{}, err
+	}
+	if cfg.MinVersion > p.MinVersion {
+		p.MinVersion = cfg.MinVersion
+	}
+	if p.MinVersion > p.MaxVersion {
+		return Profile{}, fmt.Errorf("minimum version %s is above the %s profile maximum %s",
+			tls.VersionName(p.MinVersion), p.Name, tls.VersionName(p.MaxVersion))
+	}
+	return p, nil
+}
@@ -0,0 +1,92 @@
+package tls
+
+import (
+	"crypto/tls"
+	"slices"
+	"testing"
+
+	"github.com/bxtal-lsn/gotransport/pkg/pkitest"
+)
+
+// handshake connects a default client to a server using profile and
+// returns the negotiated connection state
+func handshake(t *testing.T, profile string, client *tls.Config) (tls.ConnectionState, error) {
+	t.Helper()
+	ca := pkitest.NewCA("Test CA")
+	server := ca.Server("localhost")
+	dir := t.TempDir()
+
+	serverConfig, err := NewServerTLSConfig(Config{
+		CertPath: writeFile(t, dir, "server.crt", server.CertPEM()),
+		KeyPath:  writeFile(t, dir, "server.key", server.KeyPEM()),
+		Profile:  profile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveTLS(t, serverConfig)
+
+	if client == nil {
+		client = &tls.Config{}
+	}
+	client.RootCAs = ca.Pool()
+	client.ServerName = "localhost"
+
+	conn, err := tls.Dial("tcp", addr, client)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+	return conn.ConnectionState(), nil
+}
+
+func TestProfilesNegotiateListedSuites(t *testing.T) {
+	for _, p := range Profiles() {
+		t.Run(p.Name, func(t *testing.T) {
+			state, err := handshake(t, p.Name, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state.Version < p.MinVersion || state.Version > p.MaxVersion {
+				t.Errorf("negotiated %s outside %s - %s", tls.VersionName(state.Version),
+					tls.VersionName(p.MinVersion), tls.VersionName(p.MaxVersion))
+			}
+
+			suites := p.TLS12Suites()
+			if state.Version == tls.VersionTLS13 {
+				suites = p.TLS13Suites()
+			}
+			if !slices.Contains(suites, state.CipherSuite) {
+				t.Errorf("negotiated %s, not listed by the profile", tls.CipherSuiteName(state.CipherSuite))
+			}
+		})
+	}
+}
+
+func TestFIPSProfileRefusesChaCha20(t *testing.T) {
+	p, err := LookupProfile(ProfileFIPS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.TLS13Suites()) != 0 {
+		t.Fatalf("fips profile lists TLS 1.3 suites %v", p.TLS13Suites())
+	}
+
+	// A client supporting TLS 1.3 still ends up on TLS 1.2
+	state, err := handshake(t, ProfileFIPS, &tls.Config{MaxVersion: tls.VersionTLS13})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Version != tls.VersionTLS12 {
+		t.Fatalf("negotiated %s, want TLS 1.2", tls.VersionName(state.Version))
+	}
+
+	// And a client offering only ChaCha20 is refused
+	_, err = handshake(t, ProfileFIPS, &tls.Config{
+		MaxVersion:   tls.VersionTLS12,
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256},
+	})
+	if err == nil {
+		t.Fatal("ChaCha20 negotiated under the fips profile")
+	}
+}
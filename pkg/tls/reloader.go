@@ -0,0 +1,424 @@
+package tls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultReloadInterval is how often a Reloader polls its files by default
+const DefaultReloadInterval = 10 * time.Second
+
+// ReloadEvent describes the outcome of a reload attempt
+type ReloadEvent struct {
+	Time time.Time
+	// Leaf is the certificate now being served, nil if none is configured
+	Leaf *x509.Certificate
+	// Err is set when the new files were rejected. The previous
+	// certificate and CA pool stay in use.
+	Err error
+}
+
+// Reloader keeps a certificate, key and CA pool in sync with files on disk,
+// so long-running processes pick up rotated certificates without a restart.
+// The SNI certificates of Config.Certificates and Config.CertDir are
+// reloaded as a set. New files are validated before they replace the ones
+// in use.
+type Reloader struct {
+	cfg      Config
+	interval time.Duration
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	certs     *CertificateSet
+	caPool    *x509.CertPool
+	serverCfg *tls.Config
+	base      *tls.Config
+	stamps    map[string]fileStamp
+	lastErr   error
+
+	events chan ReloadEvent
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// fileStamp identifies a version of a file on disk
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader loads the files referenced by cfg and returns a Reloader for
+// them. A zero interval uses DefaultReloadInterval.
+func NewReloader(cfg Config, interval time.Duration) (*Reloader, error) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+
+	r := &Reloader{
+		cfg:      cfg,
+		interval: interval,
+		stamps:   make(map[string]fileStamp),
+		events:   make(chan ReloadEvent, 16),
+		stop:     make(chan struct{}),
+	}
+
+	// The initial load must succeed, there is nothing to fall back to
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	r.stamps = r.currentStamps()
+
+	return r, nil
+}
+
+// Start polls the files in the background until Stop is called
+func (r *Reloader) Start() {
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.reloadIfChanged()
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends background polling and closes the events channel
+func (r *Reloader) Stop() {
+	r.once.Do(func() {
+		close(r.stop)
+		r.mu.Lock()
+		close(r.events)
+		r.events = nil
+		r.mu.Unlock()
+	})
+}
+
+// Events returns a channel receiving every reload attempt. Events are
+// dropped if the channel is not drained.
+func (r *Reloader) Events() <-chan ReloadEvent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.events
+}
+
+// LastError returns the error of the most recent reload, or nil if it succeeded
+func (r *Reloader) LastError() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lastErr
+}
+
+// Reload reads the files immediately, regardless of whether they changed
+func (r *Reloader) Reload() error {
+	stamps := r.currentStamps()
+	err := r.load()
+
+	r.mu.Lock()
+	r.stamps = stamps
+	r.mu.Unlock()
+
+	return err
+}
+
+// Certificate returns the certificate currently in use, the default one of
+// a certificate set
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// CAPool returns the CA pool currently in use
+func (r *Reloader) CAPool() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.caPool
+}
+
+// GetCertificate implements tls.Config.GetCertificate, choosing from the
+// certificate set by SNI when one is configured
+func (r *Reloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	certs := r.certs
+	r.mu.RUnlock()
+	if certs != nil {
+		return certs.GetCertificate(hello)
+	}
+
+	if cert := r.Certificate(); cert != nil {
+		return cert, nil
+	}
+	return nil, fmt.Errorf("no server certificate configured")
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate
+func (r *Reloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if cert := r.Certificate(); cert != nil {
+		return cert, nil
+	}
+	// An empty certificate tells the server we have none
+	return &tls.Certificate{}, nil
+}
+
+// GetConfigForClient implements tls.Config.GetConfigForClient, returning the
+// server configuration with the current CA pool for client verification
+func (r *Reloader) GetConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.base == nil {
+		return nil, nil
+	}
+	if r.serverCfg == nil {
+		cfg := r.base.Clone()
+		cfg.GetConfigForClient = nil
+		if r.cfg.ClientAuth != tls.NoClientCert {
+			cfg.ClientCAs = r.caPool
+		}
+		r.serverCfg = cfg
+	}
+	return r.serverCfg, nil
+}
+
+// ServerTLSConfig returns a server configuration that serves the reloaded
+// certificate and verifies clients against the reloaded CA pool
+func (r *Reloader) ServerTLSConfig() (*tls.Config, error) {
+	tlsConfig, err := NewServerTLSConfig(withoutFiles(r.cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	r.ConfigureServer(tlsConfig)
+	return tlsConfig, nil
+}
+
+// ClientTLSConfig returns a client configuration that presents the reloaded
+// certificate and verifies servers against the reloaded CA pool
+func (r *Reloader) ClientTLSConfig() (*tls.Config, error) {
+	tlsConfig, err := NewClientTLSConfig(withoutFiles(r.cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	r.ConfigureClient(tlsConfig)
+	return tlsConfig, nil
+}
+
+// ConfigureServer makes an existing server configuration take its
+// certificate and client CA pool from the reloader
+func (r *Reloader) ConfigureServer(tlsConfig *tls.Config) {
+	tlsConfig.Certificates = nil
+	tlsConfig.GetCertificate = r.GetCertificate
+	if r.cfg.ClientAuth != tls.NoClientCert {
+		tlsConfig.ClientCAs = r.CAPool()
+	}
+
+	r.mu.Lock()
+	r.base = tlsConfig.Clone()
+	r.serverCfg = nil
+	r.mu.Unlock()
+
+	tlsConfig.GetConfigForClient = r.GetConfigForClient
+}
+
+// ConfigureClient makes an existing client configuration take its
+// certificate and root CA pool from the reloader
+func (r *Reloader) ConfigureClient(tlsConfig *tls.Config) {
+	tlsConfig.Certificates = nil
+	tlsConfig.GetClientCertificate = r.GetClientCertificate
+
+	// RootCAs is read once per config, so when the CA is reloadable the
+	// standard verification is replaced by one against the current pool.
+	// Peer callbacks need the verified chains, so they run afterwards.
+	//
+	// The host is checked against the configured ServerName. Without one
+	// the name sent in SNI is used, which is empty when dialing an IP
+	// address, so such connections fail rather than skip the host check.
+	if r.cfg.hasCA() {
+		serverName := tlsConfig.ServerName
+		verifyPeer := tlsConfig.VerifyPeerCertificate
+		tlsConfig.VerifyPeerCertificate = nil
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			name := serverName
+			if name == "" {
+				name = cs.ServerName
+			}
+			chains, err := verifyServerChain(cs, name, r.CAPool())
+			if err != nil {
+				return err
+			}
+			if verifyPeer == nil {
+				return nil
+			}
+			rawCerts := make([][]byte, 0, len(cs.PeerCertificates))
+			for _, c := range cs.PeerCertificates {
+				rawCerts = append(rawCerts, c.Raw)
+			}
+			return verifyPeer(rawCerts, chains)
+		}
+	}
+}
+
+// withoutFiles clears the certificate and CA sources of cfg, which the
+// reloader provides instead
+func withoutFiles(cfg Config) Config {
+	cfg.CertPath, cfg.KeyPath, cfg.CAPath = "", "", ""
+	cfg.CAPaths, cfg.UseSystemRoots = nil, false
+	cfg.Certificates, cfg.CertDir = nil, ""
+	return cfg
+}
+
+// verifyServerChain performs the verification crypto/tls would have done
+// for a client with RootCAs set to roots and ServerName set to serverName
+func verifyServerChain(cs tls.ConnectionState, serverName string, roots *x509.CertPool) ([][]*x509.Certificate, error) {
+	if len(cs.PeerCertificates) == 0 {
+		return nil, fmt.Errorf("server presented no certificate")
+	}
+	if serverName == "" {
+		return nil, fmt.Errorf("no server name to verify the certificate against, set ServerName when connecting by IP address")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+
+	return cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+}
+
+// reloadIfChanged reloads when any watched file changed since the last attempt
+func (r *Reloader) reloadIfChanged() {
+	stamps := r.currentStamps()
+
+	r.mu.RLock()
+	changed := len(stamps) != len(r.stamps)
+	for path, stamp := range stamps {
+		if r.stamps[path] != stamp {
+			changed = true
+		}
+	}
+	r.mu.RUnlock()
+
+	if changed {
+		r.Reload()
+	}
+}
+
+// currentStamps returns the stamps of the watched files that exist
+func (r *Reloader) currentStamps() map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	paths := []string{r.cfg.CertPath, r.cfg.KeyPath}
+	for _, pair := range r.cfg.Certificates {
+		paths = append(paths, pair.CertPath, pair.KeyPath)
+	}
+	if r.cfg.CertDir != "" {
+		paths = append(paths, r.cfg.CertDir)
+		if pairs, err := keyPairsInDir(r.cfg.CertDir); err == nil {
+			for _, pair := range pairs {
+				paths = append(paths, pair.CertPath, pair.KeyPath)
+			}
+		}
+	}
+	for _, source := range r.cfg.caSources() {
+		// Directories are stamped too, so added or removed files are noticed
+		paths = append(paths, source)
+		if files, err := caFiles([]string{source}); err == nil {
+			paths = append(paths, files...)
+		}
+	}
+
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			stamps[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return stamps
+}
+
+// load reads and validates the files and swaps them in on success
+func (r *Reloader) load() error {
+	var (
+		cert   *tls.Certificate
+		certs  *CertificateSet
+		caPool *x509.CertPool
+		err    error
+	)
+
+	if r.cfg.hasCertificateSet() {
+		certs, err = LoadCertificateSet(r.cfg.keyPairs(), r.cfg.CertDir)
+		if err == nil {
+			cert = certs.Certificates()[0]
+		}
+	} else if r.cfg.CertPath != "" && r.cfg.KeyPath != "" {
+		cert, err = loadKeyPair(r.cfg.CertPath, r.cfg.KeyPath)
+	}
+	if err == nil && r.cfg.hasCA() {
+		caPool, err = loadCACerts(r.cfg.caSources(), r.cfg.UseSystemRoots)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event := ReloadEvent{Time: time.Now(), Err: err}
+	if err == nil {
+		r.cert = cert
+		r.certs = certs
+		r.caPool = caPool
+		r.serverCfg = nil
+	}
+	r.lastErr = err
+	if r.cert != nil {
+		event.Leaf = r.cert.Leaf
+	}
+
+	// Don't block reloads on a slow consumer
+	select {
+	case r.events <- event:
+	default:
+	}
+
+	return err
+}
+
+// loadKeyPair loads a certificate and key and checks they are usable now
+func loadKeyPair(certPath, keyPath string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	if cert.Leaf == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+	}
+
+	now := time.Now()
+	if now.Before(cert.Leaf.NotBefore) {
+		return nil, fmt.Errorf("certificate is not valid until %s", cert.Leaf.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(cert.Leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate expired at %s", cert.Leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	return &cert, nil
+}
@@ -0,0 +1,197 @@
+package tls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bxtal-lsn/gotransport/pkg/pkitest"
+)
+
+// writeFile writes data to name in dir and returns its path
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// serveTLS accepts connections on 127.0.0.1 and completes their handshake
+// with serverConfig, returning the listener address
+func serveTLS(t *testing.T, serverConfig *tls.Config) string {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if conn.(*tls.Conn).Handshake() == nil {
+					conn.Write([]byte{1})
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// dialTLS connects to addr and returns the handshake error of either side.
+// With TLS 1.3 the server rejects a client certificate after the client
+// finished, so the client reads the server's reply to learn the outcome.
+func dialTLS(addr string, clientConfig *tls.Config) error {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", addr, clientConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	return err
+}
+
+func TestReloaderClientVerifiesHost(t *testing.T) {
+	ca := pkitest.NewCA("Test CA")
+	dir := t.TempDir()
+	caPath := writeFile(t, dir, "ca.crt", ca.CertPEM())
+
+	tests := []struct {
+		name       string
+		leaf       *pkitest.Leaf
+		serverName string
+		wantErr    bool
+	}{
+		{"wrong host by IP", ca.WrongHost(), "", true},
+		{"wrong host by name", ca.WrongHost(), "localhost", true},
+		{"IP SAN without server name", ca.Server("127.0.0.1"), "", true},
+		{"matching name", ca.Server("localhost"), "localhost", false},
+		{"matching IP", ca.Server("127.0.0.1"), "127.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := serveTLS(t, pkitest.ServerConfig(tt.leaf, nil))
+
+			r, err := NewReloader(Config{CAPath: caPath, ServerName: tt.serverName}, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			clientConfig, err := r.ClientTLSConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = dialTLS(addr, clientConfig)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("dial error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReloaderClientUsesReloadedCA(t *testing.T) {
+	oldCA := pkitest.NewCA("Old CA")
+	newCA := pkitest.NewCA("New CA")
+	dir := t.TempDir()
+	caPath := writeFile(t, dir, "ca.crt", oldCA.CertPEM())
+
+	addr := serveTLS(t, pkitest.ServerConfig(newCA.Server("localhost"), nil))
+
+	r, err := NewReloader(Config{CAPath: caPath, ServerName: "localhost"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConfig, err := r.ClientTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dialTLS(addr, clientConfig); err == nil {
+		t.Fatal("server from an untrusted CA accepted")
+	}
+
+	writeFile(t, dir, "ca.crt", newCA.CertPEM())
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dialTLS(addr, clientConfig); err != nil {
+		t.Fatalf("dial after reload: %v", err)
+	}
+}
+
+func TestReloaderServesCertificateSet(t *testing.T) {
+	ca := pkitest.NewCA("Test CA")
+	dir := t.TempDir()
+	certDir := filepath.Join(dir, "certs")
+	if err := os.Mkdir(certDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writePair := func(name string, leaf *pkitest.Leaf) {
+		writeFile(t, certDir, name+".crt", leaf.CertPEM())
+		writeFile(t, certDir, name+".key", leaf.KeyPEM())
+	}
+	writePair("a", ca.Server("a.example"))
+	writePair("b", ca.Server("b.example"))
+
+	// Only a certificate directory, no CertPath
+	r, err := NewReloader(Config{CertDir: certDir}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig, err := r.ServerTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveTLS(t, serverConfig)
+
+	served := func(name string) *x509.Certificate {
+		t.Helper()
+		conn, err := tls.Dial("tcp", addr, pkitest.ClientConfig(ca, name, nil))
+		if err != nil {
+			t.Fatalf("dial %s: %v", name, err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0]
+	}
+
+	if got := served("a.example"); got.DNSNames[0] != "a.example" {
+		t.Fatalf("a.example served %v", got.DNSNames)
+	}
+	before := served("b.example")
+
+	// A rotated certificate and a new name are both picked up
+	writePair("b", ca.Server("b.example"))
+	writePair("c", ca.Server("c.example"))
+	r.reloadIfChanged()
+	if err := r.LastError(); err != nil {
+		t.Fatal(err)
+	}
+
+	if after := served("b.example"); after.SerialNumber.Cmp(before.SerialNumber) == 0 {
+		t.Fatal("rotated certificate for b.example not served")
+	}
+	if got := served("c.example"); got.DNSNames[0] != "c.example" {
+		t.Fatalf("c.example served %v", got.DNSNames)
+	}
+
+	// A broken pair keeps the previous set in use
+	writeFile(t, certDir, "c.key", []byte("not a key"))
+	if err := r.Reload(); err == nil {
+		t.Fatal("Reload() accepted a broken key")
+	}
+	served("c.example")
+}
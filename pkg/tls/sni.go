@@ -0,0 +1,171 @@
+package tls
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// KeyPair names a certificate file and its private key
+type KeyPair struct {
+	CertPath string
+	KeyPath  string
+}
+
+// CertificateSet serves one of several certificates per handshake, chosen
+// by the SNI server name and the client's supported signature algorithms
+type CertificateSet struct {
+	certs  []*tls.Certificate
+	byName map[string][]*tls.Certificate
+}
+
+// NewCertificateSet builds a set from loaded certificates. The first
+// certificate is the default for clients that match no other.
+func NewCertificateSet(certs ...*tls.Certificate) (*CertificateSet, error) {
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("certificate set is empty")
+	}
+
+	set := &CertificateSet{
+		certs:  certs,
+		byName: make(map[string][]*tls.Certificate),
+	}
+	for _, cert := range certs {
+		if cert.Leaf == nil {
+			return nil, fmt.Errorf("certificate has no parsed leaf")
+		}
+
+		names := cert.Leaf.DNSNames
+		if len(names) == 0 && cert.Leaf.Subject.CommonName != "" {
+			names = []string{cert.Leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			name = strings.ToLower(strings.TrimSuffix(name, "."))
+			set.byName[name] = append(set.byName[name], cert)
+		}
+	}
+
+	return set, nil
+}
+
+// hasCertificateSet reports whether cfg configures SNI certificates
+func (cfg Config) hasCertificateSet() bool {
+	return len(cfg.Certificates) > 0 || cfg.CertDir != ""
+}
+
+// keyPairs returns the key pairs of cfg, CertPath and KeyPath first
+func (cfg Config) keyPairs() []KeyPair {
+	pairs := cfg.Certificates
+	if cfg.CertPath != "" && cfg.KeyPath != "" {
+		pairs = append([]KeyPair{{CertPath: cfg.CertPath, KeyPath: cfg.KeyPath}}, pairs...)
+	}
+	return pairs
+}
+
+// LoadCertificateSet loads key pairs from files and from a directory of
+// <name>.crt/<name>.key pairs
+func LoadCertificateSet(pairs []KeyPair, dir string) (*CertificateSet, error) {
+	certs := make([]*tls.Certificate, 0, len(pairs))
+	for _, pair := range pairs {
+		cert, err := loadKeyPair(pair.CertPath, pair.KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pair.CertPath, err)
+		}
+		certs = append(certs, cert)
+	}
+
+	if dir != "" {
+		dirPairs, err := keyPairsInDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, pair := range dirPairs {
+			cert, err := loadKeyPair(pair.CertPath, pair.KeyPath)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", pair.CertPath, err)
+			}
+			// A CA key pair kept next to its leaves is not served
+			if cert.Leaf.IsCA {
+				continue
+			}
+			certs = append(certs, cert)
+		}
+	}
+
+	return NewCertificateSet(certs...)
+}
+
+// GetCertificate implements tls.Config.GetCertificate. Exact names are
+// preferred over wildcards, and among certificates for the same name the
+// first one the client can verify (RSA or ECDSA) wins.
+func (s *CertificateSet) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+
+	var candidates []*tls.Certificate
+	if name != "" {
+		candidates = append(candidates, s.byName[name]...)
+		if _, parent, ok := strings.Cut(name, "."); ok {
+			candidates = append(candidates, s.byName["*."+parent]...)
+		}
+	}
+
+	if cert := firstSupported(hello, candidates); cert != nil {
+		return cert, nil
+	}
+	if len(candidates) > 0 {
+		return candidates[0], nil
+	}
+
+	// No name matched, fall back to any certificate the client supports
+	if cert := firstSupported(hello, s.certs); cert != nil {
+		return cert, nil
+	}
+	return s.certs[0], nil
+}
+
+// Certificates returns the certificates in the set
+func (s *CertificateSet) Certificates() []*tls.Certificate {
+	return s.certs
+}
+
+// firstSupported returns the first certificate compatible with the
+// client's signature algorithms and curves
+func firstSupported(hello *tls.ClientHelloInfo, certs []*tls.Certificate) *tls.Certificate {
+	for _, cert := range certs {
+		// SupportsCertificate also checks the SNI name, so compare against
+		// a copy without it; the name was matched by the caller
+		info := *hello
+		info.ServerName = ""
+		if info.SupportsCertificate(cert) == nil {
+			return cert
+		}
+	}
+	return nil
+}
+
+// keyPairsInDir finds every <name>.crt with a matching <name>.key in dir
+func keyPairsInDir(dir string) ([]KeyPair, error) {
+	certFiles, err := filepath.Glob(filepath.Join(dir, "*.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate directory: %w", err)
+	}
+	sort.Strings(certFiles)
+
+	pairs := make([]KeyPair, 0, len(certFiles))
+	for _, certFile := range certFiles {
+		keyFile := strings.TrimSuffix(certFile, ".crt") + ".key"
+		if _, err := os.Stat(keyFile); err != nil {
+			// Certificates without a key, such as the CA, are skipped
+			continue
+		}
+		pairs = append(pairs, KeyPair{CertPath: certFile, KeyPath: keyFile})
+	}
+
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("no <name>.crt/<name>.key pairs found in %s", dir)
+	}
+	return pairs, nil
+}
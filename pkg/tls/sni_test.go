@@ -0,0 +1,74 @@
+package tls
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/bxtal-lsn/gotransport/pkg/pkitest"
+)
+
+func TestCertificateSetSelectsByName(t *testing.T) {
+	ca := pkitest.NewCA("Test CA")
+	dir := t.TempDir()
+
+	var pairs []KeyPair
+	for _, leaf := range []*pkitest.Leaf{
+		ca.Server("default.example"),
+		ca.Server("*.apps.example"),
+		ca.Server("api.apps.example"),
+	} {
+		name := leaf.Cert.DNSNames[0]
+		pairs = append(pairs, KeyPair{
+			CertPath: writeFile(t, dir, name+".crt", leaf.CertPEM()),
+			KeyPath:  writeFile(t, dir, name+".key", leaf.KeyPEM()),
+		})
+	}
+	set, err := LoadCertificateSet(pairs, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		serverName string
+		want       string
+	}{
+		{"api.apps.example", "api.apps.example"},
+		{"API.Apps.Example.", "api.apps.example"},
+		{"web.apps.example", "*.apps.example"},
+		{"deep.web.apps.example", "default.example"},
+		{"unknown.example", "default.example"},
+		{"", "default.example"},
+	}
+	for _, tt := range tests {
+		cert, err := set.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.serverName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cert.Leaf.DNSNames[0]; got != tt.want {
+			t.Errorf("%q served %s, want %s", tt.serverName, got, tt.want)
+		}
+	}
+}
+
+func TestServerCertDirSkipsCA(t *testing.T) {
+	ca := pkitest.NewCA("Test CA")
+	leaf := ca.Server("localhost")
+	dir := t.TempDir()
+
+	// A CA key pair next to the leaves must never be served
+	caLeaf := &pkitest.Leaf{Cert: ca.Cert, Key: ca.Key}
+	writeFile(t, dir, "ca.crt", caLeaf.CertPEM())
+	writeFile(t, dir, "ca.key", caLeaf.KeyPEM())
+	writeFile(t, dir, "server.crt", leaf.CertPEM())
+	writeFile(t, dir, "server.key", leaf.KeyPEM())
+
+	serverConfig, err := NewServerTLSConfig(Config{CertDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveTLS(t, serverConfig)
+
+	if err := dialTLS(addr, pkitest.ClientConfig(ca, "localhost", nil)); err != nil {
+		t.Fatal(err)
+	}
+}
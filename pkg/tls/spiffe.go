@@ -0,0 +1,72 @@
+package tls
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/bxtal-lsn/gotransport/pkg/cert"
+)
+
+// SPIFFEMatcher decides whether a peer with the given SPIFFE ID is allowed
+type SPIFFEMatcher func(id *url.URL) error
+
+// MatchSPIFFEID allows peers whose SPIFFE ID equals one of ids
+func MatchSPIFFEID(ids ...string) SPIFFEMatcher {
+	return func(id *url.URL) error {
+		for _, allowed := range ids {
+			if id.String() == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("SPIFFE ID %s is not authorized", id)
+	}
+}
+
+// MatchSPIFFEIDPrefix allows peers whose SPIFFE ID is prefix or lies below it
+// in the path hierarchy. spiffe://td/ns/prod matches spiffe://td/ns/prod/api
+// but not spiffe://td/ns/production.
+func MatchSPIFFEIDPrefix(prefix string) SPIFFEMatcher {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return func(id *url.URL) error {
+		s := id.String()
+		if s == prefix || strings.HasPrefix(s, prefix+"/") {
+			return nil
+		}
+		return fmt.Errorf("SPIFFE ID %s is not under %s", id, prefix)
+	}
+}
+
+// MatchTrustDomain allows any peer that is a member of the trust domain
+func MatchTrustDomain(trustDomain string) SPIFFEMatcher {
+	trustDomain = strings.TrimPrefix(trustDomain, cert.SPIFFEScheme+"://")
+	return func(id *url.URL) error {
+		if id.Host == trustDomain {
+			return nil
+		}
+		return fmt.Errorf("SPIFFE ID %s is not a member of trust domain %s", id, trustDomain)
+	}
+}
+
+// VerifyPeerSPIFFEID returns a tls.Config.VerifyPeerCertificate callback that
+// authorizes the verified peer certificate by its SPIFFE ID. It relies on the
+// standard chain verification having run, and rejects peers without a
+// verified chain.
+func VerifyPeerSPIFFEID(match SPIFFEMatcher) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+			return &AuthorizationError{Rule: RuleVerified, Err: fmt.Errorf("peer certificate was not verified")}
+		}
+		leaf := verifiedChains[0][0]
+
+		id, err := cert.SPIFFEIDFromCert(leaf)
+		if err != nil {
+			return &AuthorizationError{Rule: RuleSPIFFEID, Peer: leaf.Subject.String(), Err: fmt.Errorf("peer is not a SPIFFE workload: %w", err)}
+		}
+		if err := match(id); err != nil {
+			return &AuthorizationError{Rule: RuleSPIFFEID, Peer: leaf.Subject.String(), Err: err}
+		}
+		return nil
+	}
+}
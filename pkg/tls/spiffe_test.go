@@ -0,0 +1,81 @@
+package tls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"testing"
+
+	"github.com/bxtal-lsn/gotransport/pkg/pkitest"
+)
+
+func TestSPIFFEMatchers(t *testing.T) {
+	ca := pkitest.NewCA("Test CA")
+	svid := ca.Client("api", pkitest.WithSPIFFEID("spiffe://example.org/ns/prod/api")).Cert
+	chains := [][]*x509.Certificate{{svid, ca.Cert}}
+
+	tests := []struct {
+		name    string
+		match   SPIFFEMatcher
+		wantErr bool
+	}{
+		{"exact", MatchSPIFFEID("spiffe://example.org/ns/prod/api"), false},
+		{"other ID", MatchSPIFFEID("spiffe://example.org/ns/prod/web"), true},
+		{"prefix", MatchSPIFFEIDPrefix("spiffe://example.org/ns/prod/"), false},
+		{"prefix is not a path segment", MatchSPIFFEIDPrefix("spiffe://example.org/ns/pro"), true},
+		{"trust domain", MatchTrustDomain("spiffe://example.org"), false},
+		{"other trust domain", MatchTrustDomain("example.com"), true},
+	}
+	for _, tt := range tests {
+		err := VerifyPeerSPIFFEID(tt.match)(nil, chains)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// Unverified peers and certificates without a SPIFFE ID are refused
+	var authErr *AuthorizationError
+	err := VerifyPeerSPIFFEID(MatchTrustDomain("example.org"))(nil, nil)
+	if !errors.As(err, &authErr) || authErr.Rule != RuleVerified {
+		t.Errorf("unverified peer: error = %v, want %s rejection", err, RuleVerified)
+	}
+	plain := ca.Client("plain").Cert
+	err = VerifyPeerSPIFFEID(MatchTrustDomain("example.org"))(nil, [][]*x509.Certificate{{plain, ca.Cert}})
+	if !errors.As(err, &authErr) || authErr.Rule != RuleSPIFFEID {
+		t.Errorf("plain certificate: error = %v, want %s rejection", err, RuleSPIFFEID)
+	}
+}
+
+func TestServerAuthorizesSPIFFEClients(t *testing.T) {
+	ca := pkitest.NewCA("Test CA")
+	server := ca.Server("localhost")
+	dir := t.TempDir()
+
+	serverConfig, err := NewServerTLSConfig(Config{
+		CAPath:          writeFile(t, dir, "ca.crt", ca.CertPEM()),
+		CertPath:        writeFile(t, dir, "server.crt", server.CertPEM()),
+		KeyPath:         writeFile(t, dir, "server.key", server.KeyPEM()),
+		ClientAuth:      tls.RequireAndVerifyClientCert,
+		AuthorizeSPIFFE: MatchSPIFFEIDPrefix("spiffe://example.org/ns/prod"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveTLS(t, serverConfig)
+
+	tests := []struct {
+		name    string
+		client  *pkitest.Leaf
+		wantErr bool
+	}{
+		{"workload in namespace", ca.Client("api", pkitest.WithSPIFFEID("spiffe://example.org/ns/prod/api")), false},
+		{"other namespace", ca.Client("api", pkitest.WithSPIFFEID("spiffe://example.org/ns/dev/api")), true},
+		{"no SPIFFE ID", ca.Client("api"), true},
+	}
+	for _, tt := range tests {
+		err := dialTLS(addr, pkitest.ClientConfig(ca, "localhost", tt.client))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
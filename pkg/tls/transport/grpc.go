@@ -0,0 +1,72 @@
+package transport
+
+import (
+	"context"
+
+	gotls "github.com/bxtal-lsn/gotransport/pkg/tls"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	grpcpeer "google.golang.org/grpc/peer"
+)
+
+// NewGRPCServerCredentials returns gRPC server credentials built from cfg.
+// A non-nil reloader supplies the certificate and client CA pool.
+func NewGRPCServerCredentials(cfg gotls.Config, reloader *gotls.Reloader) (credentials.TransportCredentials, error) {
+	tlsConfig, err := serverTLSConfig(cfg, reloader, []string{"h2"})
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// NewGRPCClientCredentials returns gRPC client credentials built from cfg.
+// A non-nil reloader supplies the client certificate and root CA pool.
+func NewGRPCClientCredentials(cfg gotls.Config, reloader *gotls.Reloader) (credentials.TransportCredentials, error) {
+	tlsConfig, err := clientTLSConfig(cfg, reloader)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// UnaryPeerIdentity is a gRPC interceptor that stores the verified client
+// identity in the request context, where handlers read it with
+// PeerFromContext
+func UnaryPeerIdentity() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(grpcPeerContext(ctx), req)
+	}
+}
+
+// StreamPeerIdentity is the streaming counterpart of UnaryPeerIdentity
+func StreamPeerIdentity() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &peerStream{ServerStream: stream, ctx: grpcPeerContext(stream.Context())})
+	}
+}
+
+// peerStream overrides the context of a server stream
+type peerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *peerStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcPeerContext adds the verified TLS peer of a gRPC call to ctx
+func grpcPeerContext(ctx context.Context) context.Context {
+	p, ok := grpcpeer.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ctx
+	}
+	if peer, ok := PeerFromConnectionState(&info.State); ok {
+		return NewContext(ctx, peer)
+	}
+	return ctx
+}
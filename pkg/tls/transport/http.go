@@ -0,0 +1,110 @@
+package transport
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	gotls "github.com/bxtal-lsn/gotransport/pkg/tls"
+)
+
+// Default timeouts, chosen to bound slow or idle peers without affecting
+// ordinary requests
+const (
+	DefaultReadHeaderTimeout   = 10 * time.Second
+	DefaultIdleTimeout         = 2 * time.Minute
+	DefaultClientTimeout       = 30 * time.Second
+	DefaultDialTimeout         = 10 * time.Second
+	DefaultTLSHandshakeTimeout = 10 * time.Second
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 10
+)
+
+// ServerOptions tunes an HTTP server. Zero values select the defaults.
+type ServerOptions struct {
+	// Reloader, if set, supplies the certificate and client CA pool so
+	// rotated files are picked up without a restart. SNI certificates
+	// belong in its config, not in the one passed to NewHTTPServer.
+	Reloader          *gotls.Reloader
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+}
+
+// ClientOptions tunes an HTTP client. Zero values select the defaults.
+type ClientOptions struct {
+	// Reloader, if set, supplies the client certificate and root CA pool
+	// so rotated files are picked up without a restart
+	Reloader            *gotls.Reloader
+	Timeout             time.Duration
+	DialTimeout         time.Duration
+	TLSHandshakeTimeout time.Duration
+	IdleConnTimeout     time.Duration
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limits connections per host, zero means no limit
+	MaxConnsPerHost int
+}
+
+// NewHTTPServer returns an HTTPS server for handler using cfg. The handler
+// is wrapped with PeerIdentity. Start it with ListenAndServeTLS("", "").
+func NewHTTPServer(addr string, handler http.Handler, cfg gotls.Config, opts ServerOptions) (*http.Server, error) {
+	tlsConfig, err := serverTLSConfig(cfg, opts.Reloader, []string{"h2", "http/1.1"})
+	if err != nil {
+		return nil, err
+	}
+
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+
+	return &http.Server{
+		Addr:              addr,
+		Handler:           PeerIdentity(handler),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: orDefault(opts.ReadHeaderTimeout, DefaultReadHeaderTimeout),
+		ReadTimeout:       opts.ReadTimeout,
+		WriteTimeout:      opts.WriteTimeout,
+		IdleTimeout:       orDefault(opts.IdleTimeout, DefaultIdleTimeout),
+	}, nil
+}
+
+// NewHTTPClient returns an HTTP client that presents the certificate from
+// cfg and verifies servers against its CA. Connections are pooled per host.
+func NewHTTPClient(cfg gotls.Config, opts ClientOptions) (*http.Client, error) {
+	tlsConfig, err := clientTLSConfig(cfg, opts.Reloader)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   orDefault(opts.DialTimeout, DefaultDialTimeout),
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialer.DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: orDefault(opts.TLSHandshakeTimeout, DefaultTLSHandshakeTimeout),
+		IdleConnTimeout:     orDefault(opts.IdleConnTimeout, DefaultIdleTimeout),
+		MaxIdleConns:        orDefault(opts.MaxIdleConns, DefaultMaxIdleConns),
+		MaxIdleConnsPerHost: orDefault(opts.MaxIdleConnsPerHost, DefaultMaxIdleConnsPerHost),
+		MaxConnsPerHost:     opts.MaxConnsPerHost,
+		ForceAttemptHTTP2:   true,
+	}
+
+	return &http.Client{
+		Timeout:   orDefault(opts.Timeout, DefaultClientTimeout),
+		Transport: transport,
+	}, nil
+}
+
+// orDefault returns value unless it is zero
+func orDefault[T time.Duration | int](value, def T) T {
+	if value == 0 {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,147 @@
+package transport
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bxtal-lsn/gotransport/pkg/pkitest"
+	gotls "github.com/bxtal-lsn/gotransport/pkg/tls"
+)
+
+// writeFiles writes each name and content pair to a temporary directory
+// and returns the paths in the same order
+func writeFiles(t *testing.T, files ...interface{}) []string {
+	t.Helper()
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < len(files); i += 2 {
+		path := filepath.Join(dir, files[i].(string))
+		if err := os.WriteFile(path, files[i+1].([]byte), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// startServer serves handler over mTLS and returns its base URL
+func startServer(t *testing.T, handler http.Handler, cfg gotls.Config, opts ServerOptions) string {
+	t.Helper()
+	server, err := NewHTTPServer("127.0.0.1:0", handler, cfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeTLS(ln, "", "")
+	t.Cleanup(func() { server.Close() })
+	return "https://" + ln.Addr().String()
+}
+
+func TestHTTPPeerIdentity(t *testing.T) {
+	ca := pkitest.NewCA("Test CA")
+	server := ca.Server("127.0.0.1")
+	client := ca.Client("api", pkitest.WithSPIFFEID("spiffe://example.org/api"))
+
+	paths := writeFiles(t,
+		"ca.crt", ca.CertPEM(),
+		"server.crt", server.CertPEM(), "server.key", server.KeyPEM(),
+		"client.crt", client.CertPEM(), "client.key", client.KeyPEM())
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, ok := PeerFromContext(r.Context())
+		if !ok {
+			http.Error(w, "no peer", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, "%s %s %s", r.Proto, peer.CommonName, peer.SPIFFEID)
+	})
+	url := startServer(t, handler, gotls.Config{
+		CAPath:     paths[0],
+		CertPath:   paths[1],
+		KeyPath:    paths[2],
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	}, ServerOptions{})
+
+	httpClient, err := NewHTTPClient(gotls.Config{
+		CAPath:     paths[0],
+		CertPath:   paths[3],
+		KeyPath:    paths[4],
+		ServerName: "127.0.0.1",
+	}, ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if want := "HTTP/2.0 api spiffe://example.org/api"; string(body) != want {
+		t.Fatalf("response %q, want %q", body, want)
+	}
+
+	// A client without a certificate is refused
+	anonymous, err := NewHTTPClient(gotls.Config{CAPath: paths[0], ServerName: "127.0.0.1"}, ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := anonymous.Get(url); err == nil {
+		resp.Body.Close()
+		t.Fatal("client without a certificate accepted")
+	}
+}
+
+func TestHTTPServerReloaderSNI(t *testing.T) {
+	ca := pkitest.NewCA("Test CA")
+	a, b := ca.Server("a.test"), ca.Server("b.test")
+	paths := writeFiles(t,
+		"ca.crt", ca.CertPEM(),
+		"a.crt", a.CertPEM(), "a.key", a.KeyPEM(),
+		"b.crt", b.CertPEM(), "b.key", b.KeyPEM())
+	pairs := []gotls.KeyPair{{CertPath: paths[1], KeyPath: paths[2]}, {CertPath: paths[3], KeyPath: paths[4]}}
+
+	reloader, err := gotls.NewReloader(gotls.Config{Certificates: pairs}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// SNI certificates next to a reloader would never be served
+	for name, cfg := range map[string]gotls.Config{
+		"certificates": {Certificates: pairs},
+		"directory":    {CertDir: filepath.Dir(paths[0])},
+	} {
+		if _, err := NewHTTPServer("127.0.0.1:0", nil, cfg, ServerOptions{Reloader: reloader}); err == nil {
+			t.Errorf("%s: server accepted SNI certificates beside a reloader", name)
+		}
+		if _, err := NewGRPCServerCredentials(cfg, reloader); err == nil {
+			t.Errorf("%s: gRPC credentials accepted SNI certificates beside a reloader", name)
+		}
+	}
+
+	// In the reloader's config they are served per name
+	addr := strings.TrimPrefix(startServer(t, nil, gotls.Config{}, ServerOptions{Reloader: reloader}), "https://")
+	for _, name := range []string{"a.test", "b.test"} {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: ca.Pool(), ServerName: name})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got := conn.ConnectionState().PeerCertificates[0].DNSNames[0]
+		conn.Close()
+		if got != name {
+			t.Errorf("SNI %s served %s", name, got)
+		}
+	}
+}
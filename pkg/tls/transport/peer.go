@@ -0,0 +1,64 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+
+	"github.com/bxtal-lsn/gotransport/pkg/cert"
+)
+
+// Peer is the identity of a client whose certificate chain was verified
+type Peer struct {
+	// Certificate is the verified leaf certificate
+	Certificate *x509.Certificate
+	// Chain is the verified chain from the leaf up to a trusted root
+	Chain      []*x509.Certificate
+	CommonName string
+	// SPIFFEID is empty unless the certificate is an X.509-SVID
+	SPIFFEID string
+}
+
+type peerKey struct{}
+
+// NewContext returns a copy of ctx carrying peer
+func NewContext(ctx context.Context, peer *Peer) context.Context {
+	return context.WithValue(ctx, peerKey{}, peer)
+}
+
+// PeerFromContext returns the verified peer stored in ctx, if any
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	peer, ok := ctx.Value(peerKey{}).(*Peer)
+	return peer, ok && peer != nil
+}
+
+// PeerFromConnectionState returns the verified peer of a TLS connection.
+// Certificates the client sent but that were not verified are ignored.
+func PeerFromConnectionState(state *tls.ConnectionState) (*Peer, bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+
+	chain := state.VerifiedChains[0]
+	peer := &Peer{
+		Certificate: chain[0],
+		Chain:       chain,
+		CommonName:  chain[0].Subject.CommonName,
+	}
+	if id, err := cert.SPIFFEIDFromCert(chain[0]); err == nil {
+		peer.SPIFFEID = id.String()
+	}
+	return peer, true
+}
+
+// PeerIdentity is HTTP middleware that stores the verified client identity
+// in the request context, where handlers read it with PeerFromContext
+func PeerIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if peer, ok := PeerFromConnectionState(req.TLS); ok {
+			req = req.WithContext(NewContext(req.Context(), peer))
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,47 @@
+// Package transport builds mTLS HTTP servers, HTTP clients and gRPC
+// credentials from a gotransport TLS Config
+package transport
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	gotls "github.com/bxtal-lsn/gotransport/pkg/tls"
+)
+
+// serverTLSConfig builds the server configuration for cfg. With a reloader,
+// the certificate and client CA pool are taken from it on every handshake,
+// so SNI certificates in cfg would never be served.
+func serverTLSConfig(cfg gotls.Config, reloader *gotls.Reloader, nextProtos []string) (*tls.Config, error) {
+	if reloader != nil && (len(cfg.Certificates) > 0 || cfg.CertDir != "") {
+		return nil, fmt.Errorf("SNI certificates are ignored with a reloader, set Certificates and CertDir in the reloader's config instead")
+	}
+
+	tlsConfig, err := gotls.NewServerTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set before the reloader snapshots the config, as configurations
+	// returned per handshake do not inherit them
+	tlsConfig.NextProtos = nextProtos
+
+	if reloader != nil {
+		reloader.ConfigureServer(tlsConfig)
+	}
+	return tlsConfig, nil
+}
+
+// clientTLSConfig builds the client configuration for cfg. With a reloader,
+// the client certificate and root CA pool are taken from it.
+func clientTLSConfig(cfg gotls.Config, reloader *gotls.Reloader) (*tls.Config, error) {
+	tlsConfig, err := gotls.NewClientTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if reloader != nil {
+		reloader.ConfigureClient(tlsConfig)
+	}
+	return tlsConfig, nil
+}